@@ -17,9 +17,10 @@ import (
 
 // ExpenseForAI represents an expense to be categorized by AI
 type ExpenseForAI struct {
-	ID          int     `json:"id"`
-	Description string  `json:"description"`
-	Amount      float64 `json:"amount"`
+	ID          int          `json:"id"`
+	Description string       `json:"description"`
+	Vendor      string       `json:"vendor,omitempty"`
+	Amount      models.Money `json:"amount"`
 }
 
 // CategorizeResponse represents the AI categorization result
@@ -40,14 +41,18 @@ type CategorizeFullResponse struct {
 // GetUncategorizedExpenses retrieves the next batch of uncategorized, non-personal expenses
 func GetUncategorizedExpenses(ctx context.Context, projectID int, limit int) ([]ExpenseForAI, error) {
 	query := `
-		SELECT id, COALESCE(description, '') as description, COALESCE(amount, 0) as amount
-		FROM expense 
-		WHERE project_id = $1 
-		  AND accepted_category_id IS NULL 
-		  AND suggested_category_id IS NULL
-		  AND (is_personal IS NULL OR is_personal = FALSE)
-		  AND deleted_at IS NULL
-		ORDER BY row_index ASC
+		SELECT e.id, COALESCE(e.description, '') as description, COALESCE(v.name, '') as vendor,
+		       COALESCE(e.amount, 0) as amount
+		FROM expense e
+		LEFT JOIN vendor v ON e.vendor_id = v.id
+		WHERE e.project_id = $1 
+		  AND e.accepted_category_id IS NULL 
+		  AND e.suggested_category_id IS NULL
+		  AND (e.is_personal IS NULL OR e.is_personal = FALSE)
+		  AND e.transfer_id IS NULL
+		  AND e.refund_of_expense_id IS NULL
+		  AND e.deleted_at IS NULL
+		ORDER BY e.row_index ASC
 		LIMIT $2
 	`
 
@@ -60,7 +65,7 @@ func GetUncategorizedExpenses(ctx context.Context, projectID int, limit int) ([]
 	var expenses []ExpenseForAI
 	for rows.Next() {
 		var expense ExpenseForAI
-		err := rows.Scan(&expense.ID, &expense.Description, &expense.Amount)
+		err := rows.Scan(&expense.ID, &expense.Description, &expense.Vendor, &expense.Amount)
 		if err != nil {
 			return nil, err
 		}
@@ -77,10 +82,12 @@ func GetExpensesByIDs(ctx context.Context, expenseIDs []int) ([]ExpenseForAI, er
 	}
 
 	query := `
-		SELECT id, COALESCE(description, '') as description, COALESCE(amount, 0) as amount
-		FROM expense 
-		WHERE id = ANY($1)
-		ORDER BY row_index ASC
+		SELECT e.id, COALESCE(e.description, '') as description, COALESCE(v.name, '') as vendor,
+		       COALESCE(e.amount, 0) as amount
+		FROM expense e
+		LEFT JOIN vendor v ON e.vendor_id = v.id
+		WHERE e.id = ANY($1)
+		ORDER BY e.row_index ASC
 	`
 
 	rows, err := database.Pool.Query(ctx, query, expenseIDs)
@@ -92,7 +99,7 @@ func GetExpensesByIDs(ctx context.Context, expenseIDs []int) ([]ExpenseForAI, er
 	var expenses []ExpenseForAI
 	for rows.Next() {
 		var expense ExpenseForAI
-		err := rows.Scan(&expense.ID, &expense.Description, &expense.Amount)
+		err := rows.Scan(&expense.ID, &expense.Description, &expense.Vendor, &expense.Amount)
 		if err != nil {
 			return nil, err
 		}
@@ -102,16 +109,17 @@ func GetExpensesByIDs(ctx context.Context, expenseIDs []int) ([]ExpenseForAI, er
 	return expenses, rows.Err()
 }
 
-// GetAllCategories retrieves all available categories
-func GetAllCategories(ctx context.Context) ([]models.ExpenseCategory, error) {
+// GetProjectCategories retrieves the categories a project can use: its own list plus the
+// owner's defaults when the project inherits them
+func GetProjectCategories(ctx context.Context, projectID int) ([]models.ExpenseCategory, error) {
 	query := `
-		SELECT id, name, sort_order, created_at 
-		FROM expense_category 
-		WHERE deleted_at IS NULL 
-		ORDER BY sort_order ASC
+		SELECT id, name, description, include_guidance, exclude_guidance, examples, parent_id, sort_order, created_at
+		FROM project_categories($1) 
+		WHERE user_id = $2 
+		ORDER BY project_id IS NULL, sort_order ASC, id ASC
 	`
 
-	rows, err := database.Pool.Query(ctx, query)
+	rows, err := database.Pool.Query(ctx, query, projectID, models.TEST_USER_ID)
 	if err != nil {
 		return nil, err
 	}
@@ -120,14 +128,77 @@ func GetAllCategories(ctx context.Context) ([]models.ExpenseCategory, error) {
 	var categories []models.ExpenseCategory
 	for rows.Next() {
 		var cat models.ExpenseCategory
-		err := rows.Scan(&cat.ID, &cat.Name, &cat.SortOrder, &cat.CreatedAt)
+		err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.IncludeGuidance, &cat.ExcludeGuidance, &cat.Examples,
+			&cat.ParentID, &cat.SortOrder, &cat.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
 		categories = append(categories, cat)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return categories, rows.Err()
+	return orderCategoryTree(categories), nil
+}
+
+// orderCategoryTree lists parents before their children, keeping sibling order, and sets
+// each category's depth. Categories whose parent is missing are treated as top level.
+func orderCategoryTree(categories []models.ExpenseCategory) []models.ExpenseCategory {
+	present := make(map[int64]bool, len(categories))
+	for _, cat := range categories {
+		present[cat.ID] = true
+	}
+
+	children := make(map[int64][]models.ExpenseCategory)
+	var roots []models.ExpenseCategory
+	for _, cat := range categories {
+		if cat.ParentID != nil && present[*cat.ParentID] {
+			children[*cat.ParentID] = append(children[*cat.ParentID], cat)
+		} else {
+			roots = append(roots, cat)
+		}
+	}
+
+	ordered := make([]models.ExpenseCategory, 0, len(categories))
+	var walk func([]models.ExpenseCategory, int)
+	walk = func(level []models.ExpenseCategory, depth int) {
+		for _, cat := range level {
+			cat.Depth = depth
+			ordered = append(ordered, cat)
+			walk(children[cat.ID], depth+1)
+		}
+	}
+	walk(roots, 0)
+	return ordered
+}
+
+// categoryPaths maps each category ID to its hierarchy path, e.g. "Travel > Airfare"
+func categoryPaths(categories []models.ExpenseCategory) map[int64]string {
+	byID := make(map[int64]models.ExpenseCategory, len(categories))
+	for _, cat := range categories {
+		byID[cat.ID] = cat
+	}
+
+	paths := make(map[int64]string, len(categories))
+	var pathOf func(cat models.ExpenseCategory, depth int) string
+	pathOf = func(cat models.ExpenseCategory, depth int) string {
+		if path, ok := paths[cat.ID]; ok {
+			return path
+		}
+		path := cat.Name
+		if cat.ParentID != nil && depth < len(categories) { // depth guards against a cycle
+			if parent, ok := byID[*cat.ParentID]; ok {
+				path = pathOf(parent, depth+1) + " > " + cat.Name
+			}
+		}
+		paths[cat.ID] = path
+		return path
+	}
+	for _, cat := range categories {
+		pathOf(cat, 0)
+	}
+	return paths
 }
 
 // ProcessCategorizationLogic contains the core AI categorization logic
@@ -182,7 +253,7 @@ func ProcessCategorizationLogic(ctx context.Context, projectID int, expensesToCa
 	}
 
 	// Step 6: Parse AI response
-	aiResponses, err := parseAIResponse(aiResponse, expensesToCategorize)
+	aiResponses, err := parseAIResponse(aiResponse, expensesToCategorize, categoryDetails)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse AI response: %v", err)
 	}
@@ -262,13 +333,16 @@ func fetchAcceptedMap(ctx context.Context, projectID int, currentDescriptions []
 		return make(map[string]int), nil
 	}
 
-	// Fallback query without pg_trgm (just get all accepted descriptions)
+	// Fallback query without pg_trgm (just get all accepted descriptions). Expenses with a
+	// vendor are keyed by vendor name so repeat merchants take one line of the prompt.
 	fallbackQuery := `
-		SELECT DISTINCT lower(description) AS key,
-		       accepted_category_id
-		FROM   expense
-		WHERE  project_id = $1
-		  AND  accepted_category_id IS NOT NULL
+		SELECT DISTINCT COALESCE(v.name, lower(e.description)) AS key,
+		       e.accepted_category_id
+		FROM   expense e
+		LEFT JOIN vendor v ON e.vendor_id = v.id
+		WHERE  e.project_id = $1
+		  AND  e.accepted_category_id IS NOT NULL
+		  AND  e.deleted_at IS NULL
 		LIMIT  50
 	`
 
@@ -296,15 +370,59 @@ func fetchAcceptedMap(ctx context.Context, projectID int, currentDescriptions []
 	return acceptedMap, rows.Err()
 }
 
+// writeCategoryGuidance writes a category's description, guidance and pinned examples as
+// indented notes under its line in the prompt, and reports whether it wrote any
+func writeCategoryGuidance(prompt *strings.Builder, cat models.ExpenseCategory) bool {
+	wrote := false
+	note := func(label string, value *string) {
+		if value != nil && *value != "" {
+			prompt.WriteString(fmt.Sprintf("    %s: %s\n", label, *value))
+			wrote = true
+		}
+	}
+	note("Description", cat.Description)
+	note("Use for", cat.IncludeGuidance)
+	note("Not for", cat.ExcludeGuidance)
+	if len(cat.Examples) > 0 {
+		quoted := make([]string, len(cat.Examples))
+		for i, example := range cat.Examples {
+			quoted[i] = "'" + example + "'"
+		}
+		prompt.WriteString(fmt.Sprintf("    Examples: %s\n", strings.Join(quoted, ", ")))
+		wrote = true
+	}
+	return wrote
+}
+
 func buildCategorizationPrompt(expenses []ExpenseForAI, categories []models.ExpenseCategory, acceptedMap map[string]int) string {
 	var prompt strings.Builder
 
 	prompt.WriteString("You are an expert accountant helping categorize business expenses. ")
 	prompt.WriteString("Analyze each expense description and amount, then choose the best category from the provided list.\n\n")
 
+	paths := categoryPaths(categories)
+	hasSubcategories := false
+	for _, cat := range categories {
+		if cat.ParentID != nil {
+			hasSubcategories = true
+			break
+		}
+	}
+
 	prompt.WriteString("Available Categories:\n")
+	hasGuidance := false
 	for _, cat := range categories {
-		prompt.WriteString(fmt.Sprintf("- ID: %d, Name: %s\n", cat.ID, cat.Name))
+		prompt.WriteString(fmt.Sprintf("- ID: %d, Name: %s\n", cat.ID, paths[cat.ID]))
+		if writeCategoryGuidance(&prompt, cat) {
+			hasGuidance = true
+		}
+	}
+	if hasSubcategories {
+		prompt.WriteString("\nNames show the category hierarchy (Parent > Child). Prefer the most specific subcategory that fits.\n")
+	}
+	if hasGuidance {
+		prompt.WriteString("\nThe notes under a category are this firm's conventions. Follow them even where general practice differs: ")
+		prompt.WriteString("never choose a category for something its \"Not for\" note excludes, and treat its examples as correct categorizations.\n")
 	}
 
 	// Add accepted map for context if available
@@ -313,11 +431,8 @@ func buildCategorizationPrompt(expenses []ExpenseForAI, categories []models.Expe
 		for desc, categoryID := range acceptedMap {
 			// Find category name by ID
 			categoryName := "Unknown"
-			for _, cat := range categories {
-				if int(cat.ID) == categoryID {
-					categoryName = cat.Name
-					break
-				}
+			if path, ok := paths[int64(categoryID)]; ok {
+				categoryName = path
 			}
 			prompt.WriteString(fmt.Sprintf("- '%s' → %s (ID: %d)\n", desc, categoryName, categoryID))
 		}
@@ -326,7 +441,11 @@ func buildCategorizationPrompt(expenses []ExpenseForAI, categories []models.Expe
 
 	prompt.WriteString("\nExpenses to categorize:\n")
 	for _, expense := range expenses {
-		prompt.WriteString(fmt.Sprintf("- ID: %d, Description: '%s', Amount: $%.2f\n", expense.ID, expense.Description, expense.Amount))
+		if expense.Vendor != "" {
+			prompt.WriteString(fmt.Sprintf("- ID: %d, Vendor: '%s', Description: '%s', Amount: $%s\n", expense.ID, expense.Vendor, expense.Description, expense.Amount))
+			continue
+		}
+		prompt.WriteString(fmt.Sprintf("- ID: %d, Description: '%s', Amount: $%s\n", expense.ID, expense.Description, expense.Amount))
 	}
 
 	prompt.WriteString("\nReturn your response as a JSON array with this exact format:\n")
@@ -341,7 +460,7 @@ func buildCategorizationPrompt(expenses []ExpenseForAI, categories []models.Expe
 	return prompt.String()
 }
 
-func parseAIResponse(response string, expenses []ExpenseForAI) ([]CategorizeResponse, error) {
+func parseAIResponse(response string, expenses []ExpenseForAI, categories []models.ExpenseCategory) ([]CategorizeResponse, error) {
 	// Clean the response (remove markdown code blocks if present)
 	response = strings.TrimSpace(response)
 	response = strings.TrimPrefix(response, "```json")
@@ -355,8 +474,10 @@ func parseAIResponse(response string, expenses []ExpenseForAI) ([]CategorizeResp
 		return nil, fmt.Errorf("failed to parse AI JSON response: %v. Response was: %s", err, response)
 	}
 
-	// Validate responses
-	for i, resp := range aiResponses {
+	// Validate responses. An item naming a category outside the project's list is skipped,
+	// leaving that expense uncategorized, rather than failing the whole batch.
+	valid := aiResponses[:0]
+	for _, resp := range aiResponses {
 		// Validate that expense ID exists in the request
 		found := false
 		for _, expense := range expenses {
@@ -369,31 +490,57 @@ func parseAIResponse(response string, expenses []ExpenseForAI) ([]CategorizeResp
 			return nil, fmt.Errorf("AI returned invalid expense ID: %d", resp.RowID)
 		}
 
+		// Validate that the category is in the project's list
+		found = false
+		for _, category := range categories {
+			if category.ID == int64(resp.CategoryID) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Printf("Skipping AI suggestion for expense %d: category %d is not in the project's list", resp.RowID, resp.CategoryID)
+			continue
+		}
+
 		// Clamp confidence to valid range
 		if resp.Confidence < 0 {
-			aiResponses[i].Confidence = 0
+			resp.Confidence = 0
 		} else if resp.Confidence > 1 {
-			aiResponses[i].Confidence = 1
+			resp.Confidence = 1
 		}
+		valid = append(valid, resp)
 	}
 
-	return aiResponses, nil
+	return valid, nil
 }
 
+// storeCategorizationHistory records an AI suggestion in expense_history. A repeat
+// suggestion for an expense the AI has already seen is recorded as a retry.
 func storeCategorizationHistory(projectID, expenseID, categoryID int, model string, confidence float32, reasoning string) error {
 	query := `
-		INSERT INTO expense_history (expense_id, event_type, category_id, model_name, created_at)
-		VALUES ($1, 'ai_suggest', $2, $3, NOW())
+		INSERT INTO expense_history (expense_id, event_type, category_id, model_name, actor, old_value, new_value, created_at)
+		SELECT e.id,
+		       CASE WHEN EXISTS (
+		           SELECT 1 FROM expense_history h
+		           WHERE h.expense_id = e.id AND h.event_type IN ('ai_suggest', 'retry')
+		       ) THEN 'retry' ELSE 'ai_suggest' END,
+		       $2::bigint, $3::text, 'ai',
+		       jsonb_build_object('suggested_category_id', e.suggested_category_id),
+		       jsonb_build_object('suggested_category_id', $2::bigint, 'confidence', $4::real, 'reasoning', $5::text),
+		       NOW()
+		FROM expense e
+		WHERE e.id = $1
 	`
 
-	_, err := database.Pool.Exec(context.Background(), query, expenseID, categoryID, model)
+	_, err := database.Pool.Exec(context.Background(), query, expenseID, categoryID, model, confidence, reasoning)
 	return err
 }
 
 func updateExpenseSuggestion(ctx context.Context, expenseID int, categoryID int) error {
 	query := `
 		UPDATE expense 
-		SET suggested_category_id = $1, suggested_at = CURRENT_TIMESTAMP
+		SET suggested_category_id = $1, suggested_at = CURRENT_TIMESTAMP, version = version + 1
 		WHERE id = $2
 	`
 
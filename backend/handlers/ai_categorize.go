@@ -51,9 +51,9 @@ type AICategorizeRequest struct {
 
 // ExpenseForAI represents an expense to be categorized by AI
 type ExpenseForAI struct {
-	ID          int     `json:"id"`
-	Description string  `json:"description"`
-	Amount      float64 `json:"amount"`
+	ID          int          `json:"id"`
+	Description string       `json:"description"`
+	Amount      models.Money `json:"amount"`
 }
 
 // AICategorizeResponse represents the AI categorization result
@@ -102,8 +102,10 @@ func AICategorizeExpenses(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Query expenses to categorize BEFORE creating job
+	// Query expenses to categorize BEFORE creating job, once the rules have settled what
+	// they can
 	ctx := r.Context()
+	rulesApplied := applyRulesBeforeAI(ctx, int64(projectID))
 	expensesToCategorize, err := ai.GetUncategorizedExpenses(ctx, projectID, 20)
 	if err != nil {
 		log.Printf("Failed to get uncategorized expenses: %v", err)
@@ -142,6 +144,7 @@ func AICategorizeExpenses(w http.ResponseWriter, r *http.Request) {
 		"job_id":            job.GetID(),
 		"status":            job.GetStatus(),
 		"selected_expenses": selectedIDs,
+		"rules_applied":     rulesApplied,
 		"message":           fmt.Sprintf("Job created and queued for processing %d expenses", len(selectedIDs)),
 	}
 
@@ -170,7 +173,9 @@ func AICategorizeExpensesSync(w http.ResponseWriter, r *http.Request) {
 		req = AICategorizeRequest{}
 	}
 
-	// Step 1: Query next 20 uncategorized, non-personal expenses from database
+	// Step 1: Apply categorization rules, then query next 20 uncategorized, non-personal
+	// expenses from database
+	applyRulesBeforeAI(ctx, int64(projectID))
 	expensesToCategorize, err := ai.GetUncategorizedExpenses(ctx, projectID, 20)
 	if err != nil {
 		log.Printf("Failed to get uncategorized expenses: %v", err)
@@ -192,7 +197,7 @@ func AICategorizeExpensesSync(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Step 2: Get available categories from database
-	categoryDetails, err := ai.GetAllCategories(ctx)
+	categoryDetails, err := ai.GetProjectCategories(ctx, projectID)
 	if err != nil {
 		log.Printf("Failed to get categories: %v", err)
 		http.Error(w, "Failed to get categories", http.StatusInternalServerError)
@@ -239,7 +244,7 @@ func AICategorizeExpensesSync(w http.ResponseWriter, r *http.Request) {
 }
 
 // getCategoryDetails fetches category details from database by names
-// NOTE: This function is deprecated in favor of getAllCategories for new backend-driven approach
+// NOTE: This function is deprecated in favor of ai.GetProjectCategories for new backend-driven approach
 // func getCategoryDetails(categoryNames []string) ([]models.ExpenseCategory, error) {
 func getCategoryDetailsOld(categoryNames []string) ([]models.ExpenseCategory, error) {
 	if len(categoryNames) == 0 {
@@ -366,7 +371,7 @@ func buildCategorizationPrompt(expenses []ExpenseForAI, categories []models.Expe
 
 	prompt.WriteString("\nExpenses to categorize:\n")
 	for _, expense := range expenses {
-		prompt.WriteString(fmt.Sprintf("- ID: %d, Description: '%s', Amount: $%.2f\n", expense.ID, expense.Description, expense.Amount))
+		prompt.WriteString(fmt.Sprintf("- ID: %d, Description: '%s', Amount: $%s\n", expense.ID, expense.Description, expense.Amount))
 	}
 
 	prompt.WriteString("\nReturn your response as a JSON array with this exact format:\n")
@@ -436,7 +441,7 @@ func storeCategorizationHistory(projectID, expenseID, categoryID int, model stri
 func updateExpenseSuggestion(ctx context.Context, expenseID int, categoryID int) error {
 	query := `
 		UPDATE expense 
-		SET suggested_category_id = $1, suggested_at = CURRENT_TIMESTAMP
+		SET suggested_category_id = $1, suggested_at = CURRENT_TIMESTAMP, version = version + 1
 		WHERE id = $2
 	`
 
@@ -459,6 +464,8 @@ func getUncategorizedExpenses(ctx context.Context, projectID int, limit int) ([]
 		  AND accepted_category_id IS NULL 
 		  AND suggested_category_id IS NULL
 		  AND (is_personal IS NULL OR is_personal = FALSE)
+		  AND transfer_id IS NULL
+		  AND refund_of_expense_id IS NULL
 		  AND deleted_at IS NULL
 		ORDER BY row_index ASC
 		LIMIT $2
@@ -483,40 +490,6 @@ func getUncategorizedExpenses(ctx context.Context, projectID int, limit int) ([]
 	return expenses, rows.Err()
 }
 
-// GetAllCategories retrieves all available categories
-// Made public for use in job processor
-func GetAllCategories(ctx context.Context) ([]models.ExpenseCategory, error) {
-	return getAllCategories(ctx)
-}
-
-// getAllCategories retrieves all available categories
-func getAllCategories(ctx context.Context) ([]models.ExpenseCategory, error) {
-	query := `
-		SELECT id, name, sort_order, created_at 
-		FROM expense_category 
-		WHERE deleted_at IS NULL 
-		ORDER BY sort_order ASC
-	`
-
-	rows, err := database.Pool.Query(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var categories []models.ExpenseCategory
-	for rows.Next() {
-		var cat models.ExpenseCategory
-		err := rows.Scan(&cat.ID, &cat.Name, &cat.SortOrder, &cat.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		categories = append(categories, cat)
-	}
-
-	return categories, rows.Err()
-}
-
 func generateMockAIResponses(expenses []ExpenseForAI, categories []models.ExpenseCategory) []AICategorizeResponse {
 	var responses []AICategorizeResponse
 
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+const (
+	// anomalyScoreThreshold is the robust z-score above which an amount is flagged
+	anomalyScoreThreshold = 3.5
+	// anomalyMinSamples is how many charges a category or merchant needs before it has a baseline
+	anomalyMinSamples = 5
+	// categoryDeviationRatio flags a category total this many times above or below its usual total
+	categoryDeviationRatio = 3.0
+	// categoryMinOtherProjects is how many other projects need the category for a comparison
+	categoryMinOtherProjects = 2
+)
+
+// expenseAnomaly is a charge that is unusually large for its category or merchant
+type expenseAnomaly struct {
+	ExpenseID          int64        `json:"expense_id"`
+	RowIndex           int          `json:"row_index"`
+	Description        *string      `json:"description"`
+	Amount             models.Money `json:"amount"`
+	Currency           string       `json:"currency"`
+	AcceptedCategoryID *int64       `json:"accepted_category_id"`
+	CategoryName       *string      `json:"category_name"`
+	Reasons            []string     `json:"reasons"`
+	Score              float64      `json:"score"`
+	TypicalAmount      models.Money `json:"typical_amount"`
+}
+
+// categoryAnomaly is a category whose project total is far from the user's other projects
+type categoryAnomaly struct {
+	CategoryID         int64        `json:"category_id"`
+	CategoryName       string       `json:"category_name"`
+	Currency           string       `json:"currency"`
+	Total              models.Money `json:"total"`
+	TypicalTotal       models.Money `json:"typical_total"`
+	OtherProjectsCount int          `json:"other_projects_count"`
+	Ratio              float64      `json:"ratio"`
+}
+
+// anomalyCharge is a purchase used to build baselines
+type anomalyCharge struct {
+	ExpenseID          int64
+	ProjectID          int64
+	RowIndex           int
+	Description        *string
+	Merchant           string
+	Amount             models.Money // cost, positive
+	Currency           string
+	AcceptedCategoryID *int64
+	CategoryName       *string
+}
+
+// categoryCurrency keys baselines and totals by category and currency, since amounts in
+// different currencies are not compared
+type categoryCurrency struct {
+	CategoryID int64
+	Currency   string
+}
+
+// merchantCurrency keys baselines by merchant and currency
+type merchantCurrency struct {
+	Merchant string
+	Currency string
+}
+
+// amountBaseline is the robust centre and spread of a set of amounts
+type amountBaseline struct {
+	Median float64
+	MAD    float64
+	Count  int
+}
+
+// median returns the median of values, which must not be empty. values is sorted in place.
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// newAmountBaseline computes the median and median absolute deviation of amounts
+func newAmountBaseline(amounts []float64) amountBaseline {
+	values := append([]float64(nil), amounts...)
+	m := median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - m)
+	}
+	return amountBaseline{Median: m, MAD: median(deviations), Count: len(amounts)}
+}
+
+// score returns how unusually high amount is against the baseline as a robust z-score
+// (0.6745·(x−median)/MAD). Low amounts score 0; a cheap lunch is never a problem.
+func (b amountBaseline) score(amount float64) float64 {
+	if b.Count < anomalyMinSamples || amount <= b.Median {
+		return 0
+	}
+	// Identical charges give a MAD of 0; keep a floor so one cent over isn't an outlier
+	spread := math.Max(b.MAD, math.Max(0.1*b.Median, 1))
+	return 0.6745 * (amount - b.Median) / spread
+}
+
+// moneyFromFloat rounds a statistic such as a median back to cents
+func moneyFromFloat(amount float64) models.Money {
+	return models.Money(math.Round(amount * 100))
+}
+
+// loadAnomalyCharges reads every active purchase across the user's projects
+func loadAnomalyCharges(ctx context.Context, q dbQuerier) ([]anomalyCharge, error) {
+	rows, err := q.Query(ctx, `
+		SELECT e.id, e.project_id, e.row_index, e.description, normalize_description(e.description),
+		       -e.amount, COALESCE(e.currency, p.currency), e.accepted_category_id, ec.name
+		FROM expense e
+		JOIN project p ON e.project_id = p.id
+		LEFT JOIN expense_category ec ON e.accepted_category_id = ec.id
+		WHERE p.user_id = $1
+		  AND p.deleted_at IS NULL
+		  AND e.deleted_at IS NULL
+		  AND e.amount < 0
+		  AND e.transfer_id IS NULL
+		  AND (e.is_personal IS NULL OR e.is_personal = FALSE)
+	`, models.TEST_USER_ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var charges []anomalyCharge
+	for rows.Next() {
+		var charge anomalyCharge
+		err := rows.Scan(&charge.ExpenseID, &charge.ProjectID, &charge.RowIndex, &charge.Description,
+			&charge.Merchant, &charge.Amount, &charge.Currency, &charge.AcceptedCategoryID, &charge.CategoryName)
+		if err != nil {
+			return nil, err
+		}
+		charges = append(charges, charge)
+	}
+
+	return charges, rows.Err()
+}
+
+// findExpenseAnomalies flags the project's charges that are outliers for their accepted
+// category or their merchant. Baselines come from all of the user's projects, per currency.
+func findExpenseAnomalies(charges []anomalyCharge, projectID int64) []expenseAnomaly {
+	categoryAmounts := make(map[categoryCurrency][]float64)
+	merchantAmounts := make(map[merchantCurrency][]float64)
+	for _, charge := range charges {
+		if charge.AcceptedCategoryID != nil {
+			key := categoryCurrency{*charge.AcceptedCategoryID, charge.Currency}
+			categoryAmounts[key] = append(categoryAmounts[key], charge.Amount.Float64())
+		}
+		if charge.Merchant != "" {
+			key := merchantCurrency{charge.Merchant, charge.Currency}
+			merchantAmounts[key] = append(merchantAmounts[key], charge.Amount.Float64())
+		}
+	}
+
+	categoryBaselines := make(map[categoryCurrency]amountBaseline)
+	for key, amounts := range categoryAmounts {
+		categoryBaselines[key] = newAmountBaseline(amounts)
+	}
+	merchantBaselines := make(map[merchantCurrency]amountBaseline)
+	for key, amounts := range merchantAmounts {
+		merchantBaselines[key] = newAmountBaseline(amounts)
+	}
+
+	anomalies := []expenseAnomaly{}
+	for _, charge := range charges {
+		if charge.ProjectID != projectID {
+			continue
+		}
+
+		anomaly := expenseAnomaly{
+			ExpenseID:          charge.ExpenseID,
+			RowIndex:           charge.RowIndex,
+			Description:        charge.Description,
+			Amount:             -charge.Amount,
+			Currency:           charge.Currency,
+			AcceptedCategoryID: charge.AcceptedCategoryID,
+			CategoryName:       charge.CategoryName,
+			Reasons:            []string{},
+		}
+
+		if charge.AcceptedCategoryID != nil {
+			baseline := categoryBaselines[categoryCurrency{*charge.AcceptedCategoryID, charge.Currency}]
+			if score := baseline.score(charge.Amount.Float64()); score > anomalyScoreThreshold {
+				anomaly.Reasons = append(anomaly.Reasons, "category")
+				anomaly.Score = score
+				anomaly.TypicalAmount = -moneyFromFloat(baseline.Median)
+			}
+		}
+		if charge.Merchant != "" {
+			baseline := merchantBaselines[merchantCurrency{charge.Merchant, charge.Currency}]
+			if score := baseline.score(charge.Amount.Float64()); score > anomalyScoreThreshold {
+				anomaly.Reasons = append(anomaly.Reasons, "merchant")
+				if score > anomaly.Score {
+					anomaly.Score = score
+					anomaly.TypicalAmount = -moneyFromFloat(baseline.Median)
+				}
+			}
+		}
+
+		if len(anomaly.Reasons) > 0 {
+			anomaly.Score = math.Round(anomaly.Score*100) / 100
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool { return anomalies[i].Score > anomalies[j].Score })
+	return anomalies
+}
+
+// findCategoryAnomalies flags categories whose total in the project is far above or below
+// the median of the same category's totals in the user's other projects. Totals in each
+// currency are compared separately.
+func findCategoryAnomalies(charges []anomalyCharge, projectID int64) []categoryAnomaly {
+	totals := make(map[categoryCurrency]map[int64]models.Money) // category and currency → project → total cost
+	names := make(map[int64]string)
+	for _, charge := range charges {
+		if charge.AcceptedCategoryID == nil {
+			continue
+		}
+		key := categoryCurrency{*charge.AcceptedCategoryID, charge.Currency}
+		if totals[key] == nil {
+			totals[key] = make(map[int64]models.Money)
+		}
+		totals[key][charge.ProjectID] += charge.Amount
+		if charge.CategoryName != nil {
+			names[key.CategoryID] = *charge.CategoryName
+		}
+	}
+
+	anomalies := []categoryAnomaly{}
+	for key, byProject := range totals {
+		total, ok := byProject[projectID]
+		if !ok {
+			continue
+		}
+
+		var others []float64
+		for otherProjectID, otherTotal := range byProject {
+			if otherProjectID != projectID {
+				others = append(others, otherTotal.Float64())
+			}
+		}
+		if len(others) < categoryMinOtherProjects {
+			continue
+		}
+
+		typical := median(others)
+		if typical <= 0 {
+			continue
+		}
+		ratio := total.Float64() / typical
+		if ratio < categoryDeviationRatio && ratio > 1/categoryDeviationRatio {
+			continue
+		}
+
+		anomalies = append(anomalies, categoryAnomaly{
+			CategoryID:         key.CategoryID,
+			CategoryName:       names[key.CategoryID],
+			Currency:           key.Currency,
+			Total:              -total,
+			TypicalTotal:       -moneyFromFloat(typical),
+			OtherProjectsCount: len(others),
+			Ratio:              math.Round(ratio*100) / 100,
+		})
+	}
+
+	// Largest deviation first, in either direction
+	deviation := func(ratio float64) float64 { return math.Abs(math.Log(ratio)) }
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return deviation(anomalies[i].Ratio) > deviation(anomalies[j].Ratio)
+	})
+	return anomalies
+}
+
+// GetProjectAnomalies returns the review list of unusual charges and category totals
+func GetProjectAnomalies(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	charges, err := loadAnomalyCharges(ctx, database.Pool)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	expenses := findExpenseAnomalies(charges, projectID)
+	categories := findCategoryAnomalies(charges, projectID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"expenses":   expenses,
+		"categories": categories,
+		"count":      len(expenses) + len(categories),
+	})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"testing"
+
+	"ookkee/models"
+)
+
+func anomalyTestCharge(id, projectID, categoryID int64, merchant, currency string, cents int64) anomalyCharge {
+	charge := anomalyCharge{ExpenseID: id, ProjectID: projectID, Merchant: merchant, Currency: currency,
+		Amount: models.MoneyFromCents(cents)}
+	if categoryID != 0 {
+		charge.AcceptedCategoryID = &categoryID
+	}
+	return charge
+}
+
+func TestAmountBaseline(t *testing.T) {
+	tests := []struct {
+		name    string
+		amounts []float64
+		median  float64
+		mad     float64
+	}{
+		{"odd count", []float64{100, 1, 3, 2, 4}, 3, 1},
+		{"even count", []float64{1, 2, 3, 4}, 2.5, 1},
+		{"identical", []float64{10, 10, 10}, 10, 0},
+	}
+	for _, tt := range tests {
+		amounts := append([]float64(nil), tt.amounts...)
+		baseline := newAmountBaseline(amounts)
+		if baseline.Median != tt.median || baseline.MAD != tt.mad || baseline.Count != len(tt.amounts) {
+			t.Errorf("%s: baseline = %+v, want median %v, MAD %v", tt.name, baseline, tt.median, tt.mad)
+		}
+		if amounts[0] != tt.amounts[0] {
+			t.Errorf("%s: newAmountBaseline reordered its input", tt.name)
+		}
+	}
+}
+
+func TestAmountBaselineScore(t *testing.T) {
+	flat := amountBaseline{Median: 10, MAD: 0, Count: anomalyMinSamples}
+	spread := amountBaseline{Median: 100, MAD: 20, Count: 10}
+
+	tests := []struct {
+		name     string
+		baseline amountBaseline
+		amount   float64
+		flagged  bool
+	}{
+		{"too few samples", amountBaseline{Median: 10, MAD: 0, Count: anomalyMinSamples - 1}, 1000, false},
+		{"below the median", spread, 5, false},
+		// A MAD of 0 falls back to a spread of 1: 0.6745·5 = 3.37, 0.6745·6 = 4.05
+		{"just under the threshold", flat, 15, false},
+		{"just over the threshold", flat, 16, true},
+		// 0.6745·(x−100)/20 crosses 3.5 at about 203.8
+		{"under with a spread", spread, 203, false},
+		{"over with a spread", spread, 204, true},
+	}
+	for _, tt := range tests {
+		score := tt.baseline.score(tt.amount)
+		if flagged := score > anomalyScoreThreshold; flagged != tt.flagged {
+			t.Errorf("%s: score(%v) = %v, flagged %v, want %v", tt.name, tt.amount, score, flagged, tt.flagged)
+		}
+	}
+}
+
+func TestFindExpenseAnomalies(t *testing.T) {
+	var charges []anomalyCharge
+	for i := int64(1); i <= 5; i++ {
+		charges = append(charges,
+			anomalyTestCharge(i, 2, 1, "", "USD", 1000),
+			anomalyTestCharge(10+i, 2, 0, "acme", "USD", 2000))
+	}
+	charges = append(charges,
+		anomalyTestCharge(21, 1, 1, "", "USD", 1600),     // outlier for category 1
+		anomalyTestCharge(22, 1, 1, "", "USD", 1500),     // within the spread
+		anomalyTestCharge(23, 1, 1, "", "EUR", 10000),    // no EUR baseline
+		anomalyTestCharge(24, 1, 0, "acme", "USD", 6000), // outlier for the merchant
+		anomalyTestCharge(25, 3, 1, "", "USD", 9000))     // another project's charge
+
+	anomalies := findExpenseAnomalies(charges, 1)
+	if len(anomalies) != 2 {
+		t.Fatalf("found %d anomalies, want 2: %+v", len(anomalies), anomalies)
+	}
+
+	merchant, category := anomalies[0], anomalies[1]
+	if merchant.ExpenseID != 24 || len(merchant.Reasons) != 1 || merchant.Reasons[0] != "merchant" ||
+		merchant.Amount != models.MoneyFromCents(-6000) || merchant.TypicalAmount != models.MoneyFromCents(-2000) {
+		t.Errorf("merchant anomaly = %+v", merchant)
+	}
+	if category.ExpenseID != 21 || len(category.Reasons) != 1 || category.Reasons[0] != "category" ||
+		category.Score != 4.05 || category.TypicalAmount != models.MoneyFromCents(-1000) || category.Currency != "USD" {
+		t.Errorf("category anomaly = %+v", category)
+	}
+}
+
+func TestFindCategoryAnomalies(t *testing.T) {
+	charges := []anomalyCharge{
+		// category 1: three times the other projects
+		anomalyTestCharge(1, 1, 1, "", "USD", 30000),
+		anomalyTestCharge(2, 2, 1, "", "USD", 10000),
+		anomalyTestCharge(3, 3, 1, "", "USD", 10000),
+		// category 2: just under three times
+		anomalyTestCharge(4, 1, 2, "", "USD", 29900),
+		anomalyTestCharge(5, 2, 2, "", "USD", 10000),
+		anomalyTestCharge(6, 3, 2, "", "USD", 10000),
+		// category 3: under a third
+		anomalyTestCharge(7, 1, 3, "", "USD", 3000),
+		anomalyTestCharge(8, 2, 3, "", "USD", 10000),
+		anomalyTestCharge(9, 3, 3, "", "USD", 10000),
+		// category 4: only one other project
+		anomalyTestCharge(10, 1, 4, "", "USD", 90000),
+		anomalyTestCharge(11, 2, 4, "", "USD", 10000),
+		// category 1 in EUR is not compared with the USD totals
+		anomalyTestCharge(12, 1, 1, "", "EUR", 90000),
+	}
+
+	anomalies := findCategoryAnomalies(charges, 1)
+	if len(anomalies) != 2 {
+		t.Fatalf("found %d anomalies, want 2: %+v", len(anomalies), anomalies)
+	}
+
+	// A third is a larger deviation than three times
+	low, high := anomalies[0], anomalies[1]
+	if low.CategoryID != 3 || low.Ratio != 0.3 || low.TypicalTotal != models.MoneyFromCents(-10000) {
+		t.Errorf("low anomaly = %+v", low)
+	}
+	if high.CategoryID != 1 || high.Currency != "USD" || high.Ratio != 3 || high.Total != models.MoneyFromCents(-30000) ||
+		high.OtherProjectsCount != 2 {
+		t.Errorf("high anomaly = %+v", high)
+	}
+}
@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// budgetSelect reads category_budget rows (b) with the budgeted category's path
+const budgetSelect = `
+	SELECT b.id, b.category_id,
+	       (WITH RECURSIVE up AS (
+	          SELECT c.name, c.parent_id, 0 AS depth FROM expense_category c WHERE c.id = b.category_id
+	          UNION ALL
+	          SELECT c.name, c.parent_id, up.depth + 1 FROM expense_category c JOIN up ON c.id = up.parent_id
+	        ) SELECT string_agg(name, $2 ORDER BY depth DESC) FROM up) AS category_path,
+	       b.project_id, b.period, b.amount, b.currency, b.created_at, b.updated_at
+	FROM category_budget b`
+
+// budgetStatus is a budget's standing in the period containing the report date. Spent is
+// the business-use spend in the category and its subcategories, as in the totals, from the
+// start of the period through the report date.
+type budgetStatus struct {
+	models.CategoryBudget
+	PeriodStart      string       `json:"period_start"`
+	PeriodEnd        string       `json:"period_end"`
+	Spent            models.Money `json:"spent"`
+	Remaining        models.Money `json:"remaining"` // negative when over budget
+	PercentUsed      float64      `json:"percent_used"`
+	Forecast         models.Money `json:"forecast"`         // spend at the period's end if the pace so far holds
+	ForecastOverrun  models.Money `json:"forecast_overrun"` // how far Forecast exceeds the budget, 0 when within
+	OverBudget       bool         `json:"over_budget"`
+	UnconvertedCount int          `json:"unconverted_count"`
+}
+
+// scanBudget scans a row read with budgetSelect
+func scanBudget(row pgx.Row, budget *models.CategoryBudget) error {
+	return row.Scan(&budget.ID, &budget.CategoryID, &budget.CategoryPath, &budget.ProjectID, &budget.Period,
+		&budget.Amount, &budget.Currency, &budget.CreatedAt, &budget.UpdatedAt)
+}
+
+// loadBudgets reads the budgets of one scope: a project's, or with projectID nil the
+// user-wide ones
+func loadBudgets(ctx context.Context, q dbQuerier, projectID *int64) ([]models.CategoryBudget, error) {
+	rows, err := q.Query(ctx, budgetSelect+`
+		WHERE b.user_id = $1 AND b.project_id IS NOT DISTINCT FROM $3
+		ORDER BY category_path ASC, b.period DESC
+	`, models.TEST_USER_ID, categoryPathSeparator, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []models.CategoryBudget{}
+	for rows.Next() {
+		var budget models.CategoryBudget
+		if err := scanBudget(rows, &budget); err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, budget)
+	}
+	return budgets, rows.Err()
+}
+
+// loadBudget reads one of the user's budgets
+func loadBudget(ctx context.Context, q dbQuerier, budgetID int64) (models.CategoryBudget, error) {
+	var budget models.CategoryBudget
+	err := scanBudget(q.QueryRow(ctx, budgetSelect+`
+		WHERE b.user_id = $1 AND b.id = $3
+	`, models.TEST_USER_ID, categoryPathSeparator, budgetID), &budget)
+	return budget, err
+}
+
+// budgetPeriod returns the first and last day of the calendar month or year containing date
+func budgetPeriod(period string, date time.Time) (time.Time, time.Time) {
+	if period == models.BudgetAnnual {
+		start := time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(1, 0, -1)
+	}
+	start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, -1)
+}
+
+// newBudgetStatus works out where a budget stands on asOf given what was spent so far, as a
+// positive amount (refunds can make it negative). The forecast extends the daily pace from
+// the period start to the whole period.
+func newBudgetStatus(budget models.CategoryBudget, spent models.Money, asOf time.Time) budgetStatus {
+	start, end := budgetPeriod(budget.Period, asOf)
+	elapsedDays := int(asOf.Sub(start).Hours()/24) + 1
+	periodDays := int(end.Sub(start).Hours()/24) + 1
+
+	status := budgetStatus{
+		CategoryBudget: budget,
+		PeriodStart:    start.Format("2006-01-02"),
+		PeriodEnd:      end.Format("2006-01-02"),
+		Spent:          spent,
+		Remaining:      budget.Amount - spent,
+		PercentUsed:    math.Round(float64(spent)/float64(budget.Amount)*1000) / 10,
+		Forecast:       models.Money(math.Round(float64(spent) * float64(periodDays) / float64(elapsedDays))),
+		OverBudget:     spent > budget.Amount,
+	}
+	if status.Forecast > budget.Amount {
+		status.ForecastOverrun = status.Forecast - budget.Amount
+	}
+	return status
+}
+
+// indexCategoryTotals maps every category in a totals tree to its totals
+func indexCategoryTotals(totals []*categoryTotal, index map[int64]*categoryTotal) {
+	for _, total := range totals {
+		index[total.CategoryID] = total
+		indexCategoryTotals(total.Children, index)
+	}
+}
+
+// categorySpend returns the business-use spend in a category and its subcategories as a
+// positive amount (charges are stored negative), and the rows that could not be converted
+func categorySpend(index map[int64]*categoryTotal, categoryID int64) (models.Money, int) {
+	total, ok := index[categoryID]
+	if !ok {
+		return 0, 0
+	}
+	return -total.DeductibleAmount, total.UnconvertedCount
+}
+
+// buildBudgetReport compares each budget in scope with spending in its period up to asOf.
+// Spending is converted to each budget's currency; period filters to monthly or annual
+// budgets when set.
+func buildBudgetReport(ctx context.Context, projectID *int64, period string, asOf time.Time) ([]budgetStatus, error) {
+	budgets, err := loadBudgets(ctx, database.Pool, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := categoryTotalsScope{To: &asOf}
+	if projectID != nil {
+		scope.ProjectID = strconv.FormatInt(*projectID, 10)
+	}
+
+	// Budgets sharing a currency and period share one totals query
+	totalsByKey := make(map[string]map[int64]*categoryTotal)
+	report := []budgetStatus{}
+	for _, budget := range budgets {
+		if period != "" && budget.Period != period {
+			continue
+		}
+
+		start, _ := budgetPeriod(budget.Period, asOf)
+		key := budget.Currency + "/" + budget.Period
+		index, ok := totalsByKey[key]
+		if !ok {
+			scope.From = &start
+			totals, err := loadCategoryTotals(ctx, scope, budget.Currency)
+			if err != nil {
+				return nil, err
+			}
+			index = make(map[int64]*categoryTotal)
+			indexCategoryTotals(totals, index)
+			totalsByKey[key] = index
+		}
+
+		spent, unconverted := categorySpend(index, budget.CategoryID)
+		status := newBudgetStatus(budget, spent, asOf)
+		status.UnconvertedCount = unconverted
+		report = append(report, status)
+	}
+	return report, nil
+}
+
+// mergeCategoryBudgets moves a merged-away category's budgets to the target category. A
+// budget the target already has for the same scope and period absorbs the source's amount
+// when the currencies match; otherwise the target's budget is kept and the source's is
+// dropped. Returns how many budgets were moved, combined and dropped.
+func mergeCategoryBudgets(ctx context.Context, tx pgx.Tx, targetID, sourceID int64) (int, int, int, error) {
+	combined, err := tx.Exec(ctx, `
+		UPDATE category_budget t
+		SET amount = t.amount + s.amount, updated_at = NOW()
+		FROM category_budget s
+		WHERE s.category_id = $2 AND t.category_id = $1
+		  AND COALESCE(t.project_id, 0) = COALESCE(s.project_id, 0)
+		  AND t.period = s.period AND t.currency = s.currency
+	`, targetID, sourceID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	removed, err := tx.Exec(ctx, `
+		DELETE FROM category_budget s
+		WHERE s.category_id = $2
+		  AND EXISTS (
+			SELECT 1 FROM category_budget t
+			WHERE t.category_id = $1
+			  AND COALESCE(t.project_id, 0) = COALESCE(s.project_id, 0)
+			  AND t.period = s.period
+		  )
+	`, targetID, sourceID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	moved, err := tx.Exec(ctx, `
+		UPDATE category_budget SET category_id = $1, updated_at = NOW()
+		WHERE category_id = $2
+	`, targetID, sourceID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	dropped := int(removed.RowsAffected() - combined.RowsAffected())
+	return int(moved.RowsAffected()), int(combined.RowsAffected()), dropped, nil
+}
+
+// GetBudgets lists the user-wide budgets, or with project_id a project's budgets
+func GetBudgets(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := categoryListParam(w, r)
+	if !ok {
+		return
+	}
+
+	budgets, err := loadBudgets(r.Context(), database.Pool, projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch budgets: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(budgets)
+}
+
+// CreateBudget adds a monthly or annual budget for a category, in a project (project_id)
+// or across all projects. The currency defaults to the project's, or USD for user-wide
+// budgets.
+func CreateBudget(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		CategoryID int64        `json:"category_id"`
+		ProjectID  *int64       `json:"project_id"`
+		Period     string       `json:"period"`
+		Amount     models.Money `json:"amount"`
+		Currency   string       `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Period != models.BudgetMonthly && req.Period != models.BudgetAnnual {
+		http.Error(w, "period must be monthly or annual", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 {
+		http.Error(w, "amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	currency := defaultCurrency
+	if req.ProjectID != nil {
+		err := database.Pool.QueryRow(ctx, `
+			SELECT currency FROM project WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		`, *req.ProjectID, models.TEST_USER_ID).Scan(&currency)
+		if err == pgx.ErrNoRows {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.Currency != "" {
+		var err error
+		if currency, err = normalizeCurrency(req.Currency); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := checkScopeCategory(ctx, database.Pool, req.ProjectID, req.CategoryID)
+	if err == errCategoryNotInProject {
+		http.Error(w, "Category is not in the budget's category list", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var exists bool
+	err = database.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM category_budget
+			WHERE category_id = $1 AND project_id IS NOT DISTINCT FROM $2 AND period = $3
+		)
+	`, req.CategoryID, req.ProjectID, req.Period).Scan(&exists)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check budgets: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, fmt.Sprintf("The category already has a %s budget here", req.Period), http.StatusConflict)
+		return
+	}
+
+	var budgetID int64
+	err = database.Pool.QueryRow(ctx, `
+		INSERT INTO category_budget (user_id, category_id, project_id, period, amount, currency)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, models.TEST_USER_ID, req.CategoryID, req.ProjectID, req.Period, req.Amount, currency).Scan(&budgetID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create budget: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	budget, err := loadBudget(ctx, database.Pool, budgetID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get budget: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(budget)
+}
+
+// UpdateBudget changes a budget's amount and/or currency
+func UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	budgetID, err := strconv.ParseInt(chi.URLParam(r, "budgetID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid budget ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Amount   *models.Money `json:"amount"`
+		Currency *string       `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount != nil && *req.Amount <= 0 {
+		http.Error(w, "amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+	if req.Currency != nil {
+		currency, err := normalizeCurrency(*req.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Currency = &currency
+	}
+
+	tag, err := database.Pool.Exec(ctx, `
+		UPDATE category_budget
+		SET amount = COALESCE($3, amount), currency = COALESCE($4, currency), updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+	`, budgetID, models.TEST_USER_ID, req.Amount, req.Currency)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update budget: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Budget not found", http.StatusNotFound)
+		return
+	}
+
+	budget, err := loadBudget(ctx, database.Pool, budgetID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get budget: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(budget)
+}
+
+// DeleteBudget removes a budget
+func DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	budgetID, err := strconv.ParseInt(chi.URLParam(r, "budgetID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid budget ID", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := database.Pool.Exec(ctx, `
+		DELETE FROM category_budget WHERE id = $1 AND user_id = $2
+	`, budgetID, models.TEST_USER_ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete budget: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Budget not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Budget deleted successfully"}`))
+}
+
+// GetBudgetReport compares the user-wide budgets with spending across all projects
+func GetBudgetReport(w http.ResponseWriter, r *http.Request) {
+	writeBudgetReport(w, r, nil)
+}
+
+// GetProjectBudgetReport compares a project's budgets with its spending
+func GetProjectBudgetReport(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = database.Pool.QueryRow(r.Context(), `
+		SELECT EXISTS (SELECT 1 FROM project WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, projectID, models.TEST_USER_ID).Scan(&exists)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	writeBudgetReport(w, r, &projectID)
+}
+
+// writeBudgetReport responds with budget-vs-actual for the scope. The optional date
+// parameter picks the report date (default today) and period limits the report to
+// monthly or annual budgets.
+func writeBudgetReport(w http.ResponseWriter, r *http.Request, projectID *int64) {
+	ctx := r.Context()
+
+	now := time.Now()
+	asOf := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if value := r.URL.Query().Get("date"); value != "" {
+		date, err := parseRateDate(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid date: %s", value), http.StatusBadRequest)
+			return
+		}
+		asOf = date
+	}
+
+	period := r.URL.Query().Get("period")
+	if period != "" && period != models.BudgetMonthly && period != models.BudgetAnnual {
+		http.Error(w, "period must be monthly or annual", http.StatusBadRequest)
+		return
+	}
+
+	report, err := buildBudgetReport(ctx, projectID, period, asOf)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build budget report: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	overCount := 0
+	for _, status := range report {
+		if status.OverBudget {
+			overCount++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"as_of":      asOf.Format("2006-01-02"),
+		"budgets":    report,
+		"count":      len(report),
+		"over_count": overCount,
+	})
+}
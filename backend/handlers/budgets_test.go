@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"ookkee/models"
+)
+
+func TestNewBudgetStatus(t *testing.T) {
+	budget := models.CategoryBudget{Period: models.BudgetMonthly, Amount: models.MoneyFromCents(100000)}
+	asOf := time.Date(2024, time.April, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		spent          models.Money
+		wantRemaining  models.Money
+		wantPercent    float64
+		wantForecast   models.Money
+		wantOverrun    models.Money
+		wantOverBudget bool
+	}{
+		// 10 of 30 days: a third of the budget is on pace
+		{"on pace", models.MoneyFromCents(33000), models.MoneyFromCents(67000), 33, models.MoneyFromCents(99000), 0, false},
+		{"forecast overrun", models.MoneyFromCents(50000), models.MoneyFromCents(50000), 50, models.MoneyFromCents(150000),
+			models.MoneyFromCents(50000), false},
+		{"over budget", models.MoneyFromCents(120000), models.MoneyFromCents(-20000), 120, models.MoneyFromCents(360000),
+			models.MoneyFromCents(260000), true},
+		{"nothing spent", 0, models.MoneyFromCents(100000), 0, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		status := newBudgetStatus(budget, tt.spent, asOf)
+		if status.PeriodStart != "2024-04-01" || status.PeriodEnd != "2024-04-30" {
+			t.Errorf("%s: period = %s to %s", tt.name, status.PeriodStart, status.PeriodEnd)
+		}
+		if status.Remaining != tt.wantRemaining || status.PercentUsed != tt.wantPercent ||
+			status.Forecast != tt.wantForecast || status.ForecastOverrun != tt.wantOverrun || status.OverBudget != tt.wantOverBudget {
+			t.Errorf("%s: remaining %v, percent %v, forecast %v, overrun %v, over %v", tt.name, status.Remaining,
+				status.PercentUsed, status.Forecast, status.ForecastOverrun, status.OverBudget)
+		}
+	}
+}
+
+func TestBudgetSpendFromCharges(t *testing.T) {
+	index := map[int64]*categoryTotal{
+		7: {CategoryID: 7, TotalAmount: models.MoneyFromCents(-60000), DeductibleAmount: models.MoneyFromCents(-45000),
+			PersonalAmount: models.MoneyFromCents(-15000), UnconvertedCount: 2},
+	}
+
+	spent, unconverted := categorySpend(index, 7)
+	if spent != models.MoneyFromCents(45000) || unconverted != 2 {
+		t.Fatalf("categorySpend = %v, %d, want 450.00, 2", spent, unconverted)
+	}
+	if spent, _ := categorySpend(index, 8); spent != 0 {
+		t.Errorf("categorySpend of a category without rows = %v, want 0", spent)
+	}
+
+	budget := models.CategoryBudget{Period: models.BudgetAnnual, Amount: models.MoneyFromCents(40000)}
+	status := newBudgetStatus(budget, spent, time.Date(2024, time.December, 31, 0, 0, 0, 0, time.UTC))
+	if !status.OverBudget || status.Remaining != models.MoneyFromCents(-5000) || status.PercentUsed != 112.5 {
+		t.Errorf("remaining %v, percent %v, over %v", status.Remaining, status.PercentUsed, status.OverBudget)
+	}
+}
@@ -1,24 +1,247 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"ookkee/database"
 	"ookkee/models"
 )
 
+// categoryTreeCTE walks the user's ($1) active categories from the top level down: the
+// defaults when $2 is NULL, otherwise project $2's list (its own categories, then the
+// inherited defaults). Each row has the category id, its depth and a path of (sort_order, id)
+// pairs; ordering by path lists parents before their children, siblings in sort order.
+const categoryTreeCTE = `
+	WITH RECURSIVE category_tree AS (
+		SELECT id, 0 AS depth, ARRAY[(project_id IS NULL)::int::bigint, sort_order::bigint, id] AS path
+		FROM expense_category
+		WHERE user_id = $1 AND deleted_at IS NULL AND parent_id IS NULL
+		  AND (($2::bigint IS NULL AND project_id IS NULL)
+		       OR id IN (SELECT id FROM project_categories($2::bigint)))
+		UNION ALL
+		SELECT c.id, t.depth + 1, t.path || ARRAY[c.sort_order::bigint, c.id]
+		FROM expense_category c
+		JOIN category_tree t ON c.parent_id = t.id
+		WHERE c.deleted_at IS NULL
+	)`
+
+// errInvalidParent is returned when a parent category doesn't exist or would create a cycle
+var errInvalidParent = fmt.Errorf("invalid parent category")
+
+// checkCategoryParent verifies parentID can hold categoryID as a child: the parent must be
+// an active category of the user in the same list (projectID, nil for the defaults) and not
+// categoryID itself or one of its descendants. categoryID is 0 for a new category.
+func checkCategoryParent(ctx context.Context, q dbQuerier, categoryID, parentID int64, projectID *int64) error {
+	var ok bool
+	err := q.QueryRow(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM expense_category
+			WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+			  AND project_id IS NOT DISTINCT FROM $4
+			UNION ALL
+			SELECT c.id, c.parent_id FROM expense_category c
+			JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $1)
+		   AND NOT EXISTS (SELECT 1 FROM ancestors WHERE id = $3)
+	`, parentID, models.TEST_USER_ID, categoryID, projectID).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidParent
+	}
+	return nil
+}
+
+// Siblings share a parent and a list: projectID is the owning project, nil for the user's
+// defaults. Subcategories always belong to their parent's list.
+
+// nextSiblingSortOrder returns the sort_order that places a category last under parentID
+func nextSiblingSortOrder(ctx context.Context, q dbQuerier, parentID, projectID *int64) (int, error) {
+	var maxSortOrder int
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE(MAX(sort_order), 0)
+		FROM expense_category
+		WHERE user_id = $1 AND deleted_at IS NULL AND parent_id IS NOT DISTINCT FROM $2
+		  AND project_id IS NOT DISTINCT FROM $3
+	`, models.TEST_USER_ID, parentID, projectID).Scan(&maxSortOrder)
+	return maxSortOrder + 1, err
+}
+
+// closeSiblingGap renumbers the siblings after a category that left parentID
+func closeSiblingGap(ctx context.Context, tx pgx.Tx, parentID, projectID *int64, sortOrder int) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE expense_category
+		SET sort_order = sort_order - 1
+		WHERE user_id = $1 AND deleted_at IS NULL
+		  AND parent_id IS NOT DISTINCT FROM $2
+		  AND project_id IS NOT DISTINCT FROM $3
+		  AND sort_order > $4
+	`, models.TEST_USER_ID, parentID, projectID, sortOrder)
+	return err
+}
+
+// hotkeyHolder returns the name of another active category that a category in projectID's
+// list (nil for the defaults) would share hotkey with, or "" when the hotkey is free. A
+// project that inherits the defaults shows both lists, so its own hotkeys must not clash with
+// the defaults', and a default's must not clash with any inheriting project's. categoryID is
+// 0 for a new category.
+func hotkeyHolder(ctx context.Context, q dbQuerier, projectID *int64, categoryID int64, hotkey string) (string, error) {
+	var name string
+	err := q.QueryRow(ctx, `
+		SELECT c.name
+		FROM expense_category c
+		WHERE c.user_id = $1 AND c.deleted_at IS NULL AND c.hotkey = $2 AND c.id <> $3
+		  AND (c.project_id IS NOT DISTINCT FROM $4::bigint
+		       OR ($4::bigint IS NOT NULL AND c.project_id IS NULL
+		           AND EXISTS (SELECT 1 FROM project p WHERE p.id = $4::bigint AND p.inherit_categories))
+		       OR ($4::bigint IS NULL
+		           AND EXISTS (SELECT 1 FROM project p
+		                       WHERE p.id = c.project_id AND p.inherit_categories AND p.deleted_at IS NULL)))
+		LIMIT 1
+	`, models.TEST_USER_ID, hotkey, categoryID, projectID).Scan(&name)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+// inheritedHotkeyClash finds a hotkey that a project's own categories share with the user's
+// defaults, which would clash once the project inherits them. Returns "" when there is none.
+func inheritedHotkeyClash(ctx context.Context, q dbQuerier, projectID int64) (string, error) {
+	var clash string
+	err := q.QueryRow(ctx, `
+		SELECT format('hotkey %s is used by both %s and %s', own.hotkey, own.name, def.name)
+		FROM expense_category own
+		JOIN expense_category def
+		  ON def.user_id = own.user_id AND def.hotkey = own.hotkey
+		 AND def.project_id IS NULL AND def.deleted_at IS NULL
+		WHERE own.project_id = $1 AND own.user_id = $2 AND own.deleted_at IS NULL
+		LIMIT 1
+	`, projectID, models.TEST_USER_ID).Scan(&clash)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return clash, err
+}
+
+// errCategoryNotInProject is returned when an expense is given a category outside its
+// project's list
+var errCategoryNotInProject = fmt.Errorf("category is not in the project's category list")
+
+// checkProjectCategory verifies categoryID is an active category in projectID's list
+func checkProjectCategory(ctx context.Context, q dbQuerier, projectID, categoryID int64) error {
+	var ok bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM project_categories($1) WHERE id = $2)
+	`, projectID, categoryID).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCategoryNotInProject
+	}
+	return nil
+}
+
+// checkScopeCategory checks that a category can be used by something scoped to a project
+// (projectID) or to all projects (nil): a category in the project's list, or one of the
+// user's defaults. It returns errCategoryNotInProject otherwise.
+func checkScopeCategory(ctx context.Context, q dbQuerier, projectID *int64, categoryID int64) error {
+	if projectID != nil {
+		return checkProjectCategory(ctx, q, *projectID, categoryID)
+	}
+	listID, err := categoryProjectID(ctx, q, categoryID)
+	if err == pgx.ErrNoRows || (err == nil && listID != nil) {
+		return errCategoryNotInProject
+	}
+	return err
+}
+
+// categoryProjectID reads a category's list: its project, or nil for the user's defaults
+func categoryProjectID(ctx context.Context, q dbQuerier, categoryID int64) (*int64, error) {
+	var projectID *int64
+	err := q.QueryRow(ctx, `
+		SELECT project_id FROM expense_category
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, categoryID, models.TEST_USER_ID).Scan(&projectID)
+	return projectID, err
+}
+
+// categoryListParam reads the optional project_id query parameter that selects a project's
+// category list; nil means the user's defaults. It writes an error response on failure.
+func categoryListParam(w http.ResponseWriter, r *http.Request) (*int64, bool) {
+	value := r.URL.Query().Get("project_id")
+	if value == "" {
+		return nil, true
+	}
+	projectID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return nil, false
+	}
+	err = database.Pool.QueryRow(r.Context(), `
+		SELECT id FROM project WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, projectID, models.TEST_USER_ID).Scan(&projectID)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	return &projectID, true
+}
+
+// maxCategoryExamples caps the pinned examples per category, which all go into AI prompts
+const maxCategoryExamples = 20
+
+// normalizeCategoryExamples trims pinned example descriptions and drops blanks and
+// case-insensitive duplicates
+func normalizeCategoryExamples(examples []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, example := range examples {
+		example = strings.TrimSpace(example)
+		key := strings.ToLower(example)
+		if example == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, example)
+	}
+	if len(normalized) > maxCategoryExamples {
+		return nil, fmt.Errorf("a category can have at most %d examples", maxCategoryExamples)
+	}
+	return normalized, nil
+}
+
+// GetCategories lists the user's default categories, or with project_id the project's
+// effective list: its own categories followed by the inherited defaults.
 func GetCategories(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	rows, err := database.Pool.Query(ctx, `
-		SELECT id, name, hotkey, sort_order, created_at 
-		FROM expense_category 
-		WHERE user_id = $1 AND deleted_at IS NULL 
-		ORDER BY sort_order ASC
-	`, models.TEST_USER_ID)
+	projectID, ok := categoryListParam(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := database.Pool.Query(ctx, categoryTreeCTE+`
+		SELECT ec.id, ec.name, ec.description, ec.include_guidance, ec.exclude_guidance, ec.examples, ec.hotkey, ec.project_id,
+		       ec.parent_id, t.depth, ec.sort_order, ec.default_business_pct, ec.tax_line_id, ec.created_at
+		FROM expense_category ec
+		JOIN category_tree t ON ec.id = t.id
+		ORDER BY t.path ASC
+	`, models.TEST_USER_ID, projectID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to fetch categories: %v", err), http.StatusInternalServerError)
 		return
@@ -28,7 +251,8 @@ func GetCategories(w http.ResponseWriter, r *http.Request) {
 	var categories []models.Category
 	for rows.Next() {
 		var category models.Category
-		err := rows.Scan(&category.ID, &category.Name, &category.Hotkey, &category.SortOrder, &category.CreatedAt)
+		err := rows.Scan(&category.ID, &category.Name, &category.Description, &category.IncludeGuidance, &category.ExcludeGuidance,
+			&category.Examples, &category.Hotkey, &category.ProjectID, &category.ParentID, &category.Depth, &category.SortOrder, &category.DefaultBusinessPct, &category.TaxLineID, &category.CreatedAt)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to scan category: %v", err), http.StatusInternalServerError)
 			return
@@ -40,12 +264,21 @@ func GetCategories(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(categories)
 }
 
+// CreateCategory adds a category to the user's defaults, or to a project's own list when
+// project_id is set. A subcategory belongs to its parent's list.
 func CreateCategory(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	var requestData struct {
-		Name   string  `json:"name"`
-		Hotkey *string `json:"hotkey"`
+		Name               string   `json:"name"`
+		Description        *string  `json:"description"`
+		IncludeGuidance    *string  `json:"include_guidance"`
+		ExcludeGuidance    *string  `json:"exclude_guidance"`
+		Examples           []string `json:"examples"`
+		Hotkey             *string  `json:"hotkey"`
+		ProjectID          *int64   `json:"project_id"`
+		ParentID           *int64   `json:"parent_id"`
+		DefaultBusinessPct *int     `json:"default_business_pct"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
@@ -58,13 +291,56 @@ func CreateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the highest sort_order to append new category at the end
-	var maxSortOrder int
-	err := database.Pool.QueryRow(ctx, `
-		SELECT COALESCE(MAX(sort_order), 0) 
-		FROM expense_category 
-		WHERE user_id = $1 AND deleted_at IS NULL
-	`, models.TEST_USER_ID).Scan(&maxSortOrder)
+	if requestData.DefaultBusinessPct != nil && (*requestData.DefaultBusinessPct < 0 || *requestData.DefaultBusinessPct > 100) {
+		http.Error(w, "default_business_pct must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+
+	examples, err := normalizeCategoryExamples(requestData.Examples)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if requestData.ProjectID != nil {
+		err := database.Pool.QueryRow(ctx, `
+			SELECT id FROM project WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		`, *requestData.ProjectID, models.TEST_USER_ID).Scan(requestData.ProjectID)
+		if err == pgx.ErrNoRows {
+			http.Error(w, "Project not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if requestData.ParentID != nil {
+		if err := checkCategoryParent(ctx, database.Pool, 0, *requestData.ParentID, requestData.ProjectID); err != nil {
+			if err == errInvalidParent {
+				http.Error(w, "Parent category not found in this category list", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to check parent category: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if requestData.Hotkey != nil {
+		holder, err := hotkeyHolder(ctx, database.Pool, requestData.ProjectID, 0, *requestData.Hotkey)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check hotkey: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if holder != "" {
+			http.Error(w, fmt.Sprintf("Hotkey %s is already used by %s", *requestData.Hotkey, holder), http.StatusConflict)
+			return
+		}
+	}
+
+	// Append the new category at the end of its siblings
+	sortOrder, err := nextSiblingSortOrder(ctx, database.Pool, requestData.ParentID, requestData.ProjectID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get max sort order: %v", err), http.StatusInternalServerError)
 		return
@@ -73,11 +349,17 @@ func CreateCategory(w http.ResponseWriter, r *http.Request) {
 	// Insert new category
 	var newCategory models.Category
 	err = database.Pool.QueryRow(ctx, `
-		INSERT INTO expense_category (user_id, name, hotkey, sort_order) 
-		VALUES ($1, $2, $3, $4) 
-		RETURNING id, name, hotkey, sort_order, created_at
-	`, models.TEST_USER_ID, requestData.Name, requestData.Hotkey, maxSortOrder+1).Scan(
-		&newCategory.ID, &newCategory.Name, &newCategory.Hotkey, &newCategory.SortOrder, &newCategory.CreatedAt)
+		INSERT INTO expense_category (user_id, name, description, include_guidance, exclude_guidance, examples,
+		                              hotkey, project_id, parent_id, sort_order, default_business_pct)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10, $11)
+		RETURNING id, name, description, include_guidance, exclude_guidance, examples, hotkey, project_id, parent_id,
+		          sort_order, default_business_pct, created_at
+	`, models.TEST_USER_ID, requestData.Name, requestData.Description, requestData.IncludeGuidance,
+		requestData.ExcludeGuidance, examples, requestData.Hotkey, requestData.ProjectID, requestData.ParentID, sortOrder,
+		requestData.DefaultBusinessPct).Scan(
+		&newCategory.ID, &newCategory.Name, &newCategory.Description, &newCategory.IncludeGuidance,
+		&newCategory.ExcludeGuidance, &newCategory.Examples, &newCategory.Hotkey, &newCategory.ProjectID,
+		&newCategory.ParentID, &newCategory.SortOrder, &newCategory.DefaultBusinessPct, &newCategory.CreatedAt)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create category: %v", err), http.StatusInternalServerError)
 		return
@@ -90,15 +372,20 @@ func CreateCategory(w http.ResponseWriter, r *http.Request) {
 
 func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	categoryID := chi.URLParam(r, "categoryID")
-	if categoryID == "" {
-		http.Error(w, "Category ID is required", http.StatusBadRequest)
+	categoryID, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
 		return
 	}
 
 	var requestData struct {
-		Name   string  `json:"name"`
-		Hotkey *string `json:"hotkey"`
+		Name               string          `json:"name"`
+		Description        *string         `json:"description"`
+		IncludeGuidance    *string         `json:"include_guidance"`
+		ExcludeGuidance    *string         `json:"exclude_guidance"`
+		Examples           *[]string       `json:"examples"`
+		Hotkey             json.RawMessage `json:"hotkey"`
+		DefaultBusinessPct *int            `json:"default_business_pct"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
@@ -106,17 +393,85 @@ func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The hotkey is left alone when omitted; null clears it
+	hotkeySet := requestData.Hotkey != nil
+	var hotkey *string
+	if hotkeySet {
+		if err := json.Unmarshal(requestData.Hotkey, &hotkey); err != nil {
+			http.Error(w, "hotkey must be a string or null", http.StatusBadRequest)
+			return
+		}
+	}
+
 	if requestData.Name == "" {
 		http.Error(w, "Category name is required", http.StatusBadRequest)
 		return
 	}
 
-	// Update category name and hotkey
-	_, err := database.Pool.Exec(ctx, `
-		UPDATE expense_category 
-		SET name = $1, hotkey = $2, updated_at = NOW() 
+	// default_business_pct is left alone when omitted; -1 clears it back to 100%
+	if pct := requestData.DefaultBusinessPct; pct != nil && *pct != -1 && (*pct < 0 || *pct > 100) {
+		http.Error(w, "default_business_pct must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+
+	// examples are left alone when omitted; an empty list clears them
+	var examples []string
+	if requestData.Examples != nil {
+		if examples, err = normalizeCategoryExamples(*requestData.Examples); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if hotkey != nil {
+		projectID, err := categoryProjectID(ctx, database.Pool, categoryID)
+		if err == pgx.ErrNoRows {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
+			return
+		}
+		holder, err := hotkeyHolder(ctx, database.Pool, projectID, categoryID, *hotkey)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check hotkey: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if holder != "" {
+			http.Error(w, fmt.Sprintf("Hotkey %s is already used by %s", *hotkey, holder), http.StatusConflict)
+			return
+		}
+	}
+
+	// Update category name, hotkey, business-use default, description and guidance. The
+	// description and guidance are left alone when omitted; an empty string clears them.
+	_, err = database.Pool.Exec(ctx, `
+		UPDATE expense_category
+		SET name = $1,
+		    hotkey = CASE WHEN $10::bool THEN $2::text ELSE hotkey END,
+		    default_business_pct = CASE
+		        WHEN $5::int IS NULL THEN default_business_pct
+		        WHEN $5::int = -1 THEN NULL
+		        ELSE $5::int
+		    END,
+		    description = CASE
+		        WHEN $6::text IS NULL THEN description
+		        ELSE NULLIF($6::text, '')
+		    END,
+		    include_guidance = CASE
+		        WHEN $7::text IS NULL THEN include_guidance
+		        ELSE NULLIF($7::text, '')
+		    END,
+		    exclude_guidance = CASE
+		        WHEN $8::text IS NULL THEN exclude_guidance
+		        ELSE NULLIF($8::text, '')
+		    END,
+		    examples = COALESCE($9::text[], examples),
+		    updated_at = NOW()
 		WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL
-	`, requestData.Name, requestData.Hotkey, categoryID, models.TEST_USER_ID)
+	`, requestData.Name, hotkey, categoryID, models.TEST_USER_ID, requestData.DefaultBusinessPct, requestData.Description,
+		requestData.IncludeGuidance, requestData.ExcludeGuidance, examples, hotkeySet)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to update category: %v", err), http.StatusInternalServerError)
 		return
@@ -127,30 +482,81 @@ func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"message": "Category updated successfully"}`))
 }
 
+// DeleteCategory soft-deletes a category. Its children move up to its parent, after the
+// parent's existing children. The category itself stays in the archive until restored or
+// purged.
 func DeleteCategory(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	categoryID := chi.URLParam(r, "categoryID")
-	if categoryID == "" {
-		http.Error(w, "Category ID is required", http.StatusBadRequest)
+	categoryID, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
 		return
 	}
 
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
 	// Soft delete category
-	_, err := database.Pool.Exec(ctx, `
-		UPDATE expense_category 
-		SET deleted_at = NOW() 
+	var parentID, projectID *int64
+	var sortOrder int
+	err = tx.QueryRow(ctx, `
+		UPDATE expense_category
+		SET deleted_at = NOW()
 		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
-	`, categoryID, models.TEST_USER_ID)
+		RETURNING parent_id, project_id, sort_order
+	`, categoryID, models.TEST_USER_ID).Scan(&parentID, &projectID, &sortOrder)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to delete category: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	if err := closeSiblingGap(ctx, tx, parentID, projectID, sortOrder); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reorder categories: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	nextSortOrder, err := nextSiblingSortOrder(ctx, tx, parentID, projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get max sort order: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE expense_category c
+		SET parent_id = $1,
+		    sort_order = $2 + moved.position - 1,
+		    updated_at = NOW()
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY sort_order, id) AS position
+			FROM expense_category
+			WHERE parent_id = $3 AND deleted_at IS NULL
+		) moved
+		WHERE c.id = moved.id
+	`, parentID, nextSortOrder, categoryID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to move child categories: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message": "Category deleted successfully"}`))
 }
 
+// MoveCategory swaps a category with its previous or next sibling under the same parent
 func MoveCategory(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	categoryID := chi.URLParam(r, "categoryID")
@@ -173,40 +579,68 @@ func MoveCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get current category's sort_order
+	// Begin transaction to swap sort orders
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Get current category's position among its siblings
+	var parentID, projectID *int64
 	var currentSortOrder int
-	err := database.Pool.QueryRow(ctx, `
-		SELECT sort_order 
-		FROM expense_category 
+	err = tx.QueryRow(ctx, `
+		SELECT parent_id, project_id, sort_order
+		FROM expense_category
 		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
-	`, categoryID, models.TEST_USER_ID).Scan(&currentSortOrder)
+		FOR UPDATE
+	`, categoryID, models.TEST_USER_ID).Scan(&parentID, &projectID, &currentSortOrder)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Determine target sort_order
-	targetSortOrder := currentSortOrder
-	if requestData.Direction == "up" {
-		targetSortOrder--
-	} else {
-		targetSortOrder++
+	// Find the nearest sibling in the requested direction
+	comparison, ordering := "<", "DESC"
+	if requestData.Direction == "down" {
+		comparison, ordering = ">", "ASC"
+	}
+	var siblingID int64
+	var targetSortOrder int
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT id, sort_order
+		FROM expense_category
+		WHERE user_id = $1 AND deleted_at IS NULL
+		  AND parent_id IS NOT DISTINCT FROM $2
+		  AND project_id IS NOT DISTINCT FROM $3
+		  AND sort_order %s $4
+		ORDER BY sort_order %s
+		LIMIT 1
+		FOR UPDATE
+	`, comparison, ordering), models.TEST_USER_ID, parentID, projectID, currentSortOrder).Scan(&siblingID, &targetSortOrder)
+	if err == pgx.ErrNoRows {
+		// Already first or last among its siblings
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message": "Category moved successfully"}`))
+		return
 	}
-
-	// Begin transaction to swap sort orders
-	tx, err := database.Pool.Begin(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to find sibling category: %v", err), http.StatusInternalServerError)
 		return
 	}
-	defer tx.Rollback(ctx)
 
 	// Update the other category to take current category's position
 	_, err = tx.Exec(ctx, `
-		UPDATE expense_category 
-		SET sort_order = $1 
-		WHERE sort_order = $2 AND user_id = $3 AND deleted_at IS NULL AND id != $4
-	`, currentSortOrder, targetSortOrder, models.TEST_USER_ID, categoryID)
+		UPDATE expense_category
+		SET sort_order = $1
+		WHERE id = $2
+	`, currentSortOrder, siblingID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to update other category: %v", err), http.StatusInternalServerError)
 		return
@@ -214,8 +648,8 @@ func MoveCategory(w http.ResponseWriter, r *http.Request) {
 
 	// Update current category to target position
 	_, err = tx.Exec(ctx, `
-		UPDATE expense_category 
-		SET sort_order = $1 
+		UPDATE expense_category
+		SET sort_order = $1
 		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
 	`, targetSortOrder, categoryID, models.TEST_USER_ID)
 	if err != nil {
@@ -232,3 +666,609 @@ func MoveCategory(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message": "Category moved successfully"}`))
 }
+
+// SetCategoryParent moves a category (with its children) under another parent, or to the
+// top level when parent_id is null. It goes last among its new siblings.
+func SetCategoryParent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	categoryID, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		ParentID *int64 `json:"parent_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var oldParentID, projectID *int64
+	var oldSortOrder int
+	err = tx.QueryRow(ctx, `
+		SELECT parent_id, project_id, sort_order
+		FROM expense_category
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`, categoryID, models.TEST_USER_ID).Scan(&oldParentID, &projectID, &oldSortOrder)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if sameCategoryID(oldParentID, requestData.ParentID) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message": "Category moved successfully"}`))
+		return
+	}
+
+	if requestData.ParentID != nil {
+		if err := checkCategoryParent(ctx, tx, categoryID, *requestData.ParentID, projectID); err != nil {
+			if err == errInvalidParent {
+				http.Error(w, "Parent must be an existing category in the same list, outside this category's subtree", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to check parent category: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := closeSiblingGap(ctx, tx, oldParentID, projectID, oldSortOrder); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reorder categories: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	sortOrder, err := nextSiblingSortOrder(ctx, tx, requestData.ParentID, projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get max sort order: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE expense_category
+		SET parent_id = $1, sort_order = $2, updated_at = NOW()
+		WHERE id = $3
+	`, requestData.ParentID, sortOrder, categoryID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to move category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Category moved successfully"}`))
+}
+
+// MergeCategories folds duplicate categories into this one. In one transaction, accepted and
+// suggested references in every project move to the target (each moved expense gets a
+// category_merge history event), vendor defaults, rule actions and budgets follow,
+// subcategories move under the target, and the sources are retired. The target keeps its own
+// tax line and hotkey and takes a source's when it has none. A source budget for a scope and period the
+// target already budgets is added to the target's when the currencies match and dropped
+// otherwise. All the categories must be in the same list. Merges are not part of a
+// project's undo history.
+func MergeCategories(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	categoryID, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		SourceCategoryIDs []int64 `json:"source_category_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.SourceCategoryIDs) == 0 {
+		http.Error(w, "source_category_ids is required", http.StatusBadRequest)
+		return
+	}
+	// A source listed twice is merged once
+	seen := make(map[int64]bool, len(req.SourceCategoryIDs))
+	sourceIDs := req.SourceCategoryIDs[:0]
+	for _, sourceID := range req.SourceCategoryIDs {
+		if sourceID == categoryID {
+			http.Error(w, "Cannot merge a category into itself", http.StatusBadRequest)
+			return
+		}
+		if !seen[sourceID] {
+			seen[sourceID] = true
+			sourceIDs = append(sourceIDs, sourceID)
+		}
+	}
+	req.SourceCategoryIDs = sourceIDs
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Every category involved must be an active category of the user, all in one list
+	var owned, lists int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT COALESCE(project_id, 0)) FROM expense_category
+		WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL
+	`, append([]int64{categoryID}, req.SourceCategoryIDs...), models.TEST_USER_ID).Scan(&owned, &lists)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check categories: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if owned != len(req.SourceCategoryIDs)+1 {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if lists > 1 {
+		http.Error(w, "Categories from different projects' lists cannot be merged", http.StatusBadRequest)
+		return
+	}
+
+	projectID, err := categoryProjectID(ctx, tx, categoryID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// The target can't live inside a source, or moving the source's children would loop
+	for _, sourceID := range req.SourceCategoryIDs {
+		if err := checkCategoryParent(ctx, tx, sourceID, categoryID, projectID); err != nil {
+			if err == errInvalidParent {
+				http.Error(w, "Cannot merge a category into one of its subcategories", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to check categories: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Reassign expenses, remembering what each one pointed at for the audit trail
+	rows, err := tx.Query(ctx, `
+		UPDATE expense e
+		SET accepted_category_id = CASE WHEN e.accepted_category_id = ANY($2) THEN $1 ELSE e.accepted_category_id END,
+		    suggested_category_id = CASE WHEN e.suggested_category_id = ANY($2) THEN $1 ELSE e.suggested_category_id END,
+		    version = e.version + 1
+		FROM (
+			SELECT id, accepted_category_id, suggested_category_id
+			FROM expense
+			WHERE accepted_category_id = ANY($2) OR suggested_category_id = ANY($2)
+			FOR UPDATE
+		) old
+		WHERE e.id = old.id
+		RETURNING e.id, old.accepted_category_id, old.suggested_category_id,
+		          e.accepted_category_id, e.suggested_category_id
+	`, categoryID, req.SourceCategoryIDs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reassign expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var history []historyEntry
+	acceptedCount, suggestedCount := 0, 0
+	for rows.Next() {
+		var expenseID int64
+		var oldState, newState expenseState
+		if err := rows.Scan(&expenseID, &oldState.AcceptedCategoryID, &oldState.SuggestedCategoryID,
+			&newState.AcceptedCategoryID, &newState.SuggestedCategoryID); err != nil {
+			rows.Close()
+			http.Error(w, fmt.Sprintf("Failed to scan expense: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !sameCategoryID(oldState.AcceptedCategoryID, newState.AcceptedCategoryID) {
+			acceptedCount++
+		}
+		if !sameCategoryID(oldState.SuggestedCategoryID, newState.SuggestedCategoryID) {
+			suggestedCount++
+		}
+		history = append(history, historyEntry{
+			ExpenseID:  expenseID,
+			EventType:  historyEventCategoryMerge,
+			CategoryID: &categoryID,
+			OldValue: map[string]interface{}{
+				"accepted_category_id":  oldState.AcceptedCategoryID,
+				"suggested_category_id": oldState.SuggestedCategoryID,
+			},
+			NewValue: map[string]interface{}{
+				"accepted_category_id":  newState.AcceptedCategoryID,
+				"suggested_category_id": newState.SuggestedCategoryID,
+			},
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reassign expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordHistory(ctx, tx, history...); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to record history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Settings the target lacks come from the first source that has them. The sources give
+	// up their hotkeys before the target takes one since hotkeys are unique.
+	var sourceHotkey *string
+	var sourceTaxLineID *int64
+	var sourceBusinessPct *int
+	err = tx.QueryRow(ctx, `
+		SELECT
+			(SELECT hotkey FROM expense_category WHERE id = ANY($1) AND hotkey IS NOT NULL
+			 ORDER BY array_position($1, id) LIMIT 1),
+			(SELECT tax_line_id FROM expense_category WHERE id = ANY($1) AND tax_line_id IS NOT NULL
+			 ORDER BY array_position($1, id) LIMIT 1),
+			(SELECT default_business_pct FROM expense_category WHERE id = ANY($1) AND default_business_pct IS NOT NULL
+			 ORDER BY array_position($1, id) LIMIT 1)
+	`, req.SourceCategoryIDs).Scan(&sourceHotkey, &sourceTaxLineID, &sourceBusinessPct)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read category settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE expense_category SET hotkey = NULL WHERE id = ANY($1)
+	`, req.SourceCategoryIDs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to clear hotkeys: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE expense_category
+		SET hotkey = COALESCE(hotkey, $2),
+		    tax_line_id = COALESCE(tax_line_id, $3),
+		    default_business_pct = COALESCE(default_business_pct, $4),
+		    updated_at = NOW()
+		WHERE id = $1
+	`, categoryID, sourceHotkey, sourceTaxLineID, sourceBusinessPct)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to merge category settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE vendor SET default_category_id = $1, updated_at = NOW()
+		WHERE default_category_id = ANY($2)
+	`, categoryID, req.SourceCategoryIDs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to merge vendor defaults: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE categorization_rule
+		SET actions = jsonb_set(actions, '{category_id}', to_jsonb($1::bigint)), updated_at = NOW()
+		WHERE user_id = $3 AND (actions->>'category_id')::bigint = ANY($2)
+	`, categoryID, req.SourceCategoryIDs, models.TEST_USER_ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to merge rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	rulesMoved := tag.RowsAffected()
+
+	// Move each source's budgets and subcategories to the target, then retire the source
+	budgetsMoved, budgetsCombined, budgetsDropped := 0, 0, 0
+	for _, sourceID := range req.SourceCategoryIDs {
+		moved, combined, dropped, err := mergeCategoryBudgets(ctx, tx, categoryID, sourceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to merge budgets: %v", err), http.StatusInternalServerError)
+			return
+		}
+		budgetsMoved += moved
+		budgetsCombined += combined
+		budgetsDropped += dropped
+
+		nextSortOrder, err := nextSiblingSortOrder(ctx, tx, &categoryID, projectID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get max sort order: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE expense_category c
+			SET parent_id = $1,
+			    sort_order = $2 + moved.position - 1,
+			    updated_at = NOW()
+			FROM (
+				SELECT id, ROW_NUMBER() OVER (ORDER BY sort_order, id) AS position
+				FROM expense_category
+				WHERE parent_id = $3 AND deleted_at IS NULL
+			) moved
+			WHERE c.id = moved.id
+		`, categoryID, nextSortOrder, sourceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to move child categories: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		var parentID *int64
+		var sortOrder int
+		err = tx.QueryRow(ctx, `
+			UPDATE expense_category
+			SET deleted_at = NOW(), updated_at = NOW()
+			WHERE id = $1
+			RETURNING parent_id, sort_order
+		`, sourceID).Scan(&parentID, &sortOrder)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to retire category: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if err := closeSiblingGap(ctx, tx, parentID, projectID, sortOrder); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to reorder categories: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var category models.Category
+	err = tx.QueryRow(ctx, `
+		SELECT id, name, hotkey, project_id, parent_id, sort_order, default_business_pct, tax_line_id, created_at
+		FROM expense_category
+		WHERE id = $1
+	`, categoryID).Scan(&category.ID, &category.Name, &category.Hotkey, &category.ProjectID, &category.ParentID, &category.SortOrder,
+		&category.DefaultBusinessPct, &category.TaxLineID, &category.CreatedAt)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          fmt.Sprintf("Merged %d categories", len(req.SourceCategoryIDs)),
+		"category":         category,
+		"accepted_count":   acceptedCount,
+		"suggested_count":  suggestedCount,
+		"budgets_moved":    budgetsMoved,
+		"budgets_combined": budgetsCombined,
+		"budgets_dropped":  budgetsDropped,
+		"rules_moved":      rulesMoved,
+	})
+}
+
+// loadSiblingIDs locks and returns the active categories under parentID in display order
+func loadSiblingIDs(ctx context.Context, tx pgx.Tx, parentID, projectID *int64) ([]int64, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT id
+		FROM expense_category
+		WHERE user_id = $1 AND deleted_at IS NULL AND parent_id IS NOT DISTINCT FROM $2
+		  AND project_id IS NOT DISTINCT FROM $3
+		ORDER BY sort_order ASC, id ASC
+		FOR UPDATE
+	`, models.TEST_USER_ID, parentID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// renumberSiblings sets sort_order 1..n in the order given. The IDs must all share a parent.
+func renumberSiblings(ctx context.Context, tx pgx.Tx, parentID *int64, orderedIDs []int64) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE expense_category c
+		SET parent_id = $2, sort_order = ordered.position, updated_at = NOW()
+		FROM unnest($1::bigint[]) WITH ORDINALITY AS ordered(id, position)
+		WHERE c.id = ordered.id
+		  AND (c.sort_order <> ordered.position OR c.parent_id IS DISTINCT FROM $2)
+	`, orderedIDs, parentID)
+	return err
+}
+
+// ReorderCategories sets the order of categories under one parent. The body is either
+//   - {"parent_id": null, "category_ids": [...]}: the full new order of the parent's active
+//     children, which must list each of them exactly once. For top-level categories,
+//     project_id picks a project's own list instead of the defaults; or
+//   - {"category_id": X, "before_category_id": Y}: move X just before Y, taking Y's parent.
+//     Y must be in X's list. A null before_category_id moves X to the end of its current parent.
+//
+// Siblings are renumbered 1..n, closing any gaps.
+func ReorderCategories(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		ProjectID        *int64  `json:"project_id"`
+		ParentID         *int64  `json:"parent_id"`
+		CategoryIDs      []int64 `json:"category_ids"`
+		CategoryID       *int64  `json:"category_id"`
+		BeforeCategoryID *int64  `json:"before_category_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if (req.CategoryIDs == nil) == (req.CategoryID == nil) {
+		http.Error(w, "Provide either category_ids or category_id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if req.CategoryIDs != nil {
+		// A subcategory list belongs to its parent's list
+		projectID := req.ProjectID
+		if req.ParentID != nil {
+			projectID, err = categoryProjectID(ctx, tx, *req.ParentID)
+			if err == pgx.ErrNoRows {
+				http.Error(w, "Parent category not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		siblings, err := loadSiblingIDs(ctx, tx, req.ParentID, projectID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch categories: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		expected := make(map[int64]bool, len(siblings))
+		for _, id := range siblings {
+			expected[id] = true
+		}
+		seen := make(map[int64]bool, len(req.CategoryIDs))
+		for _, id := range req.CategoryIDs {
+			if !expected[id] || seen[id] {
+				http.Error(w, fmt.Sprintf("Category %d is not an active category under this parent, or is listed twice", id), http.StatusBadRequest)
+				return
+			}
+			seen[id] = true
+		}
+		if len(seen) != len(expected) {
+			http.Error(w, fmt.Sprintf("category_ids must list all %d active categories under this parent", len(expected)), http.StatusBadRequest)
+			return
+		}
+
+		if err := renumberSiblings(ctx, tx, req.ParentID, req.CategoryIDs); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to reorder categories: %v", err), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		movingID := *req.CategoryID
+
+		var oldParentID, projectID *int64
+		err := tx.QueryRow(ctx, `
+			SELECT parent_id, project_id FROM expense_category
+			WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+			FOR UPDATE
+		`, movingID, models.TEST_USER_ID).Scan(&oldParentID, &projectID)
+		if err == pgx.ErrNoRows {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		newParentID := oldParentID
+		if req.BeforeCategoryID != nil {
+			if *req.BeforeCategoryID == movingID {
+				http.Error(w, "Cannot move a category before itself", http.StatusBadRequest)
+				return
+			}
+			var beforeProjectID *int64
+			err := tx.QueryRow(ctx, `
+				SELECT parent_id, project_id FROM expense_category
+				WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+			`, *req.BeforeCategoryID, models.TEST_USER_ID).Scan(&newParentID, &beforeProjectID)
+			if err == pgx.ErrNoRows {
+				http.Error(w, "Category to move before not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if !sameCategoryID(projectID, beforeProjectID) {
+				http.Error(w, "Cannot move a category into another project's list", http.StatusBadRequest)
+				return
+			}
+			if newParentID != nil {
+				if err := checkCategoryParent(ctx, tx, movingID, *newParentID, projectID); err != nil {
+					if err == errInvalidParent {
+						http.Error(w, "Cannot move a category into its own subtree", http.StatusBadRequest)
+						return
+					}
+					http.Error(w, fmt.Sprintf("Failed to check parent category: %v", err), http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		siblings, err := loadSiblingIDs(ctx, tx, newParentID, projectID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch categories: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		ordered := make([]int64, 0, len(siblings)+1)
+		for _, id := range siblings {
+			if id == movingID {
+				continue
+			}
+			if req.BeforeCategoryID != nil && id == *req.BeforeCategoryID {
+				ordered = append(ordered, movingID)
+			}
+			ordered = append(ordered, id)
+		}
+		if req.BeforeCategoryID == nil {
+			ordered = append(ordered, movingID)
+		}
+
+		if err := renumberSiblings(ctx, tx, newParentID, ordered); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to reorder categories: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Close the gap left behind when the category changed parent
+		if !sameCategoryID(oldParentID, newParentID) {
+			remaining, err := loadSiblingIDs(ctx, tx, oldParentID, projectID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to fetch categories: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if err := renumberSiblings(ctx, tx, oldParentID, remaining); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to reorder categories: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Categories reordered successfully"}`))
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// archivedCategoryUsageSQL counts what still refers to the archived category ec. Undo
+// history has no foreign key, so a category it mentions must stay for undo to work.
+const archivedCategoryUsageSQL = `
+	(SELECT COUNT(*) FROM expense e WHERE e.accepted_category_id = ec.id AND e.deleted_at IS NULL) AS accepted_count,
+	(SELECT COUNT(*) FROM expense e WHERE e.suggested_category_id = ec.id AND e.deleted_at IS NULL) AS suggested_count,
+	(SELECT COUNT(*) FROM expense e
+	 WHERE ec.id IN (e.accepted_category_id, e.suggested_category_id) AND e.deleted_at IS NOT NULL) AS deleted_expense_count,
+	(SELECT COUNT(*) FROM expense_change c
+	 WHERE ec.id IN (c.old_accepted_category_id, c.new_accepted_category_id,
+	                 c.old_suggested_category_id, c.new_suggested_category_id)) AS change_count,
+	(SELECT COUNT(*) FROM vendor v WHERE v.default_category_id = ec.id) AS vendor_count,
+	(SELECT COUNT(*) FROM categorization_rule cr WHERE (cr.actions->>'category_id')::bigint = ec.id) AS rule_count,
+	(SELECT COUNT(*) FROM category_budget b WHERE b.category_id = ec.id) AS budget_count`
+
+// archivedCategory is a deleted category with what still refers to it. Only a category
+// nothing refers to can be purged.
+type archivedCategory struct {
+	ID                  int64     `json:"id"`
+	Name                string    `json:"name"`
+	Description         *string   `json:"description"`
+	Hotkey              *string   `json:"hotkey"`
+	ProjectID           *int64    `json:"project_id"`
+	ParentID            *int64    `json:"parent_id"`
+	DeletedAt           time.Time `json:"deleted_at"`
+	AcceptedCount       int       `json:"accepted_count"`
+	SuggestedCount      int       `json:"suggested_count"`
+	DeletedExpenseCount int       `json:"deleted_expense_count"` // deleted expenses still pointing at it
+	ChangeCount         int       `json:"change_count"`          // undo history entries
+	VendorCount         int       `json:"vendor_count"`          // vendors defaulting to it
+	RuleCount           int       `json:"rule_count"`            // categorization rules assigning it
+	BudgetCount         int       `json:"budget_count"`          // budgets on it
+	Purgeable           bool      `json:"purgeable"`
+}
+
+// loadArchivedCategories reads the archived categories of one list (projectID, nil for the
+// defaults), most recently deleted first. A non-zero categoryID reads just that category,
+// in any list, and locks it.
+func loadArchivedCategories(ctx context.Context, q dbQuerier, projectID *int64, categoryID int64) ([]archivedCategory, error) {
+	locking := ""
+	if categoryID != 0 {
+		locking = "FOR UPDATE OF ec"
+	}
+	rows, err := q.Query(ctx, `
+		SELECT ec.id, ec.name, ec.description, ec.hotkey, ec.project_id, ec.parent_id, ec.deleted_at,
+		`+archivedCategoryUsageSQL+`
+		FROM expense_category ec
+		WHERE ec.user_id = $1 AND ec.deleted_at IS NOT NULL
+		  AND (CASE WHEN $3::bigint = 0 THEN ec.project_id IS NOT DISTINCT FROM $2 ELSE ec.id = $3 END)
+		ORDER BY ec.deleted_at DESC, ec.id ASC
+		`+locking, models.TEST_USER_ID, projectID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []archivedCategory{}
+	for rows.Next() {
+		var category archivedCategory
+		err := rows.Scan(&category.ID, &category.Name, &category.Description, &category.Hotkey, &category.ProjectID,
+			&category.ParentID, &category.DeletedAt, &category.AcceptedCount, &category.SuggestedCount,
+			&category.DeletedExpenseCount, &category.ChangeCount, &category.VendorCount, &category.RuleCount,
+			&category.BudgetCount)
+		if err != nil {
+			return nil, err
+		}
+		category.Purgeable = category.AcceptedCount == 0 && category.SuggestedCount == 0 &&
+			category.DeletedExpenseCount == 0 && category.ChangeCount == 0 && category.VendorCount == 0 &&
+			category.RuleCount == 0 && category.BudgetCount == 0
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// siblingNameTaken reports whether an active category other than categoryID under parentID
+// in projectID's list already has name, ignoring case
+func siblingNameTaken(ctx context.Context, q dbQuerier, parentID, projectID *int64, categoryID int64, name string) (bool, error) {
+	var taken bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM expense_category
+			WHERE user_id = $1 AND deleted_at IS NULL AND id <> $2
+			  AND parent_id IS NOT DISTINCT FROM $3 AND project_id IS NOT DISTINCT FROM $4
+			  AND lower(name) = lower($5)
+		)
+	`, models.TEST_USER_ID, categoryID, parentID, projectID, name).Scan(&taken)
+	return taken, err
+}
+
+// GetArchivedCategories lists the deleted categories of the user's defaults, or of a
+// project's own list (project_id), with their usage counts
+func GetArchivedCategories(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := categoryListParam(w, r)
+	if !ok {
+		return
+	}
+
+	categories, err := loadArchivedCategories(r.Context(), database.Pool, projectID, 0)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch archived categories: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// RestoreCategory brings an archived category back, last among its siblings. The optional
+// body {"name": ..., "hotkey": ...} overrides the stored values and must not conflict.
+// Without overrides conflicts are resolved and reported in notes: a name already used by a
+// sibling gets a " (restored)" suffix, a hotkey already in use is dropped, and a category
+// whose parent is archived returns at the top level.
+func RestoreCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	categoryID, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name   *string `json:"name"`
+		Hotkey *string `json:"hotkey"` // "" restores without a hotkey
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		http.Error(w, "Category name cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var name string
+	var parentID, projectID *int64
+	var storedHotkey *string
+	err = tx.QueryRow(ctx, `
+		SELECT name, hotkey, parent_id, project_id
+		FROM expense_category
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+		FOR UPDATE
+	`, categoryID, models.TEST_USER_ID).Scan(&name, &storedHotkey, &parentID, &projectID)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Archived category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if projectID != nil {
+		var projectActive bool
+		err := tx.QueryRow(ctx, `SELECT deleted_at IS NULL FROM project WHERE id = $1`, *projectID).Scan(&projectActive)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !projectActive {
+			http.Error(w, "The category's project has been deleted", http.StatusConflict)
+			return
+		}
+	}
+
+	notes := []string{}
+
+	if parentID != nil {
+		err := checkCategoryParent(ctx, tx, categoryID, *parentID, projectID)
+		if err == errInvalidParent {
+			parentID = nil
+			notes = append(notes, "Parent category is archived; restored at the top level")
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check parent category: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+	}
+	taken, err := siblingNameTaken(ctx, tx, parentID, projectID, categoryID, name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check category name: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if taken && req.Name != nil {
+		http.Error(w, fmt.Sprintf("A category named %s already exists here", name), http.StatusConflict)
+		return
+	}
+	for suffix := 1; taken; suffix++ {
+		candidate := name + " (restored)"
+		if suffix > 1 {
+			candidate = fmt.Sprintf("%s (restored %d)", name, suffix)
+		}
+		taken, err = siblingNameTaken(ctx, tx, parentID, projectID, categoryID, candidate)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check category name: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !taken {
+			notes = append(notes, fmt.Sprintf("Name %s is in use; restored as %s", name, candidate))
+			name = candidate
+		}
+	}
+
+	restoredHotkey := storedHotkey
+	if req.Hotkey != nil {
+		restoredHotkey = req.Hotkey
+		if *req.Hotkey == "" {
+			restoredHotkey = nil
+		}
+	}
+	if restoredHotkey != nil {
+		holder, err := hotkeyHolder(ctx, tx, projectID, categoryID, *restoredHotkey)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check hotkey: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if holder != "" {
+			if req.Hotkey != nil {
+				http.Error(w, fmt.Sprintf("Hotkey %s is already used by %s", *restoredHotkey, holder), http.StatusConflict)
+				return
+			}
+			notes = append(notes, fmt.Sprintf("Hotkey %s is now used by %s; restored without a hotkey", *restoredHotkey, holder))
+			restoredHotkey = nil
+		}
+	}
+
+	sortOrder, err := nextSiblingSortOrder(ctx, tx, parentID, projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get max sort order: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var category models.Category
+	err = tx.QueryRow(ctx, `
+		UPDATE expense_category
+		SET deleted_at = NULL, name = $2, hotkey = $3, parent_id = $4, sort_order = $5, updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, name, description, include_guidance, exclude_guidance, examples, hotkey, project_id, parent_id,
+		          sort_order, default_business_pct, tax_line_id, created_at
+	`, categoryID, name, restoredHotkey, parentID, sortOrder).Scan(&category.ID, &category.Name, &category.Description,
+		&category.IncludeGuidance, &category.ExcludeGuidance, &category.Examples, &category.Hotkey, &category.ProjectID, &category.ParentID, &category.SortOrder, &category.DefaultBusinessPct,
+		&category.TaxLineID, &category.CreatedAt)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to restore category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"category": category,
+		"notes":    notes,
+	})
+}
+
+// PurgeArchivedCategory permanently deletes an archived category that nothing refers to.
+// A category still in use is left alone and its usage returned with 409.
+func PurgeArchivedCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	categoryID, err := strconv.ParseInt(chi.URLParam(r, "categoryID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	categories, err := loadArchivedCategories(ctx, tx, nil, categoryID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(categories) == 0 {
+		http.Error(w, "Archived category not found", http.StatusNotFound)
+		return
+	}
+	if !categories[0].Purgeable {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "Category is still in use",
+			"category": categories[0],
+		})
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM expense_category WHERE id = $1`, categoryID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to purge category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Category purged successfully"}`))
+}
+
+// PurgeArchivedCategories permanently deletes every archived category in the defaults, or in
+// a project's own list (project_id), that nothing refers to
+func PurgeArchivedCategories(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	projectID, ok := categoryListParam(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	categories, err := loadArchivedCategories(ctx, tx, projectID, 0)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch archived categories: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var purgeIDs []int64
+	for _, category := range categories {
+		if category.Purgeable {
+			purgeIDs = append(purgeIDs, category.ID)
+		}
+	}
+
+	if len(purgeIDs) > 0 {
+		if _, err := tx.Exec(ctx, `DELETE FROM expense_category WHERE id = ANY($1)`, purgeIDs); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to purge categories: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      fmt.Sprintf("Purged %d categories", len(purgeIDs)),
+		"purged_count": len(purgeIDs),
+		"kept_count":   len(categories) - len(purgeIDs),
+	})
+}
@@ -0,0 +1,670 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// categorySetCSVHeader is the column layout of category sets as CSV. Imports match columns
+// by name, case-insensitively; only Name is required.
+// Examples go one per line within their cell.
+var categorySetCSVHeader = []string{"Name", "Parent", "Hotkey", "Description", "Use For", "Not For", "Examples",
+	"Tax Form", "Tax Line", "Business %"}
+
+// categorySetResult reports what applying a category set changed
+type categorySetResult struct {
+	Created  int      `json:"created"`
+	Updated  int      `json:"updated"`
+	Retired  int      `json:"retired"`
+	Warnings []string `json:"warnings"`
+}
+
+// setCategory is an active category in one of the user's lists with its hierarchy path
+type setCategory struct {
+	id       int64
+	name     string
+	parentID *int64
+	path     string
+}
+
+// categorySetPath is the path an entry will have, e.g. "Travel > Lodging"
+func categorySetPath(entry models.CategorySetEntry) string {
+	if entry.Parent == "" {
+		return entry.Name
+	}
+	return entry.Parent + categoryPathSeparator + entry.Name
+}
+
+// trimOptional trims an optional text field; blank becomes nil
+func trimOptional(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// normalizeCategorySet trims the entries and checks the set can be applied: paths are
+// unique, parents are listed before their children and each hotkey is one character used once
+func normalizeCategorySet(set *models.CategorySet) error {
+	if len(set.Categories) == 0 {
+		return fmt.Errorf("category set has no categories")
+	}
+
+	paths := make(map[string]bool)
+	hotkeys := make(map[string]string)
+	for i := range set.Categories {
+		entry := &set.Categories[i]
+		entry.Name = strings.TrimSpace(entry.Name)
+		entry.Parent = strings.TrimSpace(entry.Parent)
+		entry.Hotkey = trimOptional(entry.Hotkey)
+		entry.Description = trimOptional(entry.Description)
+		entry.IncludeGuidance = trimOptional(entry.IncludeGuidance)
+		entry.ExcludeGuidance = trimOptional(entry.ExcludeGuidance)
+		entry.TaxForm = trimOptional(entry.TaxForm)
+		entry.TaxLine = trimOptional(entry.TaxLine)
+
+		if entry.Name == "" {
+			return fmt.Errorf("category %d has no name", i+1)
+		}
+		examples, err := normalizeCategoryExamples(entry.Examples)
+		if err != nil {
+			return fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		if len(examples) == 0 {
+			examples = nil
+		}
+		entry.Examples = examples
+		if strings.Contains(entry.Name, categoryPathSeparator) {
+			return fmt.Errorf("category %q: names cannot contain %q", entry.Name, categoryPathSeparator)
+		}
+		if entry.Parent != "" && !paths[strings.ToLower(entry.Parent)] {
+			return fmt.Errorf("category %q: parent %q must be listed before it", entry.Name, entry.Parent)
+		}
+		path := strings.ToLower(categorySetPath(*entry))
+		if paths[path] {
+			return fmt.Errorf("category %q is listed twice", categorySetPath(*entry))
+		}
+		paths[path] = true
+
+		if entry.Hotkey != nil {
+			hotkey := strings.ToUpper(*entry.Hotkey)
+			if utf8.RuneCountInString(hotkey) != 1 {
+				return fmt.Errorf("category %q: hotkey must be a single character", entry.Name)
+			}
+			if other, ok := hotkeys[hotkey]; ok {
+				return fmt.Errorf("hotkey %s is used by both %q and %q", hotkey, other, entry.Name)
+			}
+			hotkeys[hotkey] = entry.Name
+			entry.Hotkey = &hotkey
+		}
+
+		if (entry.TaxForm == nil) != (entry.TaxLine == nil) {
+			return fmt.Errorf("category %q: tax form and tax line go together", entry.Name)
+		}
+		if pct := entry.DefaultBusinessPct; pct != nil && (*pct < 0 || *pct > 100) {
+			return fmt.Errorf("category %q: business percentage must be between 0 and 100", entry.Name)
+		}
+	}
+	return nil
+}
+
+// loadSetCategories reads the active categories of one list (projectID, nil for the
+// defaults) depth-first with their paths. Inherited defaults are not part of a project's list.
+func loadSetCategories(ctx context.Context, q dbQuerier, projectID *int64) ([]setCategory, error) {
+	rows, err := q.Query(ctx, categoryTreeCTE+`
+		SELECT ec.id, ec.name, ec.parent_id
+		FROM expense_category ec
+		JOIN category_tree t ON ec.id = t.id
+		WHERE ec.project_id IS NOT DISTINCT FROM $2
+		ORDER BY t.path ASC
+	`, models.TEST_USER_ID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []setCategory
+	paths := make(map[int64]string)
+	for rows.Next() {
+		var category setCategory
+		if err := rows.Scan(&category.id, &category.name, &category.parentID); err != nil {
+			return nil, err
+		}
+		category.path = category.name
+		if category.parentID != nil {
+			category.path = paths[*category.parentID] + categoryPathSeparator + category.name
+		}
+		paths[category.id] = category.path
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// loadCategorySet exports one of the user's category lists as a category set
+func loadCategorySet(ctx context.Context, projectID *int64) (models.CategorySet, error) {
+	set := models.CategorySet{Name: "Exported categories", Categories: []models.CategorySetEntry{}}
+
+	rows, err := database.Pool.Query(ctx, categoryTreeCTE+`
+		SELECT ec.id, ec.name, ec.parent_id, ec.hotkey, ec.description, ec.include_guidance, ec.exclude_guidance,
+		       ec.examples, ec.default_business_pct, tl.form, tl.line
+		FROM expense_category ec
+		JOIN category_tree t ON ec.id = t.id
+		LEFT JOIN tax_line tl ON tl.id = ec.tax_line_id
+		WHERE ec.project_id IS NOT DISTINCT FROM $2
+		ORDER BY t.path ASC
+	`, models.TEST_USER_ID, projectID)
+	if err != nil {
+		return set, err
+	}
+	defer rows.Close()
+
+	paths := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var parentID *int64
+		var entry models.CategorySetEntry
+		err := rows.Scan(&id, &entry.Name, &parentID, &entry.Hotkey, &entry.Description, &entry.IncludeGuidance,
+			&entry.ExcludeGuidance, &entry.Examples, &entry.DefaultBusinessPct, &entry.TaxForm, &entry.TaxLine)
+		if err != nil {
+			return set, err
+		}
+		if len(entry.Examples) == 0 {
+			entry.Examples = nil
+		}
+		if parentID != nil {
+			entry.Parent = paths[*parentID]
+		}
+		paths[id] = categorySetPath(entry)
+		set.Categories = append(set.Categories, entry)
+	}
+	return set, rows.Err()
+}
+
+// resolveSetTaxLine finds the tax line an entry maps to. An unknown line is a warning, not
+// an error, so a template still applies for users without that form.
+func resolveSetTaxLine(ctx context.Context, q dbQuerier, entry models.CategorySetEntry, result *categorySetResult) (*int64, error) {
+	if entry.TaxForm == nil {
+		return nil, nil
+	}
+	var taxLineID int64
+	err := q.QueryRow(ctx, `
+		SELECT id FROM tax_line
+		WHERE (user_id IS NULL OR user_id = $1) AND form = $2 AND line = $3
+		ORDER BY user_id NULLS LAST
+		LIMIT 1
+	`, models.TEST_USER_ID, *entry.TaxForm, *entry.TaxLine).Scan(&taxLineID)
+	if err == pgx.ErrNoRows {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s line %s for %q is not a known tax line", *entry.TaxForm, *entry.TaxLine, entry.Name))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &taxLineID, nil
+}
+
+// claimSetHotkey returns the hotkey an entry can take. A hotkey already used alongside the
+// list stays where it is, with a warning. categoryID is 0 for a new category.
+func claimSetHotkey(ctx context.Context, q dbQuerier, entry models.CategorySetEntry, projectID *int64, categoryID int64, result *categorySetResult) (*string, error) {
+	if entry.Hotkey == nil {
+		return nil, nil
+	}
+	holder, err := hotkeyHolder(ctx, q, projectID, categoryID, *entry.Hotkey)
+	if err != nil {
+		return nil, err
+	}
+	if holder != "" {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("hotkey %s for %q is already used by %q", *entry.Hotkey, entry.Name, holder))
+		return nil, nil
+	}
+	return entry.Hotkey, nil
+}
+
+// applyCategorySet writes a normalized category set into one of the user's category lists
+// (projectID, nil for the defaults). Entries are
+// matched to existing categories by path, then by name, so re-parenting a category in a
+// template keeps its expenses. Matched categories take the entry's parent and any fields the
+// entry sets. In merge mode unmatched categories are kept and new ones go after their
+// siblings; in replace mode unmatched categories are retired and the set's order is used.
+func applyCategorySet(ctx context.Context, tx pgx.Tx, set models.CategorySet, projectID *int64, replace bool) (*categorySetResult, error) {
+	result := &categorySetResult{Warnings: []string{}}
+
+	existing, err := loadSetCategories(ctx, tx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := make(map[string]*setCategory)
+	for i := range existing {
+		path := strings.ToLower(existing[i].path)
+		if _, ok := byPath[path]; !ok {
+			byPath[path] = &existing[i]
+		}
+	}
+	matches := make([]*setCategory, len(set.Categories))
+	claimed := make(map[int64]bool)
+	for i, entry := range set.Categories {
+		if category, ok := byPath[strings.ToLower(categorySetPath(entry))]; ok && !claimed[category.id] {
+			matches[i] = category
+			claimed[category.id] = true
+		}
+	}
+	for i, entry := range set.Categories {
+		if matches[i] != nil {
+			continue
+		}
+		for j := range existing {
+			if category := &existing[j]; !claimed[category.id] && strings.EqualFold(category.name, entry.Name) {
+				matches[i] = category
+				claimed[category.id] = true
+				break
+			}
+		}
+	}
+
+	// Parents whose children change; they are renumbered at the end
+	touchedParents := make(map[int64]bool)
+	touchedTopLevel := false
+	touch := func(parentID *int64) {
+		if parentID == nil {
+			touchedTopLevel = true
+		} else {
+			touchedParents[*parentID] = true
+		}
+	}
+
+	if replace {
+		var retiredIDs []int64
+		for _, category := range existing {
+			if !claimed[category.id] {
+				retiredIDs = append(retiredIDs, category.id)
+				touch(category.parentID)
+			}
+		}
+		if len(retiredIDs) > 0 {
+			_, err := tx.Exec(ctx, `
+				UPDATE expense_category
+				SET deleted_at = NOW(), updated_at = NOW()
+				WHERE id = ANY($1) AND user_id = $2
+			`, retiredIDs, models.TEST_USER_ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.Retired = len(retiredIDs)
+	}
+
+	ids := make(map[string]int64)
+	for i, entry := range set.Categories {
+		var parentID *int64
+		if entry.Parent != "" {
+			id := ids[strings.ToLower(entry.Parent)]
+			parentID = &id
+		}
+
+		taxLineID, err := resolveSetTaxLine(ctx, tx, entry, result)
+		if err != nil {
+			return nil, err
+		}
+
+		var categoryID int64
+		match := matches[i]
+		if match != nil {
+			categoryID = match.id
+		}
+		hotkey, err := claimSetHotkey(ctx, tx, entry, projectID, categoryID, result)
+		if err != nil {
+			return nil, err
+		}
+
+		// nil keeps a matched category where it is among its siblings
+		var sortOrder *int
+		moved := match == nil || !sameCategoryID(match.parentID, parentID)
+		if replace {
+			position := i + 1
+			sortOrder = &position
+		} else if moved {
+			next, err := nextSiblingSortOrder(ctx, tx, parentID, projectID)
+			if err != nil {
+				return nil, err
+			}
+			sortOrder = &next
+		}
+
+		if match != nil {
+			_, err = tx.Exec(ctx, `
+				UPDATE expense_category
+				SET name = $2, parent_id = $3,
+				    sort_order = COALESCE($4, sort_order),
+				    description = COALESCE($5, description),
+				    hotkey = COALESCE($6, hotkey),
+				    tax_line_id = COALESCE($7, tax_line_id),
+				    default_business_pct = COALESCE($8, default_business_pct),
+				    include_guidance = COALESCE($9, include_guidance),
+				    exclude_guidance = COALESCE($10, exclude_guidance),
+				    examples = COALESCE($11::text[], examples),
+				    updated_at = NOW()
+				WHERE id = $1
+			`, match.id, entry.Name, parentID, sortOrder, entry.Description, hotkey, taxLineID, entry.DefaultBusinessPct,
+				entry.IncludeGuidance, entry.ExcludeGuidance, entry.Examples)
+			if err != nil {
+				return nil, err
+			}
+			if moved {
+				touch(match.parentID)
+			}
+			result.Updated++
+		} else {
+			err = tx.QueryRow(ctx, `
+				INSERT INTO expense_category (user_id, project_id, name, description, hotkey, parent_id, sort_order, tax_line_id,
+				                              default_business_pct, include_guidance, exclude_guidance, examples)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, COALESCE($12::text[], '{}'))
+				RETURNING id
+			`, models.TEST_USER_ID, projectID, entry.Name, entry.Description, hotkey, parentID, sortOrder, taxLineID,
+				entry.DefaultBusinessPct, entry.IncludeGuidance, entry.ExcludeGuidance, entry.Examples).Scan(&categoryID)
+			if err != nil {
+				return nil, err
+			}
+			result.Created++
+		}
+		touch(parentID)
+		ids[strings.ToLower(categorySetPath(entry))] = categoryID
+	}
+
+	renumber := func(parentID *int64) error {
+		siblingIDs, err := loadSiblingIDs(ctx, tx, parentID, projectID)
+		if err != nil {
+			return err
+		}
+		return renumberSiblings(ctx, tx, parentID, siblingIDs)
+	}
+	if touchedTopLevel {
+		if err := renumber(nil); err != nil {
+			return nil, err
+		}
+	}
+	for parentID := range touchedParents {
+		if err := renumber(&parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// writeCategorySetCSV writes a category set in the categorySetCSVHeader layout
+func writeCategorySetCSV(w io.Writer, set models.CategorySet) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(categorySetCSVHeader); err != nil {
+		return err
+	}
+
+	optional := func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return *value
+	}
+	for _, entry := range set.Categories {
+		businessPct := ""
+		if entry.DefaultBusinessPct != nil {
+			businessPct = strconv.Itoa(*entry.DefaultBusinessPct)
+		}
+		record := []string{entry.Name, entry.Parent, optional(entry.Hotkey), optional(entry.Description),
+			optional(entry.IncludeGuidance), optional(entry.ExcludeGuidance), strings.Join(entry.Examples, "\n"),
+			optional(entry.TaxForm), optional(entry.TaxLine), businessPct}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// parseCategorySetCSV reads a category set from CSV with a header row
+func parseCategorySetCSV(r io.Reader) (models.CategorySet, error) {
+	set := models.CategorySet{Name: "Imported categories"}
+
+	// Spreadsheets often drop trailing empty cells, so rows may be shorter than the header
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return set, fmt.Errorf("failed to parse CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return set, fmt.Errorf("CSV is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return set, fmt.Errorf("CSV has no Name column")
+	}
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	optional := func(record []string, column string) *string {
+		value := field(record, column)
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+
+	for row, record := range records[1:] {
+		entry := models.CategorySetEntry{
+			Name:            field(record, "name"),
+			Parent:          field(record, "parent"),
+			Hotkey:          optional(record, "hotkey"),
+			Description:     optional(record, "description"),
+			IncludeGuidance: optional(record, "use for"),
+			ExcludeGuidance: optional(record, "not for"),
+			TaxForm:         optional(record, "tax form"),
+			TaxLine:         optional(record, "tax line"),
+		}
+		if examples := field(record, "examples"); examples != "" {
+			entry.Examples = strings.Split(examples, "\n")
+		}
+		if entry.Name == "" && entry.Parent == "" {
+			continue // blank line
+		}
+		if value := strings.TrimSuffix(field(record, "business %"), "%"); value != "" {
+			pct, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return set, fmt.Errorf("row %d: invalid business percentage %q", row+2, value)
+			}
+			entry.DefaultBusinessPct = &pct
+		}
+		set.Categories = append(set.Categories, entry)
+	}
+	return set, nil
+}
+
+// readCategorySet reads an uploaded category set: a JSON body, a text/csv body, or a
+// multipart form with a "file" field holding JSON or CSV (by the .csv extension)
+func readCategorySet(r *http.Request) (models.CategorySet, error) {
+	var set models.CategorySet
+	contentType := r.Header.Get("Content-Type")
+
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max
+			return set, fmt.Errorf("failed to parse form: %v", err)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return set, fmt.Errorf("failed to get file: %v", err)
+		}
+		defer file.Close()
+		if strings.HasSuffix(strings.ToLower(header.Filename), ".csv") {
+			return parseCategorySetCSV(file)
+		}
+		err = json.NewDecoder(file).Decode(&set)
+		return set, err
+	case strings.HasPrefix(contentType, "text/csv"):
+		return parseCategorySetCSV(r.Body)
+	default:
+		err := json.NewDecoder(r.Body).Decode(&set)
+		return set, err
+	}
+}
+
+// applyCategorySetRequest applies a set in the mode named by the "mode" query parameter
+// (merge, the default, or replace) to the list named by project_id and writes the result
+func applyCategorySetRequest(w http.ResponseWriter, r *http.Request, set models.CategorySet) {
+	ctx := r.Context()
+
+	projectID, ok := categoryListParam(w, r)
+	if !ok {
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "merge"
+	}
+	if mode != "merge" && mode != "replace" {
+		http.Error(w, "mode must be 'merge' or 'replace'", http.StatusBadRequest)
+		return
+	}
+
+	if err := normalizeCategorySet(&set); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid category set: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := applyCategorySet(ctx, tx, set, projectID, mode == "replace")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to apply category set: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// ExportCategories downloads the user's default categories, or a project's own categories
+// (project_id), as a category set. Optional: format (json, the default, or csv).
+func ExportCategories(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "format must be 'json' or 'csv'", http.StatusBadRequest)
+		return
+	}
+
+	projectID, ok := categoryListParam(w, r)
+	if !ok {
+		return
+	}
+
+	set, err := loadCategorySet(r.Context(), projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch categories: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=categories.csv")
+		if err := writeCategorySetCSV(w, set); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write CSV: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=categories.json")
+	json.NewEncoder(w).Encode(set)
+}
+
+// ImportCategories merges an uploaded category set into the user's default categories or a
+// project's own list (project_id), or replaces them with it (mode=replace)
+func ImportCategories(w http.ResponseWriter, r *http.Request) {
+	set, err := readCategorySet(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid category set: %v", err), http.StatusBadRequest)
+		return
+	}
+	applyCategorySetRequest(w, r, set)
+}
+
+// GetCategoryTemplates lists the built-in category sets without their categories
+func GetCategoryTemplates(w http.ResponseWriter, r *http.Request) {
+	type templateSummary struct {
+		Key           string `json:"key"`
+		Name          string `json:"name"`
+		Description   string `json:"description"`
+		CategoryCount int    `json:"category_count"`
+	}
+
+	summaries := make([]templateSummary, len(categoryTemplates))
+	for i, template := range categoryTemplates {
+		summaries[i] = templateSummary{
+			Key:           template.Key,
+			Name:          template.Name,
+			Description:   template.Description,
+			CategoryCount: len(template.Categories),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
+
+// GetCategoryTemplate returns one built-in category set
+func GetCategoryTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := findCategoryTemplate(chi.URLParam(r, "templateKey"))
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// ApplyCategoryTemplate merges a built-in category set into the user's default categories or
+// a project's own list (project_id), or replaces them with it (mode=replace)
+func ApplyCategoryTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := findCategoryTemplate(chi.URLParam(r, "templateKey"))
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	applyCategorySetRequest(w, r, template)
+}
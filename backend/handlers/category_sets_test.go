@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ookkee/models"
+)
+
+func strPtr(s string) *string { return &s }
+
+func intPtr(n int) *int { return &n }
+
+func TestNormalizeCategorySet(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []models.CategorySetEntry
+		wantErr string // substring of the error, "" when the set is valid
+	}{
+		{"valid", []models.CategorySetEntry{
+			{Name: " Travel ", Hotkey: strPtr("t")},
+			{Name: "Lodging", Parent: "travel", Hotkey: strPtr("L")}, // parents match case-insensitively
+			{Name: "Office", Hotkey: strPtr(" ")},                    // a blank hotkey is none
+		}, ""},
+		{"same name under different parents", []models.CategorySetEntry{
+			{Name: "Travel"}, {Name: "Office"},
+			{Name: "Other", Parent: "Travel"}, {Name: "Other", Parent: "Office"},
+		}, ""},
+		{"empty", nil, "no categories"},
+		{"blank name", []models.CategorySetEntry{{Name: "Travel"}, {Name: "  "}}, "category 2 has no name"},
+		{"path listed twice", []models.CategorySetEntry{{Name: "Travel"}, {Name: "TRAVEL"}}, "listed twice"},
+		{"child before parent", []models.CategorySetEntry{{Name: "Lodging", Parent: "Travel"}, {Name: "Travel"}},
+			"must be listed before it"},
+		{"name with the path separator", []models.CategorySetEntry{{Name: "Travel > Lodging"}}, "cannot contain"},
+		{"long hotkey", []models.CategorySetEntry{{Name: "Travel", Hotkey: strPtr("TR")}}, "single character"},
+		{"hotkey used twice", []models.CategorySetEntry{{Name: "Travel", Hotkey: strPtr("t")},
+			{Name: "Taxes", Hotkey: strPtr("T")}}, "hotkey T is used by both"},
+		{"tax form without a line", []models.CategorySetEntry{{Name: "Travel", TaxForm: strPtr("Schedule C")}},
+			"tax form and tax line go together"},
+		{"business percentage over 100", []models.CategorySetEntry{{Name: "Travel", DefaultBusinessPct: intPtr(101)}},
+			"between 0 and 100"},
+	}
+
+	for _, tt := range tests {
+		set := models.CategorySet{Categories: tt.entries}
+		err := normalizeCategorySet(&set)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizeCategorySetTrims(t *testing.T) {
+	set := models.CategorySet{Categories: []models.CategorySetEntry{
+		{Name: " Travel ", Hotkey: strPtr(" t "), Description: strPtr("  "), Examples: []string{" Flights ", "flights", ""}},
+		{Name: "Lodging", Parent: " travel ", TaxForm: strPtr(" Schedule C "), TaxLine: strPtr("24a")},
+	}}
+	if err := normalizeCategorySet(&set); err != nil {
+		t.Fatalf("normalizeCategorySet: %v", err)
+	}
+
+	travel, lodging := set.Categories[0], set.Categories[1]
+	if travel.Name != "Travel" || *travel.Hotkey != "T" || travel.Description != nil ||
+		!reflect.DeepEqual(travel.Examples, []string{"Flights"}) {
+		t.Errorf("travel = %+v", travel)
+	}
+	if lodging.Parent != "travel" || *lodging.TaxForm != "Schedule C" || lodging.Hotkey != nil || lodging.Examples != nil {
+		t.Errorf("lodging = %+v", lodging)
+	}
+}
+
+func TestParseCategorySetCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []models.CategorySetEntry
+		wantErr string
+	}{
+		{
+			"headers in any case and order",
+			"HOTKEY, name ,Business %,use FOR,Parent\n" +
+				"T,Travel,50%,Trips,\n" +
+				",Lodging,,,Travel\n",
+			[]models.CategorySetEntry{
+				{Name: "Travel", Hotkey: strPtr("T"), IncludeGuidance: strPtr("Trips"), DefaultBusinessPct: intPtr(50)},
+				{Name: "Lodging", Parent: "Travel"},
+			},
+			"",
+		},
+		{
+			"blank rows skipped and examples split by line",
+			"Name,Examples,Tax Form,Tax Line\n" +
+				",,,\n" +
+				"Meals,\"Lunch\nDinner\",Schedule C,24b\n",
+			[]models.CategorySetEntry{
+				{Name: "Meals", Examples: []string{"Lunch", "Dinner"}, TaxForm: strPtr("Schedule C"), TaxLine: strPtr("24b")},
+			},
+			"",
+		},
+		{"short rows", "Name,Parent,Hotkey\nTravel\n", []models.CategorySetEntry{{Name: "Travel"}}, ""},
+		{"no name column", "Category,Parent\nTravel,\n", nil, "no Name column"},
+		{"empty", "", nil, "CSV is empty"},
+		{"bad business percentage", "Name,Business %\nTravel,half\n", nil, "row 2: invalid business percentage"},
+	}
+
+	for _, tt := range tests {
+		set, err := parseCategorySetCSV(strings.NewReader(tt.csv))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(set.Categories, tt.want) {
+			t.Errorf("%s: categories = %+v, want %+v", tt.name, set.Categories, tt.want)
+		}
+	}
+}
+
+func TestCategorySetCSVRoundTrip(t *testing.T) {
+	set := models.CategorySet{Categories: []models.CategorySetEntry{
+		{Name: "Travel", Hotkey: strPtr("T"), Description: strPtr("Getting around, \"far\""),
+			ExcludeGuidance: strPtr("Commuting"), DefaultBusinessPct: intPtr(80)},
+		{Name: "Lodging", Parent: "Travel", Examples: []string{"Hotel", "Airbnb"},
+			TaxForm: strPtr("Schedule C"), TaxLine: strPtr("24a")},
+	}}
+
+	var buf bytes.Buffer
+	if err := writeCategorySetCSV(&buf, set); err != nil {
+		t.Fatalf("writeCategorySetCSV: %v", err)
+	}
+	parsed, err := parseCategorySetCSV(&buf)
+	if err != nil {
+		t.Fatalf("parseCategorySetCSV: %v", err)
+	}
+	if !reflect.DeepEqual(parsed.Categories, set.Categories) {
+		t.Errorf("round trip = %+v, want %+v", parsed.Categories, set.Categories)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import "ookkee/models"
+
+// templateEntry builds a template category. Empty strings leave a field unset; taxLine is a
+// Schedule C line.
+func templateEntry(parent, name, hotkey, taxLine, description string) models.CategorySetEntry {
+	entry := models.CategorySetEntry{Name: name, Parent: parent}
+	if hotkey != "" {
+		entry.Hotkey = &hotkey
+	}
+	if taxLine != "" {
+		form := models.TaxFormScheduleC
+		entry.TaxForm = &form
+		entry.TaxLine = &taxLine
+	}
+	if description != "" {
+		entry.Description = &description
+	}
+	return entry
+}
+
+// categoryTemplates are the built-in category sets new clients can start from
+var categoryTemplates = []models.CategorySet{
+	{
+		Key:         "sole-proprietor",
+		Name:        "Sole proprietor",
+		Description: "Schedule C expense categories for a self-employed individual or single-member LLC",
+		Categories: []models.CategorySetEntry{
+			templateEntry("", "Advertising", "A", "8", "Ads, sponsorships, business cards and website promotion"),
+			templateEntry("", "Car and Truck", "", "9", "Business use of a vehicle at actual cost"),
+			templateEntry("Car and Truck", "Gasoline", "G", "9", ""),
+			templateEntry("Car and Truck", "Parking", "", "9", ""),
+			templateEntry("Car and Truck", "Tolls", "L", "9", ""),
+			templateEntry("Car and Truck", "Auto Maintenance", "", "9", "Repairs, tires and oil changes"),
+			templateEntry("Car and Truck", "Auto Insurance", "", "9", ""),
+			templateEntry("Car and Truck", "Auto Registration", "", "9", ""),
+			templateEntry("", "Fees", "", "10", "Commissions, merchant fees and platform fees"),
+			templateEntry("", "Contract Labor", "", "11", "Payments to independent contractors"),
+			templateEntry("", "Computer", "C", "13", "Equipment that is depreciated or expensed under section 179"),
+			templateEntry("", "Insurance", "", "15", "Business insurance other than health"),
+			templateEntry("", "Professional Services", "", "17", "Legal, accounting and tax preparation"),
+			templateEntry("Professional Services", "Tax Prep", "X", "17", ""),
+			templateEntry("", "Office", "", "18", "Office expenses"),
+			templateEntry("Office", "Office Supplies", "O", "18", ""),
+			templateEntry("Office", "Software", "S", "18", "Subscriptions and licenses"),
+			templateEntry("Office", "Hosting", "H", "18", "Domains, servers and cloud services"),
+			templateEntry("Office", "Postage", "", "18", ""),
+			templateEntry("", "Rent", "R", "20b", "Office or workspace rent"),
+			templateEntry("", "Repairs and Maintenance", "", "21", ""),
+			templateEntry("", "Project Supplies", "J", "22", "Materials used up on client work"),
+			templateEntry("", "Business Filings", "B", "23", "Licenses, permits and state filing fees"),
+			templateEntry("", "Travel", "T", "24a", "Airfare, lodging and transport away from home"),
+			templateEntry("", "Meals", "M", "24b", "Business meals; generally 50% deductible"),
+			templateEntry("", "Utilities", "", "25", ""),
+			templateEntry("Utilities", "Phone", "F", "25", ""),
+			templateEntry("Utilities", "Internet", "I", "25", ""),
+			templateEntry("", "Payroll", "P", "26", "Wages paid to employees"),
+			templateEntry("", "Education/Training", "", "27a", "Courses, books and conferences"),
+			templateEntry("", "Bank Fees", "", "27a", ""),
+		},
+	},
+	{
+		Key:         "rental-property",
+		Name:        "Rental property",
+		Description: "Income property expenses, following the Schedule E expense lines",
+		Categories: []models.CategorySetEntry{
+			templateEntry("", "Advertising", "A", "", "Listings and signs for vacancies"),
+			templateEntry("", "Auto and Travel", "T", "", "Trips to the property and to buy supplies"),
+			templateEntry("", "Cleaning and Maintenance", "", "", "Routine upkeep, landscaping and pest control"),
+			templateEntry("", "Commissions", "", "", "Leasing agent commissions"),
+			templateEntry("", "Insurance", "", "", "Landlord, liability and flood insurance"),
+			templateEntry("", "Legal and Professional Fees", "", "", "Attorneys, accountants and tax preparation"),
+			templateEntry("", "Management Fees", "", "", "Property manager fees"),
+			templateEntry("", "Mortgage Interest", "", "", "Interest paid to banks on the property mortgage"),
+			templateEntry("", "Other Interest", "", "", ""),
+			templateEntry("", "Repairs", "R", "", "Fixes that restore the property; improvements are capitalized"),
+			templateEntry("", "Supplies", "S", "", ""),
+			templateEntry("", "Property Taxes", "X", "", ""),
+			templateEntry("", "Utilities", "U", "", "Utilities the landlord pays"),
+			templateEntry("Utilities", "Water", "W", "", ""),
+			templateEntry("Utilities", "Electric", "E", "", ""),
+			templateEntry("Utilities", "Gas Utility Bill", "", "", ""),
+			templateEntry("Utilities", "Trash", "", "", ""),
+			templateEntry("", "HOA Dues", "", "", ""),
+			templateEntry("", "Capital Improvements", "", "", "Depreciated over time rather than deducted"),
+		},
+	},
+	{
+		Key:         "nonprofit",
+		Name:        "Nonprofit",
+		Description: "Functional expense categories for a small nonprofit",
+		Categories: []models.CategorySetEntry{
+			templateEntry("", "Personnel", "", "", ""),
+			templateEntry("Personnel", "Salaries and Wages", "P", "", ""),
+			templateEntry("Personnel", "Payroll Taxes", "", "", ""),
+			templateEntry("Personnel", "Employee Benefits", "", "", ""),
+			templateEntry("Personnel", "Contractors", "", "", ""),
+			templateEntry("", "Programs", "", "", "Costs of delivering the mission"),
+			templateEntry("Programs", "Program Supplies", "J", "", ""),
+			templateEntry("Programs", "Grants and Assistance", "G", "", "Grants to organizations and individuals"),
+			templateEntry("Programs", "Events", "", "", ""),
+			templateEntry("", "Fundraising", "", "", "Costs of raising contributions"),
+			templateEntry("Fundraising", "Donor Communications", "", "", "Mailings, printing and email tools"),
+			templateEntry("Fundraising", "Fundraising Events", "", "", ""),
+			templateEntry("Fundraising", "Payment Processing Fees", "", "", ""),
+			templateEntry("", "Management and General", "", "", "Administration and overhead"),
+			templateEntry("Management and General", "Occupancy", "R", "", "Rent and utilities"),
+			templateEntry("Management and General", "Office Supplies", "O", "", ""),
+			templateEntry("Management and General", "Software", "S", "", ""),
+			templateEntry("Management and General", "Insurance", "", "", "Liability and directors and officers insurance"),
+			templateEntry("Management and General", "Professional Fees", "", "", "Audit, legal and bookkeeping"),
+			templateEntry("Management and General", "Filings and Dues", "B", "", "State registrations and memberships"),
+			templateEntry("", "Travel and Meetings", "T", "", ""),
+		},
+	},
+}
+
+// findCategoryTemplate returns a copy of the built-in category set with the given key
+func findCategoryTemplate(key string) (models.CategorySet, bool) {
+	for _, template := range categoryTemplates {
+		if template.Key == key {
+			template.Categories = append([]models.CategorySetEntry(nil), template.Categories...)
+			return template, true
+		}
+	}
+	return models.CategorySet{}, false
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// categoryPathSeparator joins category names into a hierarchy path, e.g. "Travel > Airfare"
+const categoryPathSeparator = " > "
+
+// categoryTotal is one category's totals in a project. TotalAmount is the full amount,
+// split into DeductibleAmount (the business-use portion) and PersonalAmount. These and
+// UnconvertedCount include the category's subcategories; the Own amounts are the expenses
+// accepted into the category itself.
+type categoryTotal struct {
+	CategoryID          int64            `json:"category_id"`
+	CategoryName        string           `json:"category_name"`
+	ParentID            *int64           `json:"parent_id"`
+	Path                string           `json:"path"`
+	Depth               int              `json:"depth"`
+	TotalAmount         models.Money     `json:"total_amount"`
+	DeductibleAmount    models.Money     `json:"deductible_amount"`
+	PersonalAmount      models.Money     `json:"personal_amount"`
+	OwnTotalAmount      models.Money     `json:"own_total_amount"`
+	OwnDeductibleAmount models.Money     `json:"own_deductible_amount"`
+	OwnPersonalAmount   models.Money     `json:"own_personal_amount"`
+	Currency            string           `json:"currency"`
+	UnconvertedCount    int              `json:"unconverted_count"`
+	Children            []*categoryTotal `json:"children"`
+
+	sortOrder    int
+	expenseCount int
+}
+
+// categoryTotalsScope selects the expenses loadCategoryTotals adds up. An empty ProjectID
+// covers all of the user's projects; From and To, when set, bound the expense date
+// inclusively and leave out undated expenses.
+type categoryTotalsScope struct {
+	ProjectID string
+	From, To  *time.Time
+}
+
+// loadCategoryTotals returns the category totals of the scope's expenses as a tree, split
+// into the deductible (business-use) and personal portions and converted to currency. Rows
+// with no usable exchange rate are left out and counted. The tree is the project's category
+// list, or all active categories across projects; categories with no expenses in their
+// subtree are omitted, and a deleted or out-of-list category that still has expenses is kept.
+func loadCategoryTotals(ctx context.Context, scope categoryTotalsScope, currency string) ([]*categoryTotal, error) {
+	rows, err := database.Pool.Query(ctx, `
+		SELECT ec.id, ec.name, ec.parent_id, ec.sort_order,
+		       COALESCE(SUM(x.converted_amount), 0) AS total_amount,
+		       COALESCE(ROUND(SUM(x.converted_amount * x.business_pct / 100), 2), 0) AS deductible_amount,
+		       COALESCE(SUM(x.converted_amount), 0)
+		         - COALESCE(ROUND(SUM(x.converted_amount * x.business_pct / 100), 2), 0) AS personal_amount,
+		       COUNT(*) FILTER (WHERE x.amount IS NOT NULL AND x.converted_amount IS NULL) AS unconverted_count,
+		       COUNT(x.accepted_category_id) AS expense_count
+		FROM expense_category ec
+		LEFT JOIN (
+			SELECT e.accepted_category_id, e.amount,
+			       COALESCE(e.business_pct, c.default_business_pct, 100) AS business_pct,
+			       convert_amount(p.user_id, e.amount, COALESCE(e.currency, p.currency), $3, e.expense_date) AS converted_amount
+			FROM expense e
+			JOIN project p ON e.project_id = p.id
+			JOIN expense_category c ON e.accepted_category_id = c.id
+			WHERE p.user_id = $1
+			  AND (NULLIF($2, '')::bigint IS NULL OR e.project_id = NULLIF($2, '')::bigint)
+			  AND ($4::date IS NULL OR e.expense_date >= $4::date)
+			  AND ($5::date IS NULL OR e.expense_date <= $5::date)
+			  AND e.deleted_at IS NULL
+			  AND e.transfer_id IS NULL
+		) x ON x.accepted_category_id = ec.id
+		WHERE ec.user_id = $1
+		  AND (CASE WHEN NULLIF($2, '') IS NULL THEN ec.deleted_at IS NULL
+		            ELSE ec.id IN (SELECT id FROM project_categories(NULLIF($2, '')::bigint)) END
+		       OR x.accepted_category_id IS NOT NULL)
+		GROUP BY ec.id
+	`, models.TEST_USER_ID, scope.ProjectID, currency, scope.From, scope.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []*categoryTotal
+	for rows.Next() {
+		total := &categoryTotal{Currency: currency, Children: []*categoryTotal{}}
+		err := rows.Scan(&total.CategoryID, &total.CategoryName, &total.ParentID, &total.sortOrder,
+			&total.OwnTotalAmount, &total.OwnDeductibleAmount, &total.OwnPersonalAmount, &total.UnconvertedCount, &total.expenseCount)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildCategoryTotalsTree(all), nil
+}
+
+// buildCategoryTotalsTree links categories under their parents and rolls up the tree. A
+// category whose parent isn't among them is a root.
+func buildCategoryTotalsTree(all []*categoryTotal) []*categoryTotal {
+	byID := make(map[int64]*categoryTotal, len(all))
+	for _, total := range all {
+		byID[total.CategoryID] = total
+	}
+
+	roots := []*categoryTotal{}
+	for _, total := range all {
+		if total.ParentID != nil {
+			if parent, ok := byID[*total.ParentID]; ok {
+				parent.Children = append(parent.Children, total)
+				continue
+			}
+		}
+		roots = append(roots, total)
+	}
+
+	return rollUpCategoryTotals(roots, "", 0)
+}
+
+// rollUpCategoryTotals orders siblings, fills in paths and subtree totals, and drops
+// subtrees without expenses
+func rollUpCategoryTotals(totals []*categoryTotal, parentPath string, depth int) []*categoryTotal {
+	sort.SliceStable(totals, func(i, j int) bool {
+		if totals[i].sortOrder != totals[j].sortOrder {
+			return totals[i].sortOrder < totals[j].sortOrder
+		}
+		return totals[i].CategoryID < totals[j].CategoryID
+	})
+
+	kept := []*categoryTotal{}
+	for _, total := range totals {
+		total.Depth = depth
+		total.Path = total.CategoryName
+		if parentPath != "" {
+			total.Path = parentPath + categoryPathSeparator + total.CategoryName
+		}
+
+		total.Children = rollUpCategoryTotals(total.Children, total.Path, depth+1)
+		total.TotalAmount = total.OwnTotalAmount
+		total.DeductibleAmount = total.OwnDeductibleAmount
+		total.PersonalAmount = total.OwnPersonalAmount
+		for _, child := range total.Children {
+			total.TotalAmount += child.TotalAmount
+			total.DeductibleAmount += child.DeductibleAmount
+			total.PersonalAmount += child.PersonalAmount
+			total.UnconvertedCount += child.UnconvertedCount
+			total.expenseCount += child.expenseCount
+		}
+
+		if total.expenseCount > 0 {
+			kept = append(kept, total)
+		}
+	}
+	return kept
+}
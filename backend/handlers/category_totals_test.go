@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"ookkee/models"
+)
+
+// numericSum adds decimal strings exactly, as Postgres' SUM(amount) does
+func numericSum(t *testing.T, amounts []string) *big.Rat {
+	sum := new(big.Rat)
+	for _, text := range amounts {
+		value, ok := new(big.Rat).SetString(text)
+		if !ok {
+			t.Fatalf("bad amount %q", text)
+		}
+		sum.Add(sum, value)
+	}
+	return sum
+}
+
+// TestCategoryTotalsCSVMatchSum runs many cent amounts through the totals tree and the CSV
+// rows and checks every amount written matches the exact sum to the cent
+func TestCategoryTotalsCSVMatchSum(t *testing.T) {
+	amounts := []string{"-0.10", "-0.20", "-19.99", "3.33", "-1234567.89", "-0.01", "-0.07"}
+	parentID := int64(1)
+	categories := []*categoryTotal{
+		{CategoryID: 1, CategoryName: "Software"},
+		{CategoryID: 2, CategoryName: "SaaS", ParentID: &parentID},
+		{CategoryID: 3, CategoryName: "Hosting", ParentID: &parentID},
+		{CategoryID: 4, CategoryName: "Travel"},
+	}
+
+	// Spread the rows over the categories; a third of each category's rows are personal
+	deductible := make([][]string, len(categories))
+	personal := make([][]string, len(categories))
+	for i := 0; i < 100000; i++ {
+		c := i % len(categories)
+		if i%3 == 0 {
+			personal[c] = append(personal[c], amounts[i%len(amounts)])
+		} else {
+			deductible[c] = append(deductible[c], amounts[i%len(amounts)])
+		}
+	}
+
+	exactDeductible, exactPersonal := new(big.Rat), new(big.Rat)
+	for i, category := range categories {
+		own, ownPersonal := numericSum(t, deductible[i]), numericSum(t, personal[i])
+		exactDeductible.Add(exactDeductible, own)
+		exactPersonal.Add(exactPersonal, ownPersonal)
+
+		// Scan the sums the way pgx hands them over from the totals query
+		for _, field := range []struct {
+			sum    *big.Rat
+			target interface{ ScanNumeric(pgtype.Numeric) error }
+		}{{own, &category.OwnDeductibleAmount}, {ownPersonal, &category.OwnPersonalAmount}} {
+			var numeric pgtype.Numeric
+			if err := numeric.Scan(field.sum.FloatString(2)); err != nil {
+				t.Fatalf("numeric scan: %v", err)
+			}
+			if err := field.target.ScanNumeric(numeric); err != nil {
+				t.Fatalf("ScanNumeric: %v", err)
+			}
+		}
+		category.expenseCount = len(deductible[i]) + len(personal[i])
+	}
+	categories[0].Children = []*categoryTotal{categories[1], categories[2]}
+	roots := rollUpCategoryTotals([]*categoryTotal{categories[0], categories[3]}, "", 0)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(categoryTotalsCSVRows(roots, "USD")); err != nil {
+		t.Fatalf("WriteAll: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+
+	// Header, Software, SaaS, Hosting, Travel, Total
+	if len(rows) != 6 {
+		t.Fatalf("got %d CSV rows, want 6: %v", len(rows), rows)
+	}
+	want := map[string][2]*big.Rat{
+		"Software > SaaS":    {numericSum(t, deductible[1]), numericSum(t, personal[1])},
+		"Software > Hosting": {numericSum(t, deductible[2]), numericSum(t, personal[2])},
+		"Travel":             {numericSum(t, deductible[3]), numericSum(t, personal[3])},
+		"Software": {
+			numericSum(t, append(append(append([]string{}, deductible[0]...), deductible[1]...), deductible[2]...)),
+			numericSum(t, append(append(append([]string{}, personal[0]...), personal[1]...), personal[2]...)),
+		},
+		"Total": {exactDeductible, exactPersonal},
+	}
+	for _, row := range rows[1:] {
+		sums, ok := want[row[0]]
+		if !ok {
+			t.Errorf("unexpected row %v", row)
+			continue
+		}
+		if row[2] != sums[0].FloatString(2) || row[3] != sums[1].FloatString(2) {
+			t.Errorf("%s: deductible %s, personal %s, want %s, %s", row[0], row[2], row[3],
+				sums[0].FloatString(2), sums[1].FloatString(2))
+		}
+		if len(row) != 5 {
+			t.Errorf("%s: %d fields, want 5", row[0], len(row))
+		}
+	}
+}
+
+// flatTotal is a category as the totals query returns it, before the tree is built
+func flatTotal(id, parentID int64, name string, sortOrder int, cents int64, expenses, unconverted int) *categoryTotal {
+	total := &categoryTotal{CategoryID: id, CategoryName: name, sortOrder: sortOrder,
+		OwnTotalAmount: models.MoneyFromCents(cents), OwnDeductibleAmount: models.MoneyFromCents(cents),
+		UnconvertedCount: unconverted, expenseCount: expenses, Children: []*categoryTotal{}}
+	if parentID != 0 {
+		total.ParentID = &parentID
+	}
+	return total
+}
+
+// describeTotals lists a tree parents first as "path depth total deductible unconverted"
+func describeTotals(totals []*categoryTotal) []string {
+	var lines []string
+	for _, total := range totals {
+		lines = append(lines, fmt.Sprintf("%s %d %s %s %d", total.Path, total.Depth, total.TotalAmount,
+			total.DeductibleAmount, total.UnconvertedCount))
+		lines = append(lines, describeTotals(total.Children)...)
+	}
+	return lines
+}
+
+func TestBuildCategoryTotalsTree(t *testing.T) {
+	tests := []struct {
+		name string
+		all  []*categoryTotal
+		want []string
+	}{
+		{
+			"nested subtotals",
+			[]*categoryTotal{
+				flatTotal(1, 0, "Travel", 0, -1000, 1, 0),
+				flatTotal(2, 1, "Airfare", 0, -25000, 2, 1),
+				flatTotal(3, 2, "Upgrades", 0, -5000, 1, 0),
+				flatTotal(4, 1, "Hotels", 1, -12000, 1, 0),
+			},
+			[]string{
+				"Travel 0 -430.00 -430.00 1",
+				"Travel > Airfare 1 -300.00 -300.00 1",
+				"Travel > Airfare > Upgrades 2 -50.00 -50.00 0",
+				"Travel > Hotels 1 -120.00 -120.00 0",
+			},
+		},
+		{
+			"orphan becomes a root",
+			[]*categoryTotal{
+				flatTotal(5, 99, "Meals", 1, -4000, 3, 0),
+				flatTotal(6, 0, "Office", 0, -2000, 1, 0),
+			},
+			[]string{
+				"Office 0 -20.00 -20.00 0",
+				"Meals 0 -40.00 -40.00 0",
+			},
+		},
+		{
+			"empty subtrees dropped",
+			[]*categoryTotal{
+				flatTotal(7, 0, "Software", 0, 0, 0, 0),
+				flatTotal(8, 7, "SaaS", 0, -999, 1, 0),
+				flatTotal(9, 7, "Licenses", 1, 0, 0, 0),
+				flatTotal(10, 0, "Unused", 1, 0, 0, 0),
+				flatTotal(11, 10, "Also unused", 0, 0, 0, 0),
+			},
+			[]string{
+				"Software 0 -9.99 -9.99 0",
+				"Software > SaaS 1 -9.99 -9.99 0",
+			},
+		},
+		{
+			"siblings ordered by sort order then ID",
+			[]*categoryTotal{
+				flatTotal(13, 0, "B", 0, -100, 1, 0),
+				flatTotal(12, 0, "C", 1, -100, 1, 0),
+				flatTotal(14, 0, "A", 0, -100, 1, 0),
+			},
+			[]string{
+				"B 0 -1.00 -1.00 0",
+				"A 0 -1.00 -1.00 0",
+				"C 0 -1.00 -1.00 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := describeTotals(buildCategoryTotalsTree(tt.all)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: tree = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// defaultCurrency is used for projects uploaded without one
+const defaultCurrency = "USD"
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// errInvalidCurrency is wrapped by normalizeCurrency's validation errors
+var errInvalidCurrency = errors.New("invalid currency code")
+
+// normalizeCurrency upper-cases and validates an ISO 4217 currency code
+func normalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !currencyCodePattern.MatchString(code) {
+		return "", fmt.Errorf("%w: %q", errInvalidCurrency, code)
+	}
+	return code, nil
+}
+
+// reportCurrency returns the currency a project's reports are shown in: the currency query
+// param when given, otherwise the project's own currency
+func reportCurrency(ctx context.Context, r *http.Request, projectID string) (string, error) {
+	if requested := r.URL.Query().Get("currency"); requested != "" {
+		return normalizeCurrency(requested)
+	}
+
+	var currency string
+	err := database.Pool.QueryRow(ctx, `
+		SELECT currency FROM project WHERE id = $1 AND user_id = $2
+	`, projectID, models.TEST_USER_ID).Scan(&currency)
+	return currency, err
+}
+
+// writeReportCurrencyError maps a reportCurrency failure to a response: an unknown project
+// is a 404, an invalid currency a 400 and anything else a server error
+func writeReportCurrencyError(w http.ResponseWriter, err error) {
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errInvalidCurrency) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to get report currency: %v", err), http.StatusInternalServerError)
+}
+
+// parseRateDate accepts ISO dates and US-style month/day/year dates
+func parseRateDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "2006/01/02", "01/02/2006", "1/2/2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %q", value)
+}
+
+// upsertExchangeRate stores a rate, replacing any existing rate for the same pair and day
+func upsertExchangeRate(ctx context.Context, q dbQuerier, rate *models.ExchangeRate) error {
+	return q.QueryRow(ctx, `
+		INSERT INTO exchange_rate (user_id, rate_date, base_currency, quote_currency, rate)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, base_currency, quote_currency, rate_date) DO UPDATE
+		SET rate = EXCLUDED.rate, updated_at = NOW()
+		RETURNING id, updated_at
+	`, models.TEST_USER_ID, rate.RateDate, rate.BaseCurrency, rate.QuoteCurrency, rate.Rate).Scan(&rate.ID, &rate.UpdatedAt)
+}
+
+// GetExchangeRates lists the user's rates. Optional filters: base, quote, from, to (dates).
+func GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	var base, quote *string
+	for param, target := range map[string]**string{"base": &base, "quote": &quote} {
+		if value := query.Get(param); value != "" {
+			code, err := normalizeCurrency(value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			*target = &code
+		}
+	}
+
+	var from, to *time.Time
+	for param, target := range map[string]**time.Time{"from": &from, "to": &to} {
+		if value := query.Get(param); value != "" {
+			date, err := parseRateDate(value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			*target = &date
+		}
+	}
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT id, rate_date, base_currency, quote_currency, rate, updated_at
+		FROM exchange_rate
+		WHERE user_id = $1
+		  AND ($2::text IS NULL OR base_currency = $2)
+		  AND ($3::text IS NULL OR quote_currency = $3)
+		  AND ($4::date IS NULL OR rate_date >= $4)
+		  AND ($5::date IS NULL OR rate_date <= $5)
+		ORDER BY base_currency, quote_currency, rate_date DESC
+	`, models.TEST_USER_ID, base, quote, from, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch exchange rates: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		var rate models.ExchangeRate
+		err := rows.Scan(&rate.ID, &rate.RateDate, &rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.UpdatedAt)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to scan exchange rate: %v", err), http.StatusInternalServerError)
+			return
+		}
+		rates = append(rates, rate)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// CreateExchangeRate adds or replaces a single daily rate
+func CreateExchangeRate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		RateDate      string      `json:"rate_date"`
+		BaseCurrency  string      `json:"base_currency"`
+		QuoteCurrency string      `json:"quote_currency"`
+		Rate          models.Rate `json:"rate"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	rate, err := buildExchangeRate(req.RateDate, req.BaseCurrency, req.QuoteCurrency, req.Rate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := upsertExchangeRate(ctx, database.Pool, &rate); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save exchange rate: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rate)
+}
+
+// buildExchangeRate validates the parts of a rate
+func buildExchangeRate(dateText, base, quote string, value models.Rate) (models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	var err error
+	if rate.RateDate, err = parseRateDate(dateText); err != nil {
+		return rate, err
+	}
+	if rate.BaseCurrency, err = normalizeCurrency(base); err != nil {
+		return rate, err
+	}
+	if rate.QuoteCurrency, err = normalizeCurrency(quote); err != nil {
+		return rate, err
+	}
+	if rate.BaseCurrency == rate.QuoteCurrency {
+		return rate, fmt.Errorf("base and quote currency must differ")
+	}
+	if value <= 0 {
+		return rate, fmt.Errorf("rate must be positive")
+	}
+	rate.Rate = value
+	return rate, nil
+}
+
+// ImportExchangeRates loads daily rates from an uploaded CSV (form field csvFile). Two
+// layouts are accepted:
+//   - long: date, base, quote, rate columns (one rate per row)
+//   - wide: a date column plus one column per currency holding units per 1 of the form
+//     field base (default USD), as most central bank downloads are laid out
+//
+// Rows that don't parse are skipped and reported.
+func ImportExchangeRates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("csvFile")
+	if err != nil {
+		http.Error(w, "No file uploaded", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read CSV: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(records) < 2 {
+		http.Error(w, "CSV must have at least a header and one data row", http.StatusBadRequest)
+		return
+	}
+
+	columns := make(map[string]int)
+	for i, header := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+
+	dateColumn, ok := columns["date"]
+	if !ok {
+		http.Error(w, "CSV must have a date column", http.StatusBadRequest)
+		return
+	}
+
+	var rates []models.ExchangeRate
+	var skipped []string
+	skip := func(line int, err error) {
+		skipped = append(skipped, fmt.Sprintf("line %d: %v", line, err))
+	}
+
+	_, hasRate := columns["rate"]
+	if hasRate {
+		baseColumn, hasBase := columns["base"]
+		quoteColumn, hasQuote := columns["quote"]
+		if !hasBase || !hasQuote {
+			http.Error(w, "CSV with a rate column must also have base and quote columns", http.StatusBadRequest)
+			return
+		}
+		for i, record := range records[1:] {
+			value, err := models.ParseRate(record[columns["rate"]])
+			if err != nil {
+				skip(i+2, fmt.Errorf("invalid rate"))
+				continue
+			}
+			rate, err := buildExchangeRate(record[dateColumn], record[baseColumn], record[quoteColumn], value)
+			if err != nil {
+				skip(i+2, err)
+				continue
+			}
+			rates = append(rates, rate)
+		}
+	} else {
+		base := r.FormValue("base")
+		if base == "" {
+			base = defaultCurrency
+		}
+		for i, record := range records[1:] {
+			for j, header := range records[0] {
+				if j == dateColumn || strings.TrimSpace(record[j]) == "" {
+					continue
+				}
+				value, err := models.ParseRate(record[j])
+				if err != nil {
+					skip(i+2, fmt.Errorf("invalid rate for %s", header))
+					continue
+				}
+				rate, err := buildExchangeRate(record[dateColumn], base, header, value)
+				if err != nil {
+					skip(i+2, err)
+					continue
+				}
+				rates = append(rates, rate)
+			}
+		}
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	for i := range rates {
+		if err := upsertExchangeRate(ctx, tx, &rates[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to save exchange rate: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  fmt.Sprintf("Imported %d exchange rates", len(rates)),
+		"imported": len(rates),
+		"skipped":  skipped,
+	})
+}
+
+// DeleteExchangeRate removes a single rate
+func DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rateID := chi.URLParam(r, "rateID")
+	if rateID == "" {
+		http.Error(w, "Rate ID is required", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := database.Pool.Exec(ctx, `
+		DELETE FROM exchange_rate WHERE id = $1 AND user_id = $2
+	`, rateID, models.TEST_USER_ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete exchange rate: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Exchange rate not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Exchange rate deleted successfully"}`))
+}
@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// expenseUpdateRequest holds the user-editable expense fields. A category ID or business
+// percentage of -1 clears the field. is_personal is shorthand for 0% (true) or 100% (false)
+// business use.
+type expenseUpdateRequest struct {
+	AcceptedCategoryID  *int  `json:"accepted_category_id"`
+	SuggestedCategoryID *int  `json:"suggested_category_id"`
+	IsPersonal          *bool `json:"is_personal"`
+	BusinessPct         *int  `json:"business_pct"`
+
+	// PropagateIDs limits auto-propagation to these expenses (from a propagation preview),
+	// and the overrides replace the saved settings as they did for the preview
+	PropagateIDs []int64 `json:"propagate_ids,omitempty"`
+	propagationOverrides
+}
+
+// expenseUpdateResult describes what applyExpenseUpdate changed
+type expenseUpdateResult struct {
+	ProjectID  int64
+	Version    int
+	Change     expenseChange
+	Propagated []expenseChange
+}
+
+// versionConflictError is returned when an expense's version no longer matches If-Match
+type versionConflictError struct {
+	Current models.Expense
+}
+
+func (e *versionConflictError) Error() string {
+	return fmt.Sprintf("expense %d was modified (current version %d)", e.Current.ID, e.Current.Version)
+}
+
+// errNoFieldsToUpdate is returned for an update request with no fields set
+var errNoFieldsToUpdate = fmt.Errorf("no fields to update")
+
+// validate checks field values that don't need the database
+func (req expenseUpdateRequest) validate() error {
+	if req.IsPersonal != nil && req.BusinessPct != nil {
+		return fmt.Errorf("set either is_personal or business_pct, not both")
+	}
+	if req.BusinessPct != nil && *req.BusinessPct != -1 && (*req.BusinessPct < 0 || *req.BusinessPct > 100) {
+		return fmt.Errorf("business_pct must be between 0 and 100")
+	}
+	_, err := req.propagationOverrides.apply(defaultUserSettings)
+	return err
+}
+
+// parseIfMatch extracts the expected row version from an If-Match header.
+// Returns nil when the header is absent or "*" (no precondition).
+func parseIfMatch(r *http.Request) (*int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	tag = strings.Trim(tag, `"`)
+	version, err := strconv.Atoi(tag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid If-Match header: %s", header)
+	}
+	return &version, nil
+}
+
+// expenseETag formats a row version as a strong ETag
+func expenseETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// loadExpense reads a full expense row within a transaction
+func loadExpense(ctx context.Context, tx pgx.Tx, expenseID int64) (models.Expense, error) {
+	var expense models.Expense
+	err := tx.QueryRow(ctx, `
+		SELECT id, project_id, row_index, raw_data, source, date_text, description, amount,
+		       suggested_category_id, accepted_category_id, COALESCE(is_personal, FALSE), business_pct, is_manual, transfer_id, refund_of_expense_id, vendor_id, currency, tags, version
+		FROM expense
+		WHERE id = $1
+	`, expenseID).Scan(&expense.ID, &expense.ProjectID, &expense.RowIndex, &expense.RawData,
+		&expense.Source, &expense.DateText, &expense.Description, &expense.Amount, &expense.SuggestedCategoryID,
+		&expense.AcceptedCategoryID, &expense.IsPersonal, &expense.BusinessPct, &expense.IsManual, &expense.TransferID, &expense.RefundOfExpenseID, &expense.VendorID, &expense.Currency, &expense.Tags, &expense.Version)
+	return expense, err
+}
+
+// writeVersionConflict responds 409 with the row's current state so the client can merge
+func writeVersionConflict(w http.ResponseWriter, conflicts ...models.Expense) {
+	w.Header().Set("Content-Type", "application/json")
+	if len(conflicts) == 1 {
+		w.Header().Set("ETag", expenseETag(conflicts[0].Version))
+	}
+	w.WriteHeader(http.StatusConflict)
+
+	response := map[string]interface{}{
+		"error":     "Expense was modified by someone else",
+		"conflicts": conflicts,
+	}
+	if len(conflicts) == 1 {
+		response["current"] = conflicts[0]
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// applyExpenseUpdate updates one expense inside tx, optionally checking its version and
+// propagating a newly accepted category to identical descriptions. The caller records
+// the change set and history.
+func applyExpenseUpdate(ctx context.Context, tx pgx.Tx, expenseID int64, req expenseUpdateRequest, expectedVersion *int, propagate bool) (*expenseUpdateResult, error) {
+	// Get the current expense details for auto-propagation and undo
+	var currentExpense struct {
+		ProjectID   int
+		Description string
+		Amount      *models.Money
+		VendorID    *int64
+		Version     int
+		State       expenseState
+	}
+
+	err := tx.QueryRow(ctx, `
+		SELECT project_id, COALESCE(description, ''), amount, vendor_id, version,
+		       accepted_category_id, suggested_category_id, COALESCE(is_personal, FALSE), business_pct
+		FROM expense
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, expenseID).Scan(&currentExpense.ProjectID, &currentExpense.Description, &currentExpense.Amount, &currentExpense.VendorID, &currentExpense.Version,
+		&currentExpense.State.AcceptedCategoryID, &currentExpense.State.SuggestedCategoryID, &currentExpense.State.IsPersonal, &currentExpense.State.BusinessPct)
+	if err != nil {
+		return nil, err
+	}
+
+	if expectedVersion != nil && *expectedVersion != currentExpense.Version {
+		current, err := loadExpense(ctx, tx, expenseID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &versionConflictError{Current: current}
+	}
+
+	for _, categoryID := range []*int{req.AcceptedCategoryID, req.SuggestedCategoryID} {
+		if categoryID != nil && *categoryID != -1 {
+			if err := checkProjectCategory(ctx, tx, int64(currentExpense.ProjectID), int64(*categoryID)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Build dynamic update query based on provided fields
+	updateFields := []string{}
+	args := []interface{}{}
+	argIndex := 1
+
+	if req.AcceptedCategoryID != nil {
+		if *req.AcceptedCategoryID == -1 {
+			// -1 means clear the field
+			updateFields = append(updateFields, "accepted_category_id = NULL")
+			updateFields = append(updateFields, "accepted_at = NULL")
+		} else {
+			updateFields = append(updateFields, fmt.Sprintf("accepted_category_id = $%d", argIndex))
+			args = append(args, req.AcceptedCategoryID)
+			argIndex++
+			updateFields = append(updateFields, "accepted_at = CURRENT_TIMESTAMP")
+		}
+	}
+
+	if req.SuggestedCategoryID != nil {
+		if *req.SuggestedCategoryID == -1 {
+			// -1 means clear the field
+			updateFields = append(updateFields, "suggested_category_id = NULL")
+			updateFields = append(updateFields, "suggested_at = NULL")
+		} else {
+			updateFields = append(updateFields, fmt.Sprintf("suggested_category_id = $%d", argIndex))
+			args = append(args, req.SuggestedCategoryID)
+			argIndex++
+			updateFields = append(updateFields, "suggested_at = CURRENT_TIMESTAMP")
+		}
+	}
+
+	// is_personal and business_pct are kept in step: personal means 0% business use
+	if req.IsPersonal != nil {
+		updateFields = append(updateFields, fmt.Sprintf("is_personal = $%d", argIndex))
+		updateFields = append(updateFields, fmt.Sprintf("business_pct = CASE WHEN $%d THEN 0 ELSE 100 END", argIndex))
+		args = append(args, *req.IsPersonal)
+		argIndex++
+	}
+
+	if req.BusinessPct != nil {
+		if *req.BusinessPct == -1 {
+			// -1 means fall back to the category default
+			updateFields = append(updateFields, "business_pct = NULL")
+			updateFields = append(updateFields, "is_personal = FALSE")
+		} else {
+			updateFields = append(updateFields, fmt.Sprintf("business_pct = $%d::smallint", argIndex))
+			updateFields = append(updateFields, fmt.Sprintf("is_personal = ($%d::smallint = 0)", argIndex))
+			args = append(args, *req.BusinessPct)
+			argIndex++
+		}
+	}
+
+	if len(updateFields) == 0 {
+		return nil, errNoFieldsToUpdate
+	}
+
+	updateFields = append(updateFields, "version = version + 1")
+
+	// Add expense ID as final parameter
+	args = append(args, expenseID)
+
+	// Execute update, reading back the new state for the undo record
+	updateQuery := fmt.Sprintf(`
+		UPDATE expense
+		SET %s
+		WHERE id = $%d
+		RETURNING id, version, accepted_category_id, suggested_category_id, COALESCE(is_personal, FALSE), business_pct
+	`, strings.Join(updateFields, ", "), argIndex)
+
+	result := &expenseUpdateResult{
+		ProjectID:  int64(currentExpense.ProjectID),
+		Change:     expenseChange{Old: currentExpense.State},
+		Propagated: []expenseChange{},
+	}
+	err = tx.QueryRow(ctx, updateQuery, args...).Scan(&result.Change.ExpenseID, &result.Version,
+		&result.Change.New.AcceptedCategoryID, &result.Change.New.SuggestedCategoryID, &result.Change.New.IsPersonal,
+		&result.Change.New.BusinessPct)
+	if err != nil {
+		return nil, err
+	}
+
+	// Linked refunds always follow their purchase's category so the two net out
+	if req.AcceptedCategoryID != nil && *req.AcceptedCategoryID != -1 {
+		refunds, err := syncRefundCategories(ctx, tx, expenseID, int64(*req.AcceptedCategoryID))
+		if err != nil {
+			return nil, err
+		}
+		result.Propagated = append(result.Propagated, refunds...)
+	}
+
+	// Auto-propagate accepted category to matching descriptions per the user's settings.
+	// Propagation runs in a savepoint so a failure there doesn't roll back the main update.
+	if propagate && req.AcceptedCategoryID != nil && *req.AcceptedCategoryID != -1 {
+		settings, err := loadUserSettings(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		if settings, err = req.propagationOverrides.apply(settings); err != nil {
+			return nil, err
+		}
+
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		source := propagationSource{
+			ExpenseID:   expenseID,
+			ProjectID:   int64(currentExpense.ProjectID),
+			Description: currentExpense.Description,
+			Amount:      currentExpense.Amount,
+			VendorID:    currentExpense.VendorID,
+		}
+		propagated, err := propagateAcceptedCategory(ctx, savepoint, settings, source,
+			*req.AcceptedCategoryID, req.PropagateIDs)
+		if err == nil {
+			err = savepoint.Commit(ctx)
+		}
+		if err != nil {
+			// Log error but don't fail the main update
+			log.Printf("Failed to propagate category: %v", err)
+			savepoint.Rollback(ctx)
+			propagated = []expenseChange{}
+		}
+		result.Propagated = append(result.Propagated, propagated...)
+	}
+
+	return result, nil
+}
+
+// recordExpenseUpdates stores the undo change set and audit history for a batch of updates
+func recordExpenseUpdates(ctx context.Context, tx pgx.Tx, projectID int64, action string, results []*expenseUpdateResult) (int64, error) {
+	var changes []expenseChange
+	for _, result := range results {
+		changes = append(changes, result.Change)
+		changes = append(changes, result.Propagated...)
+	}
+
+	changeSetID, err := recordChangeSet(ctx, tx, projectID, action, changes)
+	if err != nil {
+		return 0, err
+	}
+
+	// Audit trail: field-level events for edited rows, propagate events for the rest
+	var history []historyEntry
+	for _, result := range results {
+		history = append(history, changeHistoryEntries(result.Change, changeSetID, nil)...)
+		for _, propagatedChange := range result.Propagated {
+			history = append(history, changeHistoryEntries(propagatedChange, changeSetID, &result.Change.ExpenseID)...)
+		}
+	}
+	if err := recordHistory(ctx, tx, history...); err != nil {
+		return 0, err
+	}
+
+	return changeSetID, nil
+}
+
+// BulkUpdateExpenses applies several expense updates in one transaction. Each item carries
+// the version the client last saw; if any row has moved on, nothing is applied and the
+// current state of every conflicting row is returned with 409. The whole batch is a single
+// undo step. Bulk updates do not auto-propagate, and each expense may be listed only once.
+func BulkUpdateExpenses(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectIDStr := chi.URLParam(r, "projectID")
+	projectID, err := strconv.ParseInt(projectIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Updates []struct {
+			ID      int64 `json:"id"`
+			Version *int  `json:"version"`
+			expenseUpdateRequest
+		} `json:"updates"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Updates) == 0 {
+		http.Error(w, "No updates provided", http.StatusBadRequest)
+		return
+	}
+
+	seen := make(map[int64]bool, len(req.Updates))
+	for _, update := range req.Updates {
+		if seen[update.ID] {
+			http.Error(w, fmt.Sprintf("Expense %d is listed more than once", update.ID), http.StatusBadRequest)
+			return
+		}
+		seen[update.ID] = true
+		if err := update.validate(); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid update for expense %d: %v", update.ID, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var results []*expenseUpdateResult
+	var conflicts []models.Expense
+	for _, update := range req.Updates {
+		result, err := applyExpenseUpdate(ctx, tx, update.ID, update.expenseUpdateRequest, update.Version, false)
+		if conflict, ok := err.(*versionConflictError); ok {
+			conflicts = append(conflicts, conflict.Current)
+			continue
+		}
+		if err == pgx.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Expense %d not found", update.ID), http.StatusNotFound)
+			return
+		}
+		if err == errNoFieldsToUpdate {
+			http.Error(w, fmt.Sprintf("No fields to update for expense %d", update.ID), http.StatusBadRequest)
+			return
+		}
+		if err == errCategoryNotInProject {
+			http.Error(w, fmt.Sprintf("Category for expense %d is not in the project's category list", update.ID), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update expense %d: %v", update.ID, err), http.StatusInternalServerError)
+			return
+		}
+		if result.ProjectID != projectID {
+			http.Error(w, fmt.Sprintf("Expense %d does not belong to project %d", update.ID, projectID), http.StatusBadRequest)
+			return
+		}
+		results = append(results, result)
+	}
+
+	if len(conflicts) > 0 {
+		writeVersionConflict(w, conflicts...)
+		return
+	}
+
+	changeSetID, err := recordExpenseUpdates(ctx, tx, projectID, changeActionBulkUpdate, results)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to record changes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	versions := make(map[string]int, len(results))
+	for _, result := range results {
+		versions[strconv.FormatInt(result.Change.ExpenseID, 10)] = result.Version
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       fmt.Sprintf("Updated %d expenses", len(results)),
+		"change_set_id": changeSetID,
+		"versions":      versions,
+	})
+}
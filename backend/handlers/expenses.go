@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// CreateExpense adds a manually entered expense (cash purchase, missing transaction) to a project
+func CreateExpense(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID := chi.URLParam(r, "projectID")
+	if projectID == "" {
+		http.Error(w, "Project ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Source             *string       `json:"source"`
+		DateText           *string       `json:"date_text"`
+		Description        *string       `json:"description"`
+		Amount             *models.Money `json:"amount"`
+		AcceptedCategoryID *int64        `json:"accepted_category_id"`
+		IsPersonal         bool          `json:"is_personal"`
+		BusinessPct        *int          `json:"business_pct"`
+		Currency           *string       `json:"currency"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Description == nil || *req.Description == "" {
+		http.Error(w, "Description is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount == nil {
+		http.Error(w, "Amount is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.BusinessPct != nil && (*req.BusinessPct < 0 || *req.BusinessPct > 100) {
+		http.Error(w, "business_pct must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+	if req.IsPersonal {
+		personalPct := 0
+		req.BusinessPct = &personalPct
+	}
+	if req.BusinessPct != nil {
+		req.IsPersonal = *req.BusinessPct == 0
+	}
+
+	// Mirror the CSV column names so manual rows look like imported ones in raw_data
+	rawData := map[string]interface{}{
+		"Description": *req.Description,
+		"Amount":      req.Amount.String(),
+	}
+	if req.Source != nil {
+		rawData["Source"] = *req.Source
+	}
+	if req.DateText != nil {
+		rawData["Date"] = *req.DateText
+	}
+	if req.Currency != nil {
+		code, err := normalizeCurrency(*req.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Currency = &code
+		rawData["Currency"] = code
+	}
+
+	rawDataJSON, err := json.Marshal(rawData)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to marshal raw data: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the project row so concurrent inserts get distinct row indexes
+	var lockedProjectID int64
+	err = tx.QueryRow(ctx, `
+		SELECT id
+		FROM project
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`, projectID, models.TEST_USER_ID).Scan(&lockedProjectID)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if req.AcceptedCategoryID != nil {
+		err := checkProjectCategory(ctx, tx, lockedProjectID, *req.AcceptedCategoryID)
+		if err == errCategoryNotInProject {
+			http.Error(w, "Category is not in the project's category list", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check category: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Manual rows are appended after every existing row, including soft-deleted ones
+	var nextRowIndex int
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(MAX(row_index), -1) + 1
+		FROM expense
+		WHERE project_id = $1
+	`, lockedProjectID).Scan(&nextRowIndex)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get next row index: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var expense models.Expense
+	err = tx.QueryRow(ctx, `
+		INSERT INTO expense (project_id, row_index, raw_data, source, date_text, description, amount,
+		                     accepted_category_id, accepted_at, is_personal, business_pct, is_manual, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8::bigint, CASE WHEN $8::bigint IS NULL THEN NULL ELSE CURRENT_TIMESTAMP END, $9, $10, TRUE, $11)
+		RETURNING id, project_id, row_index, raw_data, source, date_text, description, amount,
+		          suggested_category_id, accepted_category_id, is_personal, business_pct, is_manual, currency, tags, version
+	`, lockedProjectID, nextRowIndex, rawDataJSON, req.Source, req.DateText, req.Description, req.Amount,
+		req.AcceptedCategoryID, req.IsPersonal, req.BusinessPct, req.Currency).Scan(
+		&expense.ID, &expense.ProjectID, &expense.RowIndex, &expense.RawData, &expense.Source, &expense.DateText,
+		&expense.Description, &expense.Amount, &expense.SuggestedCategoryID, &expense.AcceptedCategoryID,
+		&expense.IsPersonal, &expense.BusinessPct, &expense.IsManual, &expense.Currency, &expense.Tags, &expense.Version)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create expense: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := assignVendors(ctx, tx, &lockedProjectID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to assign vendor: %v", err), http.StatusInternalServerError)
+		return
+	}
+	err = tx.QueryRow(ctx, `
+		SELECT vendor_id, suggested_category_id, version FROM expense WHERE id = $1
+	`, expense.ID).Scan(&expense.VendorID, &expense.SuggestedCategoryID, &expense.Version)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get expense vendor: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE project
+		SET row_count = row_count + 1, updated_at = NOW()
+		WHERE id = $1
+	`, lockedProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update project row count: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = recordHistory(ctx, tx, historyEntry{
+		ExpenseID:  expense.ID,
+		EventType:  historyEventCreate,
+		CategoryID: expense.AcceptedCategoryID,
+		NewValue:   rawData,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to record history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", expenseETag(expense.Version))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(expense)
+}
+
+// DeleteExpense soft-deletes an expense and decrements its project's row count
+func DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	setExpenseDeleted(w, r, true)
+}
+
+// RestoreExpense undoes a soft delete and increments its project's row count
+func RestoreExpense(w http.ResponseWriter, r *http.Request) {
+	setExpenseDeleted(w, r, false)
+}
+
+// setExpenseDeleted toggles expense.deleted_at and keeps project.row_count in step
+func setExpenseDeleted(w http.ResponseWriter, r *http.Request, deleted bool) {
+	ctx := r.Context()
+	expenseID := chi.URLParam(r, "expenseID")
+	if expenseID == "" {
+		http.Error(w, "Expense ID is required", http.StatusBadRequest)
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var setDeletedAt string
+	var rowCountDelta int
+	if deleted {
+		setDeletedAt = "deleted_at = NOW()"
+		rowCountDelta = -1
+	} else {
+		setDeletedAt = "deleted_at = NULL"
+		rowCountDelta = 1
+	}
+
+	// Only rows currently in the opposite state are touched, so repeated calls are no-ops
+	var projectID, updatedExpenseID int64
+	var version int
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		UPDATE expense e
+		SET %s, version = e.version + 1
+		FROM project p
+		WHERE e.id = $1
+		  AND e.project_id = p.id
+		  AND p.user_id = $2
+		  AND p.deleted_at IS NULL
+		  AND (e.deleted_at IS NULL) = $3
+		  AND ($4::int IS NULL OR e.version = $4::int)
+		RETURNING e.project_id, e.id, e.version
+	`, setDeletedAt), expenseID, models.TEST_USER_ID, deleted, expectedVersion).Scan(&projectID, &updatedExpenseID, &version)
+	if err == pgx.ErrNoRows && expectedVersion != nil {
+		// Distinguish a stale version from a missing row
+		if id, parseErr := strconv.ParseInt(expenseID, 10, 64); parseErr == nil {
+			if current, loadErr := loadExpense(ctx, tx, id); loadErr == nil && current.Version != *expectedVersion {
+				writeVersionConflict(w, current)
+				return
+			}
+		}
+	}
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update expense: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE project
+		SET row_count = GREATEST(row_count + $1, 0), updated_at = NOW()
+		WHERE id = $2
+	`, rowCountDelta, projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update project row count: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	eventType := historyEventRestore
+	if deleted {
+		eventType = historyEventDelete
+	}
+	err = recordHistory(ctx, tx, historyEntry{
+		ExpenseID: updatedExpenseID,
+		EventType: eventType,
+		OldValue:  map[string]interface{}{"deleted": !deleted},
+		NewValue:  map[string]interface{}{"deleted": deleted},
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to record history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	message := "Expense restored successfully"
+	if deleted {
+		message = "Expense deleted successfully"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", expenseETag(version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    message,
+		"expense_id": expenseID,
+		"project_id": projectID,
+		"version":    version,
+	})
+}
+
+// GetDeletedExpenses lists a project's soft-deleted expenses so they can be restored
+func GetDeletedExpenses(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = database.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM project WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, projectID, models.TEST_USER_ID).Scan(&exists)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT id, project_id, row_index, raw_data, source, date_text, description, amount,
+		       suggested_category_id, accepted_category_id, is_personal, business_pct, is_manual, transfer_id, refund_of_expense_id, vendor_id, currency, tags, version, deleted_at
+		FROM expense
+		WHERE project_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`, projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch deleted expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	expenses := []models.Expense{}
+	for rows.Next() {
+		var expense models.Expense
+		err := rows.Scan(&expense.ID, &expense.ProjectID, &expense.RowIndex, &expense.RawData,
+			&expense.Source, &expense.DateText, &expense.Description, &expense.Amount, &expense.SuggestedCategoryID,
+			&expense.AcceptedCategoryID, &expense.IsPersonal, &expense.BusinessPct, &expense.IsManual, &expense.TransferID, &expense.RefundOfExpenseID, &expense.VendorID, &expense.Currency, &expense.Tags, &expense.Version, &expense.DeletedAt)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to scan expense: %v", err), http.StatusInternalServerError)
+			return
+		}
+		expenses = append(expenses, expense)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(expenses)
+}
+
+// GetExpensesCSV exports every active expense in a project, marking manual entries
+func GetExpensesCSV(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID := chi.URLParam(r, "projectID")
+	if projectID == "" {
+		http.Error(w, "Project ID is required", http.StatusBadRequest)
+		return
+	}
+
+	currency, err := reportCurrency(ctx, r, projectID)
+	if err != nil {
+		writeReportCurrencyError(w, err)
+		return
+	}
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT COALESCE(e.date_text, ''), COALESCE(e.source, ''), COALESCE(e.description, ''), e.amount,
+		       COALESCE(e.currency, p.currency),
+		       convert_amount(p.user_id, e.amount, COALESCE(e.currency, p.currency), $2, e.expense_date),
+		       COALESCE(v.name, ''), COALESCE(ec.name, ''), e.is_personal,
+		       COALESCE(e.business_pct, ec.default_business_pct, 100), e.is_manual
+		FROM expense e
+		JOIN project p ON e.project_id = p.id
+		LEFT JOIN expense_category ec ON e.accepted_category_id = ec.id
+		LEFT JOIN vendor v ON e.vendor_id = v.id
+		WHERE e.project_id = $1 AND e.deleted_at IS NULL
+		ORDER BY e.row_index ASC
+	`, projectID, currency)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=expenses.csv")
+
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Date", "Source", "Description", "Vendor", "Amount", "Currency",
+		fmt.Sprintf("Amount (%s)", currency), "Category", "Personal", "Business %", "Entry"}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to write CSV header: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	for rows.Next() {
+		var dateText, source, description, expenseCurrency, vendorName, categoryName string
+		var amount, convertedAmount *models.Money
+		var isPersonal, isManual bool
+		var businessPct int
+		if err := rows.Scan(&dateText, &source, &description, &amount, &expenseCurrency, &convertedAmount, &vendorName, &categoryName, &isPersonal, &businessPct, &isManual); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to scan expense: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		amountText, convertedText := "", ""
+		if amount != nil {
+			amountText = amount.String()
+		}
+		if convertedAmount != nil {
+			convertedText = convertedAmount.String()
+		}
+
+		entry := "Imported"
+		if isManual {
+			entry = "Manual"
+		}
+
+		if err := writer.Write([]string{
+			dateText,
+			source,
+			description,
+			vendorName,
+			amountText,
+			expenseCurrency,
+			convertedText,
+			categoryName,
+			strconv.FormatBool(isPersonal),
+			strconv.Itoa(businessPct),
+			entry,
+		}); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write CSV row: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
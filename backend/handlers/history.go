@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// Event types written to expense_history.event_type (see V10 CHECK constraint)
+const (
+	historyEventManualAccept   = "manual_accept"
+	historyEventManualClear    = "manual_clear"
+	historyEventEdit           = "edit"
+	historyEventPersonalToggle = "personal_toggle"
+	historyEventPropagate      = "propagate"
+	historyEventCreate         = "create"
+	historyEventDelete         = "delete"
+	historyEventRestore        = "restore"
+	historyEventUndo           = "undo"
+	historyEventRedo           = "redo"
+	historyEventTransferLink   = "transfer_link"
+	historyEventTransferUnlink = "transfer_unlink"
+	historyEventRefundLink     = "refund_link"
+	historyEventRefundUnlink   = "refund_unlink"
+	historyEventCategoryMerge  = "category_merge"
+	historyEventRuleApply      = "rule_apply"
+)
+
+// historyEntry is a single row to be written to expense_history
+type historyEntry struct {
+	ExpenseID   int64
+	EventType   string
+	CategoryID  *int64
+	OldValue    interface{}
+	NewValue    interface{}
+	ChangeSetID *int64
+}
+
+// recordHistory writes audit entries attributed to the current user
+func recordHistory(ctx context.Context, tx pgx.Tx, entries ...historyEntry) error {
+	for _, entry := range entries {
+		oldValue, err := marshalHistoryValue(entry.OldValue)
+		if err != nil {
+			return err
+		}
+		newValue, err := marshalHistoryValue(entry.NewValue)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO expense_history (expense_id, event_type, category_id, actor, old_value, new_value, change_set_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, entry.ExpenseID, entry.EventType, entry.CategoryID, models.TEST_USER_ID, oldValue, newValue, entry.ChangeSetID)
+		if err != nil {
+			return fmt.Errorf("failed to record %s history for expense %d: %w", entry.EventType, entry.ExpenseID, err)
+		}
+	}
+	return nil
+}
+
+// marshalHistoryValue encodes an old/new value as JSONB, keeping nil as SQL NULL
+func marshalHistoryValue(value interface{}) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+// changeHistoryEntries turns an expense change into one audit entry per modified field.
+// Rows changed by propagation are recorded as a single propagate event.
+func changeHistoryEntries(change expenseChange, changeSetID int64, propagatedFrom *int64) []historyEntry {
+	var setID *int64
+	if changeSetID != 0 {
+		setID = &changeSetID
+	}
+
+	if propagatedFrom != nil {
+		return []historyEntry{{
+			ExpenseID:   change.ExpenseID,
+			EventType:   historyEventPropagate,
+			CategoryID:  change.New.AcceptedCategoryID,
+			OldValue:    map[string]interface{}{"accepted_category_id": change.Old.AcceptedCategoryID},
+			NewValue:    map[string]interface{}{"accepted_category_id": change.New.AcceptedCategoryID, "propagated_from": *propagatedFrom},
+			ChangeSetID: setID,
+		}}
+	}
+
+	var entries []historyEntry
+	if !sameCategoryID(change.Old.AcceptedCategoryID, change.New.AcceptedCategoryID) {
+		eventType := historyEventManualAccept
+		if change.New.AcceptedCategoryID == nil {
+			eventType = historyEventManualClear
+		}
+		entries = append(entries, historyEntry{
+			ExpenseID:   change.ExpenseID,
+			EventType:   eventType,
+			CategoryID:  change.New.AcceptedCategoryID,
+			OldValue:    map[string]interface{}{"accepted_category_id": change.Old.AcceptedCategoryID},
+			NewValue:    map[string]interface{}{"accepted_category_id": change.New.AcceptedCategoryID},
+			ChangeSetID: setID,
+		})
+	}
+	if !sameCategoryID(change.Old.SuggestedCategoryID, change.New.SuggestedCategoryID) {
+		entries = append(entries, historyEntry{
+			ExpenseID:   change.ExpenseID,
+			EventType:   historyEventEdit,
+			CategoryID:  change.New.SuggestedCategoryID,
+			OldValue:    map[string]interface{}{"suggested_category_id": change.Old.SuggestedCategoryID},
+			NewValue:    map[string]interface{}{"suggested_category_id": change.New.SuggestedCategoryID},
+			ChangeSetID: setID,
+		})
+	}
+	if change.Old.IsPersonal != change.New.IsPersonal || !samePct(change.Old.BusinessPct, change.New.BusinessPct) {
+		eventType := historyEventEdit
+		if change.Old.IsPersonal != change.New.IsPersonal {
+			eventType = historyEventPersonalToggle
+		}
+		entries = append(entries, historyEntry{
+			ExpenseID:   change.ExpenseID,
+			EventType:   eventType,
+			OldValue:    map[string]interface{}{"is_personal": change.Old.IsPersonal, "business_pct": change.Old.BusinessPct},
+			NewValue:    map[string]interface{}{"is_personal": change.New.IsPersonal, "business_pct": change.New.BusinessPct},
+			ChangeSetID: setID,
+		})
+	}
+	return entries
+}
+
+// sameCategoryID compares two nullable category IDs
+func sameCategoryID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// samePct compares two nullable percentages
+func samePct(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// GetExpenseHistory returns the audit trail for a single expense, newest first
+func GetExpenseHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	expenseID := chi.URLParam(r, "expenseID")
+	if expenseID == "" {
+		http.Error(w, "Expense ID is required", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT h.id, h.expense_id, h.event_type, h.category_id, h.model_name, h.actor,
+		       h.old_value, h.new_value, h.change_set_id, h.created_at
+		FROM expense_history h
+		JOIN expense e ON h.expense_id = e.id
+		JOIN project p ON e.project_id = p.id
+		WHERE h.expense_id = $1 AND p.user_id = $2
+		ORDER BY h.created_at DESC, h.id DESC
+	`, expenseID, models.TEST_USER_ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	history := []models.ExpenseHistory{}
+	for rows.Next() {
+		var entry models.ExpenseHistory
+		err := rows.Scan(&entry.ID, &entry.ExpenseID, &entry.EventType, &entry.CategoryID, &entry.ModelName,
+			&entry.Actor, &entry.OldValue, &entry.NewValue, &entry.ChangeSetID, &entry.CreatedAt)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to scan history: %v", err), http.StatusInternalServerError)
+			return
+		}
+		history = append(history, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// GetProjectActivity returns a paginated feed of audit events across a project
+func GetProjectActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID := chi.URLParam(r, "projectID")
+	if projectID == "" {
+		http.Error(w, "Project ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Parse pagination parameters
+	offset := 0
+	limit := 50
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		fmt.Sscanf(offsetStr, "%d", &offset)
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT h.id, h.expense_id, h.event_type, h.category_id, h.model_name, h.actor,
+		       h.old_value, h.new_value, h.change_set_id, h.created_at,
+		       e.row_index, e.description
+		FROM expense_history h
+		JOIN expense e ON h.expense_id = e.id
+		JOIN project p ON e.project_id = p.id
+		WHERE e.project_id = $1 AND p.user_id = $2
+		ORDER BY h.created_at DESC, h.id DESC
+		LIMIT $3 OFFSET $4
+	`, projectID, models.TEST_USER_ID, limit, offset)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch activity: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	activity := []models.ExpenseActivity{}
+	for rows.Next() {
+		var entry models.ExpenseActivity
+		err := rows.Scan(&entry.ID, &entry.ExpenseID, &entry.EventType, &entry.CategoryID, &entry.ModelName,
+			&entry.Actor, &entry.OldValue, &entry.NewValue, &entry.ChangeSetID, &entry.CreatedAt,
+			&entry.RowIndex, &entry.Description)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to scan activity: %v", err), http.StatusInternalServerError)
+			return
+		}
+		activity = append(activity, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(activity)
+}
@@ -1,16 +1,14 @@
 package handlers
 
 import (
-	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"ookkee/database"
 	"ookkee/models"
 )
@@ -19,7 +17,7 @@ func GetProjects(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	rows, err := database.Pool.Query(ctx, `
-		SELECT id, name, original_name, row_count, created_at 
+		SELECT id, name, original_name, row_count, currency, inherit_categories, created_at 
 		FROM project 
 		WHERE user_id = $1 AND deleted_at IS NULL
 		ORDER BY created_at DESC
@@ -33,7 +31,8 @@ func GetProjects(w http.ResponseWriter, r *http.Request) {
 	var projects []models.Project
 	for rows.Next() {
 		var project models.Project
-		err := rows.Scan(&project.ID, &project.Name, &project.OriginalName, &project.RowCount, &project.CreatedAt)
+		err := rows.Scan(&project.ID, &project.Name, &project.OriginalName, &project.RowCount, &project.Currency,
+			&project.InheritCategories, &project.CreatedAt)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to scan project: %v", err), http.StatusInternalServerError)
 			return
@@ -66,7 +65,7 @@ func GetExpenses(w http.ResponseWriter, r *http.Request) {
 	// Fetch expenses with pagination
 	rows, err := database.Pool.Query(ctx, `
 		SELECT id, project_id, row_index, raw_data, source, date_text, description, amount, 
-		       suggested_category_id, accepted_category_id, is_personal
+		       suggested_category_id, accepted_category_id, is_personal, business_pct, is_manual, transfer_id, refund_of_expense_id, vendor_id, currency, tags, version
 		FROM expense 
 		WHERE project_id = $1 AND deleted_at IS NULL
 		ORDER BY row_index ASC
@@ -82,7 +81,7 @@ func GetExpenses(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var expense models.Expense
 		err := rows.Scan(&expense.ID, &expense.ProjectID, &expense.RowIndex, &expense.RawData,
-			&expense.Source, &expense.DateText, &expense.Description, &expense.Amount, &expense.SuggestedCategoryID, &expense.AcceptedCategoryID, &expense.IsPersonal)
+			&expense.Source, &expense.DateText, &expense.Description, &expense.Amount, &expense.SuggestedCategoryID, &expense.AcceptedCategoryID, &expense.IsPersonal, &expense.BusinessPct, &expense.IsManual, &expense.TransferID, &expense.RefundOfExpenseID, &expense.VendorID, &expense.Currency, &expense.Tags, &expense.Version)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to scan expense: %v", err), http.StatusInternalServerError)
 			return
@@ -103,7 +102,9 @@ func UpdateProject(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var requestData struct {
-		Name string `json:"name"`
+		Name              string `json:"name"`
+		Currency          string `json:"currency"`
+		InheritCategories *bool  `json:"inherit_categories"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
@@ -111,17 +112,47 @@ func UpdateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if requestData.Name == "" {
+	if requestData.Name == "" && requestData.Currency == "" && requestData.InheritCategories == nil {
 		http.Error(w, "Project name is required", http.StatusBadRequest)
 		return
 	}
 
-	// Update project name
+	var currency *string
+	if requestData.Currency != "" {
+		code, err := normalizeCurrency(requestData.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		currency = &code
+	}
+
+	// Inheriting the defaults merges them into the project's list, so their hotkeys can't clash
+	if requestData.InheritCategories != nil && *requestData.InheritCategories {
+		id, err := strconv.ParseInt(projectID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid project ID", http.StatusBadRequest)
+			return
+		}
+		clash, err := inheritedHotkeyClash(ctx, database.Pool, id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check hotkeys: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if clash != "" {
+			http.Error(w, fmt.Sprintf("Cannot inherit the default categories: %s", clash), http.StatusConflict)
+			return
+		}
+	}
+
+	// Update project name, currency and/or category inheritance; empty fields keep their
+	// current values
 	_, err := database.Pool.Exec(ctx, `
 		UPDATE project 
-		SET name = $1, updated_at = NOW() 
+		SET name = COALESCE(NULLIF($1, ''), name), currency = COALESCE($4, currency),
+		    inherit_categories = COALESCE($5, inherit_categories), updated_at = NOW() 
 		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
-	`, requestData.Name, projectID, models.TEST_USER_ID)
+	`, requestData.Name, projectID, models.TEST_USER_ID, currency, requestData.InheritCategories)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to update project: %v", err), http.StatusInternalServerError)
 		return
@@ -156,147 +187,116 @@ func DeleteProject(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"message": "Project deleted successfully"}`))
 }
 
-// UpdateExpense updates an expense's accepted category
+// UpdateExpense updates an expense's accepted category. An If-Match header holding the
+// row version makes the update conditional; a stale version gets 409 and the current row.
 func UpdateExpense(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	expenseID := chi.URLParam(r, "expenseID")
+	expenseIDStr := chi.URLParam(r, "expenseID")
 
-	if expenseID == "" {
+	if expenseIDStr == "" {
 		http.Error(w, "Expense ID is required", http.StatusBadRequest)
 		return
 	}
 
-	// Parse request body
-	var req struct {
-		AcceptedCategoryID  *int  `json:"accepted_category_id"`
-		SuggestedCategoryID *int  `json:"suggested_category_id"`
-		IsPersonal          *bool `json:"is_personal"`
+	expenseID, err := strconv.ParseInt(expenseIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid expense ID", http.StatusBadRequest)
+		return
 	}
 
+	expectedVersion, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var req expenseUpdateRequest
+
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	// Get the current expense details for auto-propagation
-	var currentExpense struct {
-		ProjectID   int    `db:"project_id"`
-		Description string `db:"description"`
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	getExpenseQuery := `SELECT project_id, description FROM expense WHERE id = $1`
-	err := database.Pool.QueryRow(ctx, getExpenseQuery, expenseID).Scan(
-		&currentExpense.ProjectID, &currentExpense.Description)
+	tx, err := database.Pool.Begin(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get expense details: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback(ctx)
 
-	// Build dynamic update query based on provided fields
-	updateFields := []string{}
-	args := []interface{}{}
-	argIndex := 1
-
-	if req.AcceptedCategoryID != nil {
-		if *req.AcceptedCategoryID == -1 {
-			// -1 means clear the field
-			updateFields = append(updateFields, "accepted_category_id = NULL")
-			updateFields = append(updateFields, "accepted_at = NULL")
-		} else {
-			updateFields = append(updateFields, fmt.Sprintf("accepted_category_id = $%d", argIndex))
-			args = append(args, req.AcceptedCategoryID)
-			argIndex++
-			updateFields = append(updateFields, "accepted_at = CURRENT_TIMESTAMP")
-		}
+	result, err := applyExpenseUpdate(ctx, tx, expenseID, req, expectedVersion, true)
+	if conflict, ok := err.(*versionConflictError); ok {
+		writeVersionConflict(w, conflict.Current)
+		return
 	}
-
-	if req.SuggestedCategoryID != nil {
-		if *req.SuggestedCategoryID == -1 {
-			// -1 means clear the field
-			updateFields = append(updateFields, "suggested_category_id = NULL")
-			updateFields = append(updateFields, "suggested_at = NULL")
-		} else {
-			updateFields = append(updateFields, fmt.Sprintf("suggested_category_id = $%d", argIndex))
-			args = append(args, req.SuggestedCategoryID)
-			argIndex++
-			updateFields = append(updateFields, "suggested_at = CURRENT_TIMESTAMP")
-		}
+	if err == errNoFieldsToUpdate {
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
 	}
-
-	if req.IsPersonal != nil {
-		updateFields = append(updateFields, fmt.Sprintf("is_personal = $%d", argIndex))
-		args = append(args, *req.IsPersonal)
-		argIndex++
+	if err == errCategoryNotInProject {
+		http.Error(w, "Category is not in the project's category list", http.StatusBadRequest)
+		return
 	}
-
-	if len(updateFields) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Expense not found", http.StatusNotFound)
 		return
 	}
-
-	// Add expense ID as final parameter
-	args = append(args, expenseID)
-
-	// Execute update
-	updateQuery := fmt.Sprintf(`
-		UPDATE expense 
-		SET %s
-		WHERE id = $%d
-	`, strings.Join(updateFields, ", "), argIndex)
-
-	_, err = database.Pool.Exec(ctx, updateQuery, args...)
-
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to update expense: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Auto-propagate accepted category to identical descriptions
-	var propagatedIDs []int
-	if req.AcceptedCategoryID != nil && *req.AcceptedCategoryID != -1 {
-		propagatedIDs, err = propagateAcceptedCategory(ctx, currentExpense.ProjectID,
-			currentExpense.Description, *req.AcceptedCategoryID)
-		if err != nil {
-			// Log error but don't fail the main request
-			log.Printf("Failed to propagate category: %v", err)
-			propagatedIDs = []int{} // Ensure we have an empty slice
-		}
+	if _, err := recordExpenseUpdates(ctx, tx, result.ProjectID, changeActionUpdateExpense, []*expenseUpdateResult{result}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to record changes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	propagatedIDs := make([]int64, len(result.Propagated))
+	for i, propagatedChange := range result.Propagated {
+		propagatedIDs[i] = propagatedChange.ExpenseID
 	}
 
 	// Return success response with actual database values (not request values)
 	response := map[string]interface{}{
 		"message":          "Expense updated successfully",
-		"expense_id":       expenseID,
+		"expense_id":       expenseIDStr,
+		"version":          result.Version,
 		"propagated_count": len(propagatedIDs),
 		"propagated_ids":   propagatedIDs,
 	}
 
 	if req.AcceptedCategoryID != nil {
-		if *req.AcceptedCategoryID == -1 {
-			response["accepted_category_id"] = nil
-		} else {
-			response["accepted_category_id"] = req.AcceptedCategoryID
-		}
+		response["accepted_category_id"] = result.Change.New.AcceptedCategoryID
 	}
 
 	if req.SuggestedCategoryID != nil {
-		if *req.SuggestedCategoryID == -1 {
-			response["suggested_category_id"] = nil
-		} else {
-			response["suggested_category_id"] = req.SuggestedCategoryID
-		}
+		response["suggested_category_id"] = result.Change.New.SuggestedCategoryID
 	}
 
-	if req.IsPersonal != nil {
-		response["is_personal"] = *req.IsPersonal
+	if req.IsPersonal != nil || req.BusinessPct != nil {
+		response["is_personal"] = result.Change.New.IsPersonal
+		response["business_pct"] = result.Change.New.BusinessPct
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", expenseETag(result.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-// GetProjectTotals gets category totals for a specific project
+// GetProjectTotals gets category totals for a specific project as a tree: each category's
+// totals include its subcategories, which are listed under children
 func GetProjectTotals(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	projectIDStr := chi.URLParam(r, "projectID")
@@ -306,45 +306,15 @@ func GetProjectTotals(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Query to get category totals (excluding Personal expenses)
-	rows, err := database.Pool.Query(ctx, `
-		SELECT 
-			ec.name as category_name,
-			SUM(e.amount) as total_amount
-		FROM expense e
-		JOIN expense_category ec ON e.accepted_category_id = ec.id
-		WHERE e.project_id = $1 
-			AND e.accepted_category_id IS NOT NULL
-			AND e.deleted_at IS NULL
-			AND e.is_personal = FALSE
-		GROUP BY ec.id, ec.name, ec.sort_order
-		ORDER BY ec.sort_order ASC
-	`, projectIDStr)
-
+	currency, err := reportCurrency(ctx, r, projectIDStr)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to fetch totals: %v", err), http.StatusInternalServerError)
+		writeReportCurrencyError(w, err)
 		return
 	}
-	defer rows.Close()
-
-	type CategoryTotal struct {
-		CategoryName string  `json:"category_name"`
-		TotalAmount  float64 `json:"total_amount"`
-	}
-
-	var totals []CategoryTotal
-	for rows.Next() {
-		var total CategoryTotal
-		err := rows.Scan(&total.CategoryName, &total.TotalAmount)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to scan total: %v", err), http.StatusInternalServerError)
-			return
-		}
-		totals = append(totals, total)
-	}
 
-	if err = rows.Err(); err != nil {
-		http.Error(w, fmt.Sprintf("Row iteration error: %v", err), http.StatusInternalServerError)
+	totals, err := loadCategoryTotals(ctx, categoryTotalsScope{ProjectID: projectIDStr}, currency)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch totals: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -368,8 +338,8 @@ func GetProjectProgress(w http.ResponseWriter, r *http.Request) {
 	err := database.Pool.QueryRow(ctx, `
 		SELECT 
 			COUNT(*) as total_count,
-			COUNT(CASE WHEN (accepted_category_id IS NOT NULL OR is_personal = true) THEN 1 END) as categorized_count,
-			COUNT(CASE WHEN (is_personal IS NULL OR is_personal = false) AND accepted_category_id IS NULL AND suggested_category_id IS NULL THEN 1 END) as uncategorized_count
+			COUNT(CASE WHEN (accepted_category_id IS NOT NULL OR is_personal = true OR transfer_id IS NOT NULL) THEN 1 END) as categorized_count,
+			COUNT(CASE WHEN (is_personal IS NULL OR is_personal = false) AND accepted_category_id IS NULL AND suggested_category_id IS NULL AND transfer_id IS NULL THEN 1 END) as uncategorized_count
 		FROM expense 
 		WHERE project_id = $1 AND deleted_at IS NULL
 	`, projectIDStr).Scan(&totalCount, &categorizedCount, &uncategorizedCount)
@@ -405,7 +375,8 @@ func GetProjectProgress(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(progress)
 }
 
-// GetProjectTotalsCSV generates and returns CSV of category totals for a project
+// GetProjectTotalsCSV generates and returns CSV of category totals for a project. Categories
+// are listed parents first with their hierarchy path; a parent's amounts include its children.
 func GetProjectTotalsCSV(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	projectIDStr := chi.URLParam(r, "projectID")
@@ -415,48 +386,15 @@ func GetProjectTotalsCSV(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Query to get category totals (excluding Personal expenses)
-	rows, err := database.Pool.Query(ctx, `
-		SELECT 
-			ec.name as category_name,
-			SUM(e.amount) as total_amount
-		FROM expense e
-		JOIN expense_category ec ON e.accepted_category_id = ec.id
-		WHERE e.project_id = $1 
-			AND e.accepted_category_id IS NOT NULL
-			AND e.deleted_at IS NULL
-			AND e.is_personal = FALSE
-		GROUP BY ec.id, ec.name, ec.sort_order
-		ORDER BY ec.sort_order ASC
-	`, projectIDStr)
-
+	currency, err := reportCurrency(ctx, r, projectIDStr)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to fetch totals: %v", err), http.StatusInternalServerError)
+		writeReportCurrencyError(w, err)
 		return
 	}
-	defer rows.Close()
-
-	type CategoryTotal struct {
-		CategoryName string
-		TotalAmount  float64
-	}
-
-	var totals []CategoryTotal
-	var grandTotal float64
-
-	for rows.Next() {
-		var total CategoryTotal
-		err := rows.Scan(&total.CategoryName, &total.TotalAmount)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to scan total: %v", err), http.StatusInternalServerError)
-			return
-		}
-		totals = append(totals, total)
-		grandTotal += total.TotalAmount
-	}
 
-	if err = rows.Err(); err != nil {
-		http.Error(w, fmt.Sprintf("Row iteration error: %v", err), http.StatusInternalServerError)
+	totals, err := loadCategoryTotals(ctx, categoryTotalsScope{ProjectID: projectIDStr}, currency)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch totals: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -464,81 +402,46 @@ func GetProjectTotalsCSV(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment; filename=totals.csv")
 
-	// Create CSV writer
 	writer := csv.NewWriter(w)
-	defer writer.Flush()
-
-	// Write header
-	if err := writer.Write([]string{"Category", "Total"}); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write CSV header: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Write category totals
-	for _, total := range totals {
-		if err := writer.Write([]string{
-			total.CategoryName,
-			strconv.FormatFloat(total.TotalAmount, 'f', 2, 64),
-		}); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to write CSV row: %v", err), http.StatusInternalServerError)
-			return
-		}
-	}
-
-	// Write grand total row
-	if err := writer.Write([]string{
-		"Total",
-		strconv.FormatFloat(grandTotal, 'f', 2, 64),
-	}); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to write CSV total row: %v", err), http.StatusInternalServerError)
+	if err := writer.WriteAll(categoryTotalsCSVRows(totals, currency)); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to write CSV: %v", err), http.StatusInternalServerError)
 		return
 	}
 }
 
-// propagateAcceptedCategory auto-assigns accepted category to other uncategorized expenses
-// with identical descriptions in the same project
-func propagateAcceptedCategory(ctx context.Context, projectID int, description string, categoryID int) ([]int, error) {
-	// First, get the IDs of expenses that will be updated
-	selectQuery := `
-		SELECT id 
-		FROM expense 
-		WHERE project_id = $1 
-		  AND accepted_category_id IS NULL 
-		  AND lower(description) = lower($2)
-	`
-
-	rows, err := database.Pool.Query(ctx, selectQuery, projectID, description)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var expenseIDs []int
-	for rows.Next() {
-		var id int
-		if err := rows.Scan(&id); err != nil {
-			return nil, err
+// categoryTotalsCSVRows lays out a totals tree as CSV: a header, each category followed by
+// its subcategories, then a grand total row
+func categoryTotalsCSVRows(totals []*categoryTotal, currency string) [][]string {
+	rows := [][]string{{"Category", "Level", fmt.Sprintf("Deductible (%s)", currency),
+		fmt.Sprintf("Personal (%s)", currency), "Unconverted Rows"}}
+
+	var addTotals func([]*categoryTotal)
+	addTotals = func(totals []*categoryTotal) {
+		for _, total := range totals {
+			rows = append(rows, []string{
+				total.Path,
+				strconv.Itoa(total.Depth),
+				total.DeductibleAmount.String(),
+				total.PersonalAmount.String(),
+				strconv.Itoa(total.UnconvertedCount),
+			})
+			addTotals(total.Children)
 		}
-		expenseIDs = append(expenseIDs, id)
 	}
+	addTotals(totals)
 
-	if len(expenseIDs) == 0 {
-		return []int{}, nil
-	}
-
-	// Now update those expenses
-	propagateQuery := `
-		UPDATE expense 
-		SET accepted_category_id = $1, accepted_at = CURRENT_TIMESTAMP
-		WHERE project_id = $2 
-		  AND accepted_category_id IS NULL 
-		  AND lower(description) = lower($3)
-	`
-
-	_, err = database.Pool.Exec(ctx, propagateQuery, categoryID, projectID, description)
-	if err != nil {
-		return nil, err
+	var grandDeductible, grandPersonal models.Money
+	grandUnconverted := 0
+	for _, total := range totals {
+		grandDeductible += total.DeductibleAmount
+		grandPersonal += total.PersonalAmount
+		grandUnconverted += total.UnconvertedCount
 	}
-
-	return expenseIDs, nil
+	return append(rows, []string{
+		"Total",
+		"",
+		grandDeductible.String(),
+		grandPersonal.String(),
+		strconv.Itoa(grandUnconverted),
+	})
 }
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// propagationSource is the expense whose accepted category is being propagated
+type propagationSource struct {
+	ExpenseID   int64
+	ProjectID   int64
+	Description string
+	Amount      *models.Money
+	VendorID    *int64
+}
+
+// propagationCandidate is an expense that would receive a propagated category
+type propagationCandidate struct {
+	ID                  int64         `json:"id"`
+	RowIndex            int           `json:"row_index"`
+	Description         *string       `json:"description"`
+	Amount              *models.Money `json:"amount"`
+	SuggestedCategoryID *int64        `json:"suggested_category_id"`
+	Similarity          float64       `json:"similarity"`
+}
+
+// propagationOverrides replace saved propagation settings for one preview or update, so an
+// update can propagate to the rows a preview with the same overrides listed
+type propagationOverrides struct {
+	Mode      *string       `json:"propagation_mode,omitempty"`
+	Threshold *float64      `json:"propagation_threshold,omitempty"`
+	Tolerance *models.Money `json:"propagation_amount_tolerance,omitempty"`
+}
+
+// apply returns settings with the overrides applied, or an error if the result is invalid
+func (o propagationOverrides) apply(settings models.UserSettings) (models.UserSettings, error) {
+	if o.Mode != nil {
+		settings.PropagationMode = *o.Mode
+	}
+	if o.Threshold != nil {
+		settings.PropagationThreshold = *o.Threshold
+	}
+	if o.Tolerance != nil {
+		settings.PropagationAmountTolerance = *o.Tolerance
+	}
+	return settings, validatePropagationSettings(settings)
+}
+
+// propagationMatchClause returns the SQL condition matching rows against the source for
+// the given mode, with its arguments numbered from argIndex. The second return is false
+// when the mode never matches anything (propagation disabled or nothing to compare).
+func propagationMatchClause(settings models.UserSettings, source propagationSource, argIndex int) (string, []interface{}, bool) {
+	switch settings.PropagationMode {
+	case models.PropagationExact:
+		return fmt.Sprintf("lower(description) = lower($%d)", argIndex),
+			[]interface{}{source.Description}, source.Description != ""
+
+	case models.PropagationNormalized:
+		return fmt.Sprintf("normalize_description(description) = normalize_description($%d) AND normalize_description($%d) <> ''", argIndex, argIndex),
+			[]interface{}{source.Description}, source.Description != ""
+
+	case models.PropagationTrigram:
+		// % uses the trigram index with pg_trgm.similarity_threshold (set by the caller)
+		return fmt.Sprintf("lower(description) %% lower($%d)", argIndex),
+			[]interface{}{source.Description}, source.Description != ""
+
+	case models.PropagationAmount:
+		if source.Amount == nil {
+			return "", nil, false
+		}
+		return fmt.Sprintf("normalize_description(description) = normalize_description($%d) AND normalize_description($%d) <> '' AND abs(amount - $%d::numeric) <= $%d::numeric",
+				argIndex, argIndex, argIndex+1, argIndex+2),
+			[]interface{}{source.Description, *source.Amount, settings.PropagationAmountTolerance}, source.Description != ""
+
+	case models.PropagationVendor:
+		if source.VendorID == nil {
+			return "", nil, false
+		}
+		return fmt.Sprintf("vendor_id = $%d", argIndex), []interface{}{*source.VendorID}, true
+	}
+
+	return "", nil, false
+}
+
+// setTrigramThreshold applies the similarity threshold for the rest of the transaction
+func setTrigramThreshold(ctx context.Context, tx pgx.Tx, settings models.UserSettings) error {
+	if settings.PropagationMode != models.PropagationTrigram {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`,
+		strconv.FormatFloat(settings.PropagationThreshold, 'f', -1, 64))
+	return err
+}
+
+// findPropagationCandidates lists uncategorized expenses that match the source under settings
+func findPropagationCandidates(ctx context.Context, tx pgx.Tx, settings models.UserSettings, source propagationSource) ([]propagationCandidate, error) {
+	clause, clauseArgs, ok := propagationMatchClause(settings, source, 4)
+	if !ok {
+		return []propagationCandidate{}, nil
+	}
+
+	if err := setTrigramThreshold(ctx, tx, settings); err != nil {
+		return nil, err
+	}
+
+	args := append([]interface{}{source.ProjectID, source.ExpenseID, source.Description}, clauseArgs...)
+	rows, err := tx.Query(ctx, fmt.Sprintf(`
+		SELECT id, row_index, description, amount, suggested_category_id,
+		       similarity(lower(COALESCE(description, '')), lower($3))
+		FROM expense
+		WHERE project_id = $1
+		  AND id <> $2
+		  AND accepted_category_id IS NULL
+		  AND deleted_at IS NULL
+		  AND %s
+		ORDER BY row_index ASC
+	`, clause), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []propagationCandidate{}
+	for rows.Next() {
+		var candidate propagationCandidate
+		err := rows.Scan(&candidate.ID, &candidate.RowIndex, &candidate.Description, &candidate.Amount,
+			&candidate.SuggestedCategoryID, &candidate.Similarity)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, rows.Err()
+}
+
+// propagateAcceptedCategory auto-assigns accepted category to other uncategorized expenses
+// in the same project that match the source under the user's propagation mode, returning
+// the change for each row. A non-nil onlyIDs restricts propagation to those expenses
+// (e.g. the rows the user kept after a preview).
+func propagateAcceptedCategory(ctx context.Context, tx pgx.Tx, settings models.UserSettings, source propagationSource, categoryID int, onlyIDs []int64) ([]expenseChange, error) {
+	clause, clauseArgs, ok := propagationMatchClause(settings, source, 4)
+	if !ok {
+		return []expenseChange{}, nil
+	}
+
+	if err := setTrigramThreshold(ctx, tx, settings); err != nil {
+		return nil, err
+	}
+
+	onlyClause := ""
+	args := append([]interface{}{categoryID, source.ProjectID, source.ExpenseID}, clauseArgs...)
+	if onlyIDs != nil {
+		onlyClause = fmt.Sprintf("AND id = ANY($%d)", len(args)+1)
+		args = append(args, onlyIDs)
+	}
+
+	propagateQuery := fmt.Sprintf(`
+		UPDATE expense
+		SET accepted_category_id = $1, accepted_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE project_id = $2
+		  AND id <> $3
+		  AND accepted_category_id IS NULL
+		  AND deleted_at IS NULL
+		  AND %s
+		  %s
+		RETURNING id, suggested_category_id, COALESCE(is_personal, FALSE), business_pct
+	`, clause, onlyClause)
+
+	rows, err := tx.Query(ctx, propagateQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	newCategoryID := int64(categoryID)
+	changes := []expenseChange{}
+	for rows.Next() {
+		var change expenseChange
+		if err := rows.Scan(&change.ExpenseID, &change.Old.SuggestedCategoryID, &change.Old.IsPersonal, &change.Old.BusinessPct); err != nil {
+			return nil, err
+		}
+		// Only accepted_category_id changes; it was NULL before propagation
+		change.New = change.Old
+		change.New.AcceptedCategoryID = &newCategoryID
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// GetPropagationPreview lists the expenses that accepting a category on this expense would
+// also change. Query params mode, threshold and tolerance override the saved settings; pass
+// the same overrides with the update so it propagates to the previewed rows.
+func GetPropagationPreview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	expenseID := chi.URLParam(r, "expenseID")
+	if expenseID == "" {
+		http.Error(w, "Expense ID is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	settings, err := loadUserSettings(ctx, tx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var overrides propagationOverrides
+	query := r.URL.Query()
+	if mode := query.Get("mode"); mode != "" {
+		overrides.Mode = &mode
+	}
+	if threshold := query.Get("threshold"); threshold != "" {
+		value, err := strconv.ParseFloat(threshold, 64)
+		if err != nil {
+			http.Error(w, "Invalid threshold", http.StatusBadRequest)
+			return
+		}
+		overrides.Threshold = &value
+	}
+	if tolerance := query.Get("tolerance"); tolerance != "" {
+		value, err := models.ParseMoney(tolerance)
+		if err != nil {
+			http.Error(w, "Invalid tolerance", http.StatusBadRequest)
+			return
+		}
+		overrides.Tolerance = &value
+	}
+	if settings, err = overrides.apply(settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var source propagationSource
+	err = tx.QueryRow(ctx, `
+		SELECT e.id, e.project_id, COALESCE(e.description, ''), e.amount, e.vendor_id
+		FROM expense e
+		JOIN project p ON e.project_id = p.id
+		WHERE e.id = $1 AND p.user_id = $2 AND e.deleted_at IS NULL
+	`, expenseID, models.TEST_USER_ID).Scan(&source.ExpenseID, &source.ProjectID, &source.Description, &source.Amount, &source.VendorID)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get expense details: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	candidates, err := findPropagationCandidates(ctx, tx, settings, source)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to find matching expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"expense_id": source.ExpenseID,
+		"settings":   settings,
+		"count":      len(candidates),
+		"expenses":   candidates,
+	})
+}
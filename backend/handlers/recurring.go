@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// defaultRecurringTolerance is how far (as a fraction) a charge may drift from the series amount
+const defaultRecurringTolerance = 0.1
+
+// recurringCadence describes the spacing between charges for one cadence
+type recurringCadence struct {
+	Name           string
+	MinDays        float64
+	MaxDays        float64
+	MinOccurrences int
+	PerYear        float64
+}
+
+// recurringCadences are checked in order against the median gap between charges
+var recurringCadences = []recurringCadence{
+	{Name: models.CadenceWeekly, MinDays: 5, MaxDays: 9, MinOccurrences: 4, PerYear: 52},
+	{Name: models.CadenceMonthly, MinDays: 26, MaxDays: 35, MinOccurrences: 3, PerYear: 12},
+	{Name: models.CadenceAnnual, MinDays: 350, MaxDays: 380, MinOccurrences: 2, PerYear: 1},
+}
+
+// recurringCharge is a dated purchase considered for recurring detection
+type recurringCharge struct {
+	ExpenseID          int64
+	ProjectID          int64
+	Merchant           string
+	Description        string
+	Amount             models.Money
+	Currency           string
+	Date               time.Time
+	AcceptedCategoryID *int64
+}
+
+// loadRecurringCharges reads dated purchases for one project, or every project when projectID is nil
+func loadRecurringCharges(ctx context.Context, q dbQuerier, projectID *int64) ([]recurringCharge, error) {
+	rows, err := q.Query(ctx, `
+		SELECT e.id, e.project_id, normalize_description(e.description), COALESCE(e.description, ''),
+		       -e.amount, COALESCE(e.currency, p.currency), e.expense_date, e.accepted_category_id
+		FROM expense e
+		JOIN project p ON e.project_id = p.id
+		WHERE p.user_id = $1
+		  AND p.deleted_at IS NULL
+		  AND ($2::bigint IS NULL OR e.project_id = $2)
+		  AND e.deleted_at IS NULL
+		  AND e.amount < 0
+		  AND e.transfer_id IS NULL
+		  AND e.expense_date IS NOT NULL
+		  AND normalize_description(e.description) <> ''
+		ORDER BY e.expense_date ASC, e.row_index ASC
+	`, models.TEST_USER_ID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var charges []recurringCharge
+	for rows.Next() {
+		var charge recurringCharge
+		err := rows.Scan(&charge.ExpenseID, &charge.ProjectID, &charge.Merchant, &charge.Description,
+			&charge.Amount, &charge.Currency, &charge.Date, &charge.AcceptedCategoryID)
+		if err != nil {
+			return nil, err
+		}
+		charges = append(charges, charge)
+	}
+
+	return charges, rows.Err()
+}
+
+// amountsClose reports whether two charge amounts belong to the same series
+func amountsClose(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= math.Max(1.0, tolerance*math.Max(a, b))
+}
+
+// recurringGroup is a merchant's charges in one currency; amounts are only compared within it
+type recurringGroup struct {
+	Merchant string
+	Currency string
+}
+
+// detectRecurringSeries groups charges by merchant, currency and steady amount and keeps the
+// groups whose dates follow a weekly, monthly or annual cadence
+func detectRecurringSeries(charges []recurringCharge, tolerance float64) []models.RecurringSeries {
+	byGroup := make(map[recurringGroup][]recurringCharge)
+	var groups []recurringGroup
+	for _, charge := range charges {
+		key := recurringGroup{Merchant: charge.Merchant, Currency: charge.Currency}
+		if _, ok := byGroup[key]; !ok {
+			groups = append(groups, key)
+		}
+		byGroup[key] = append(byGroup[key], charge)
+	}
+
+	series := []models.RecurringSeries{}
+	for _, key := range groups {
+		merchant, group := key.Merchant, byGroup[key]
+
+		// Split the merchant's charges into clusters of similar amounts
+		sort.SliceStable(group, func(i, j int) bool { return group[i].Amount < group[j].Amount })
+		var clusters [][]recurringCharge
+		for _, charge := range group {
+			last := len(clusters) - 1
+			if last >= 0 && amountsClose(clusters[last][0].Amount.Float64(), charge.Amount.Float64(), tolerance) {
+				clusters[last] = append(clusters[last], charge)
+			} else {
+				clusters = append(clusters, []recurringCharge{charge})
+			}
+		}
+
+		for _, cluster := range clusters {
+			if s, ok := recurringSeriesFromCluster(merchant, cluster); ok {
+				series = append(series, s)
+			}
+		}
+	}
+
+	sort.SliceStable(series, func(i, j int) bool { return series[i].AnnualizedCost > series[j].AnnualizedCost })
+	return series
+}
+
+// recurringSeriesFromCluster checks a cluster of similar charges for a regular cadence
+func recurringSeriesFromCluster(merchant string, cluster []recurringCharge) (models.RecurringSeries, bool) {
+	if len(cluster) < 2 {
+		return models.RecurringSeries{}, false
+	}
+
+	sort.SliceStable(cluster, func(i, j int) bool { return cluster[i].Date.Before(cluster[j].Date) })
+
+	gaps := make([]float64, 0, len(cluster)-1)
+	for i := 1; i < len(cluster); i++ {
+		gaps = append(gaps, cluster[i].Date.Sub(cluster[i-1].Date).Hours()/24)
+	}
+	sortedGaps := append([]float64(nil), gaps...)
+	sort.Float64s(sortedGaps)
+	medianGap := sortedGaps[len(sortedGaps)/2]
+
+	for _, cadence := range recurringCadences {
+		if medianGap < cadence.MinDays || medianGap > cadence.MaxDays || len(cluster) < cadence.MinOccurrences {
+			continue
+		}
+
+		// Most gaps must fit the cadence; an occasional skipped or doubled charge is fine
+		regular := 0
+		for _, gap := range gaps {
+			if gap >= cadence.MinDays && gap <= cadence.MaxDays {
+				regular++
+			}
+		}
+		if float64(regular) < 0.75*float64(len(gaps)) {
+			return models.RecurringSeries{}, false
+		}
+
+		return buildRecurringSeries(merchant, cadence, cluster), true
+	}
+
+	return models.RecurringSeries{}, false
+}
+
+// buildRecurringSeries summarizes a date-ordered cluster that matched a cadence
+func buildRecurringSeries(merchant string, cadence recurringCadence, cluster []recurringCharge) models.RecurringSeries {
+	first, last := cluster[0], cluster[len(cluster)-1]
+	s := models.RecurringSeries{
+		Merchant:           merchant,
+		Description:        last.Description,
+		Cadence:            cadence.Name,
+		Currency:           first.Currency,
+		Occurrences:        len(cluster),
+		FirstDate:          first.Date,
+		LastDate:           last.Date,
+		AcceptedCategoryID: first.AcceptedCategoryID,
+		ProjectIDs:         []int64{},
+		ExpenseIDs:         []int64{},
+	}
+
+	var total models.Money
+	minAmount := cluster[0].Amount
+	seenProjects := make(map[int64]bool)
+	for _, charge := range cluster {
+		total += charge.Amount
+		if charge.Amount < minAmount {
+			minAmount = charge.Amount
+		}
+		s.ExpenseIDs = append(s.ExpenseIDs, charge.ExpenseID)
+		if !seenProjects[charge.ProjectID] {
+			seenProjects[charge.ProjectID] = true
+			s.ProjectIDs = append(s.ProjectIDs, charge.ProjectID)
+		}
+		// Only report a category when the whole series shares it
+		if !sameCategoryID(s.AcceptedCategoryID, charge.AcceptedCategoryID) {
+			s.AcceptedCategoryID = nil
+		}
+	}
+
+	s.AverageAmount = models.Money(math.Round(float64(total) / float64(len(cluster))))
+	s.AnnualizedCost = models.Money(math.Round(float64(s.AverageAmount) * cadence.PerYear))
+
+	switch cadence.Name {
+	case models.CadenceWeekly:
+		s.NextExpectedDate = last.Date.AddDate(0, 0, 7)
+	case models.CadenceMonthly:
+		s.NextExpectedDate = last.Date.AddDate(0, 1, 0)
+	case models.CadenceAnnual:
+		s.NextExpectedDate = last.Date.AddDate(1, 0, 0)
+	}
+
+	// Stable across requests as long as the merchant, cadence, currency and price tier don't change
+	s.Key = fmt.Sprintf("%s|%s|%.0f|%s", merchant, cadence.Name, minAmount.Float64(), first.Currency)
+
+	return s
+}
+
+// parseRecurringTolerance reads the optional tolerance query param
+func parseRecurringTolerance(r *http.Request) (float64, error) {
+	toleranceStr := r.URL.Query().Get("tolerance")
+	if toleranceStr == "" {
+		return defaultRecurringTolerance, nil
+	}
+	tolerance, err := strconv.ParseFloat(toleranceStr, 64)
+	if err != nil || tolerance < 0 || tolerance > 1 {
+		return 0, fmt.Errorf("tolerance must be between 0 and 1")
+	}
+	return tolerance, nil
+}
+
+// GetProjectRecurring lists recurring charges detected in one project
+func GetProjectRecurring(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+	writeRecurringSeries(w, r, &projectID)
+}
+
+// GetRecurring lists recurring charges detected across all of the user's projects
+func GetRecurring(w http.ResponseWriter, r *http.Request) {
+	writeRecurringSeries(w, r, nil)
+}
+
+// writeRecurringSeries responds with the series detected in scope
+func writeRecurringSeries(w http.ResponseWriter, r *http.Request, projectID *int64) {
+	ctx := r.Context()
+
+	tolerance, err := parseRecurringTolerance(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	charges, err := loadRecurringCharges(ctx, database.Pool, projectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	series := detectRecurringSeries(charges, tolerance)
+
+	// Totals are per currency; annualized_total is only given when there is one currency
+	annualizedTotals := make(map[string]models.Money)
+	for _, s := range series {
+		annualizedTotals[s.Currency] += s.AnnualizedCost
+	}
+	var annualizedTotal *models.Money
+	if len(annualizedTotals) <= 1 {
+		total := models.Money(0)
+		for _, amount := range annualizedTotals {
+			total = amount
+		}
+		annualizedTotal = &total
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"series":            series,
+		"count":             len(series),
+		"annualized_total":  annualizedTotal,
+		"annualized_totals": annualizedTotals,
+	})
+}
+
+// CategorizeRecurringSeries accepts one category for every charge in a detected series.
+// Each project touched gets its own undo step.
+func CategorizeRecurringSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		Key        string   `json:"key"`
+		CategoryID int      `json:"category_id"`
+		ProjectID  *int64   `json:"project_id"`
+		Tolerance  *float64 `json:"tolerance"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.Key == "" || req.CategoryID <= 0 {
+		http.Error(w, "key and category_id are required", http.StatusBadRequest)
+		return
+	}
+
+	tolerance := defaultRecurringTolerance
+	if req.Tolerance != nil {
+		if *req.Tolerance < 0 || *req.Tolerance > 1 {
+			http.Error(w, "tolerance must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		tolerance = *req.Tolerance
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	charges, err := loadRecurringCharges(ctx, tx, req.ProjectID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var series *models.RecurringSeries
+	for _, s := range detectRecurringSeries(charges, tolerance) {
+		if s.Key == req.Key {
+			series = &s
+			break
+		}
+	}
+	if series == nil {
+		http.Error(w, "Recurring series not found", http.StatusNotFound)
+		return
+	}
+
+	resultsByProject := make(map[int64][]*expenseUpdateResult)
+	update := expenseUpdateRequest{AcceptedCategoryID: &req.CategoryID}
+	for _, expenseID := range series.ExpenseIDs {
+		result, err := applyExpenseUpdate(ctx, tx, expenseID, update, nil, false)
+		if err == errCategoryNotInProject {
+			http.Error(w, fmt.Sprintf("Category is not in the category list of expense %d's project", expenseID), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update expense %d: %v", expenseID, err), http.StatusInternalServerError)
+			return
+		}
+		resultsByProject[result.ProjectID] = append(resultsByProject[result.ProjectID], result)
+	}
+
+	for _, projectID := range series.ProjectIDs {
+		if _, err := recordExpenseUpdates(ctx, tx, projectID, changeActionCategorizeSeries, resultsByProject[projectID]); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to record change: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       fmt.Sprintf("Categorized %d charges", len(series.ExpenseIDs)),
+		"key":           series.Key,
+		"category_id":   req.CategoryID,
+		"updated_count": len(series.ExpenseIDs),
+		"expense_ids":   series.ExpenseIDs,
+	})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"ookkee/models"
+)
+
+// chargeSeries returns count charges of amount cents from start, every gap days
+func chargeSeries(merchant, currency string, cents int64, start time.Time, gap, count int) []recurringCharge {
+	var charges []recurringCharge
+	for i := 0; i < count; i++ {
+		charges = append(charges, recurringCharge{
+			ExpenseID: int64(len(merchant)*1000 + i),
+			ProjectID: 1,
+			Merchant:  merchant,
+			Amount:    models.MoneyFromCents(cents),
+			Currency:  currency,
+			Date:      start.AddDate(0, 0, i*gap),
+		})
+	}
+	return charges
+}
+
+func TestAmountsClose(t *testing.T) {
+	tests := []struct {
+		a, b, tolerance float64
+		want            bool
+	}{
+		{100, 110, 0.1, true},  // 10 ≤ 10% of 110
+		{100, 112, 0.1, false}, // 12 > 11.2
+		{5, 5.99, 0, true},     // within the one-unit floor
+		{5, 6.01, 0, false},    // past the floor
+		{50, 100, 0.5, true},   // 50 ≤ 50% of 100
+		{49.99, 100, 0.5, false},
+	}
+	for _, tt := range tests {
+		if got := amountsClose(tt.a, tt.b, tt.tolerance); got != tt.want {
+			t.Errorf("amountsClose(%v, %v, %v) = %v, want %v", tt.a, tt.b, tt.tolerance, got, tt.want)
+		}
+	}
+}
+
+func TestDetectRecurringSeries(t *testing.T) {
+	start := time.Date(2024, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		charges  []recurringCharge
+		cadences []string
+	}{
+		{"monthly", chargeSeries("netflix", "USD", 1599, start, 30, 4), []string{models.CadenceMonthly}},
+		{"weekly", chargeSeries("gym", "USD", 1000, start, 7, 4), []string{models.CadenceWeekly}},
+		{"too few weekly charges", chargeSeries("gym", "USD", 1000, start, 7, 3), nil},
+		{"annual", chargeSeries("domain", "USD", 1200, start, 366, 2), []string{models.CadenceAnnual}},
+		{"no cadence", chargeSeries("cafe", "USD", 450, start, 15, 5), nil},
+		{"irregular gaps", append(chargeSeries("cloud", "USD", 2000, start, 30, 3),
+			chargeSeries("cloud", "USD", 2000, start.AddDate(0, 0, 70), 10, 3)...), nil},
+		{"price tiers are separate series", append(chargeSeries("saas", "USD", 1000, start, 30, 3),
+			chargeSeries("saas", "USD", 2000, start, 30, 3)...), []string{models.CadenceMonthly, models.CadenceMonthly}},
+		{"currencies are separate series", append(chargeSeries("spotify", "USD", 999, start, 30, 3),
+			chargeSeries("spotify", "EUR", 999, start, 30, 3)...), []string{models.CadenceMonthly, models.CadenceMonthly}},
+	}
+
+	for _, tt := range tests {
+		series := detectRecurringSeries(tt.charges, defaultRecurringTolerance)
+		if len(series) != len(tt.cadences) {
+			t.Errorf("%s: found %d series, want %d", tt.name, len(series), len(tt.cadences))
+			continue
+		}
+		for i, s := range series {
+			if s.Cadence != tt.cadences[i] {
+				t.Errorf("%s: series %d cadence = %s, want %s", tt.name, i, s.Cadence, tt.cadences[i])
+			}
+		}
+	}
+}
+
+func TestRecurringSeriesSummary(t *testing.T) {
+	start := time.Date(2024, time.January, 3, 0, 0, 0, 0, time.UTC)
+	charges := append(chargeSeries("spotify", "USD", 999, start, 30, 3), chargeSeries("spotify", "EUR", 1099, start, 30, 3)...)
+
+	series := detectRecurringSeries(charges, defaultRecurringTolerance)
+	if len(series) != 2 {
+		t.Fatalf("found %d series, want 2", len(series))
+	}
+	byCurrency := make(map[string]models.RecurringSeries)
+	for _, s := range series {
+		byCurrency[s.Currency] = s
+	}
+
+	usd := byCurrency["USD"]
+	if usd.Occurrences != 3 || usd.AverageAmount != 999 || usd.AnnualizedCost != 11988 {
+		t.Errorf("USD series = %+v", usd)
+	}
+	if want := start.AddDate(0, 0, 60).AddDate(0, 1, 0); !usd.NextExpectedDate.Equal(want) {
+		t.Errorf("next expected = %v, want %v", usd.NextExpectedDate, want)
+	}
+	if usd.Key == byCurrency["EUR"].Key {
+		t.Errorf("series in different currencies share the key %q", usd.Key)
+	}
+}
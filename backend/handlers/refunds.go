@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// defaultRefundWindowDays is how long after a purchase a refund may still be matched to it
+const defaultRefundWindowDays = 180
+
+// refundMatch is a credit linked to the purchase it reverses
+type refundMatch struct {
+	RefundExpenseID    int64  `json:"refund_expense_id"`
+	OriginalExpenseID  int64  `json:"original_expense_id"`
+	AcceptedCategoryID *int64 `json:"accepted_category_id"`
+}
+
+// linkRefund points a credit at its original purchase and gives it the purchase's accepted
+// category (when it has one) so the two net out in category totals
+func linkRefund(ctx context.Context, tx pgx.Tx, refundID, originalID int64) (refundMatch, error) {
+	match := refundMatch{RefundExpenseID: refundID, OriginalExpenseID: originalID}
+
+	var oldRefundOf, oldCategoryID *int64
+	err := tx.QueryRow(ctx, `
+		SELECT refund_of_expense_id, accepted_category_id
+		FROM expense
+		WHERE id = $1
+		FOR UPDATE
+	`, refundID).Scan(&oldRefundOf, &oldCategoryID)
+	if err != nil {
+		return match, err
+	}
+
+	err = tx.QueryRow(ctx, `
+		UPDATE expense r
+		SET refund_of_expense_id = o.id,
+		    accepted_category_id = COALESCE(o.accepted_category_id, r.accepted_category_id),
+		    accepted_at = CASE WHEN o.accepted_category_id IS NULL THEN r.accepted_at ELSE CURRENT_TIMESTAMP END,
+		    version = r.version + 1
+		FROM expense o
+		WHERE r.id = $1 AND o.id = $2
+		RETURNING r.accepted_category_id
+	`, refundID, originalID).Scan(&match.AcceptedCategoryID)
+	if err != nil {
+		return match, fmt.Errorf("failed to link refund: %w", err)
+	}
+
+	err = recordHistory(ctx, tx, historyEntry{
+		ExpenseID:  refundID,
+		EventType:  historyEventRefundLink,
+		CategoryID: match.AcceptedCategoryID,
+		OldValue:   map[string]interface{}{"refund_of_expense_id": oldRefundOf, "accepted_category_id": oldCategoryID},
+		NewValue:   map[string]interface{}{"refund_of_expense_id": originalID, "accepted_category_id": match.AcceptedCategoryID},
+	})
+	return match, err
+}
+
+// matchRefunds links unmatched credits in a project to the purchase they most likely reverse:
+// same normalized merchant, dated on or before the credit within windowDays, with enough of
+// the purchase left unrefunded to cover the credit. Exact amounts win over partial ones, then
+// the closest date. Credits the user unlinked before are left alone.
+func matchRefunds(ctx context.Context, tx pgx.Tx, projectID int64, windowDays int) ([]refundMatch, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT id, COALESCE(description, ''), amount, expense_date, currency
+		FROM expense e
+		WHERE project_id = $1
+		  AND amount > 0
+		  AND refund_of_expense_id IS NULL
+		  AND transfer_id IS NULL
+		  AND deleted_at IS NULL
+		  AND expense_date IS NOT NULL
+		  AND normalize_description(description) <> ''
+		  AND NOT EXISTS (
+		      SELECT 1 FROM expense_history h
+		      WHERE h.expense_id = e.id AND h.event_type = 'refund_unlink'
+		  )
+		ORDER BY expense_date ASC, row_index ASC
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	type credit struct {
+		id          int64
+		description string
+		amount      models.Money
+		date        time.Time
+		currency    *string
+	}
+	var credits []credit
+	for rows.Next() {
+		var c credit
+		if err := rows.Scan(&c.id, &c.description, &c.amount, &c.date, &c.currency); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		credits = append(credits, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Credits are matched one at a time so earlier links reduce what's left to refund
+	matches := []refundMatch{}
+	for _, c := range credits {
+		var originalID int64
+		err := tx.QueryRow(ctx, `
+			SELECT p.id
+			FROM expense p
+			WHERE p.project_id = $1
+			  AND p.amount < 0
+			  AND p.deleted_at IS NULL
+			  AND p.transfer_id IS NULL
+			  AND p.refund_of_expense_id IS NULL
+			  AND p.expense_date IS NOT NULL
+			  AND p.expense_date BETWEEN $4::date - $5::int AND $4::date
+			  AND normalize_description(p.description) = normalize_description($2)
+			  AND p.currency IS NOT DISTINCT FROM $6
+			  AND -p.amount - COALESCE((
+			      SELECT SUM(r.amount) FROM expense r
+			      WHERE r.refund_of_expense_id = p.id AND r.deleted_at IS NULL
+			  ), 0) >= $3::numeric
+			ORDER BY (-p.amount = $3::numeric) DESC, p.expense_date DESC, p.row_index DESC
+			LIMIT 1
+		`, projectID, c.description, c.amount, c.date, windowDays, c.currency).Scan(&originalID)
+		if err == pgx.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		match, err := linkRefund(ctx, tx, c.id, originalID)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+// syncRefundCategories gives a purchase's linked refunds its newly accepted category,
+// returning the change for each refund that moved
+func syncRefundCategories(ctx context.Context, tx pgx.Tx, originalID int64, categoryID int64) ([]expenseChange, error) {
+	rows, err := tx.Query(ctx, `
+		UPDATE expense r
+		SET accepted_category_id = $2, accepted_at = CURRENT_TIMESTAMP, version = r.version + 1
+		FROM expense old
+		WHERE r.refund_of_expense_id = $1
+		  AND old.id = r.id
+		  AND r.deleted_at IS NULL
+		  AND r.accepted_category_id IS DISTINCT FROM $2
+		RETURNING r.id, old.accepted_category_id, r.suggested_category_id, COALESCE(r.is_personal, FALSE), r.business_pct
+	`, originalID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []expenseChange{}
+	for rows.Next() {
+		var change expenseChange
+		if err := rows.Scan(&change.ExpenseID, &change.Old.AcceptedCategoryID,
+			&change.Old.SuggestedCategoryID, &change.Old.IsPersonal, &change.Old.BusinessPct); err != nil {
+			return nil, err
+		}
+		change.New = change.Old
+		change.New.AcceptedCategoryID = &categoryID
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// MatchRefunds runs refund matching over a project. Optional window_days query param.
+func MatchRefunds(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	windowDays := defaultRefundWindowDays
+	if windowStr := r.URL.Query().Get("window_days"); windowStr != "" {
+		if windowDays, err = strconv.Atoi(windowStr); err != nil || windowDays < 0 {
+			http.Error(w, "Invalid window_days", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockProject(ctx, tx, projectID); err == pgx.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	matches, err := matchRefunds(ctx, tx, projectID, windowDays)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to match refunds: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Matched %d refunds", len(matches)),
+		"matches": matches,
+	})
+}
+
+// GetUnmatchedCredits lists positive rows that are neither a matched refund nor a transfer,
+// for the user to review
+func GetUnmatchedCredits(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID := chi.URLParam(r, "projectID")
+	if projectID == "" {
+		http.Error(w, "Project ID is required", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT e.id, e.project_id, e.row_index, e.source, e.date_text, e.description, e.amount,
+		       e.suggested_category_id, e.accepted_category_id, COALESCE(e.is_personal, FALSE), e.is_manual, e.version
+		FROM expense e
+		JOIN project p ON e.project_id = p.id
+		WHERE e.project_id = $1 AND p.user_id = $2
+		  AND e.amount > 0
+		  AND e.refund_of_expense_id IS NULL
+		  AND e.transfer_id IS NULL
+		  AND e.deleted_at IS NULL
+		ORDER BY e.row_index ASC
+	`, projectID, models.TEST_USER_ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch credits: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	credits := []models.Expense{}
+	for rows.Next() {
+		var expense models.Expense
+		err := rows.Scan(&expense.ID, &expense.ProjectID, &expense.RowIndex, &expense.Source, &expense.DateText,
+			&expense.Description, &expense.Amount, &expense.SuggestedCategoryID, &expense.AcceptedCategoryID,
+			&expense.IsPersonal, &expense.IsManual, &expense.Version)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to scan credit: %v", err), http.StatusInternalServerError)
+			return
+		}
+		credits = append(credits, expense)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(credits)
+}
+
+// LinkRefund manually marks a credit as a refund of a purchase in the same project
+func LinkRefund(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	expenseID, err := strconv.ParseInt(chi.URLParam(r, "expenseID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid expense ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		OriginalExpenseID int64 `json:"original_expense_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.OriginalExpenseID == 0 || req.OriginalExpenseID == expenseID {
+		http.Error(w, "A different original_expense_id is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// The refund must be a credit and the original a purchase, both active in the same project
+	var valid bool
+	err = tx.QueryRow(ctx, `
+		SELECT r.amount > 0 AND o.amount < 0 AND o.refund_of_expense_id IS NULL
+		FROM expense r
+		JOIN expense o ON o.project_id = r.project_id
+		JOIN project p ON r.project_id = p.id
+		WHERE r.id = $1 AND o.id = $2 AND p.user_id = $3
+		  AND r.deleted_at IS NULL AND o.deleted_at IS NULL
+	`, expenseID, req.OriginalExpenseID, models.TEST_USER_ID).Scan(&valid)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get expense details: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Refund must be a credit and the original a purchase", http.StatusBadRequest)
+		return
+	}
+
+	match, err := linkRefund(ctx, tx, expenseID, req.OriginalExpenseID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to link refund: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(match)
+}
+
+// UnlinkRefund detaches a refund from its original purchase. The refund keeps its category
+// and is skipped by later automatic matching.
+func UnlinkRefund(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	expenseID, err := strconv.ParseInt(chi.URLParam(r, "expenseID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid expense ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var originalID *int64
+	err = tx.QueryRow(ctx, `
+		SELECT e.refund_of_expense_id
+		FROM expense e
+		JOIN project p ON e.project_id = p.id
+		WHERE e.id = $1 AND p.user_id = $2
+		FOR UPDATE OF e
+	`, expenseID, models.TEST_USER_ID).Scan(&originalID)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get expense details: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if originalID == nil {
+		http.Error(w, "Expense is not linked to a purchase", http.StatusBadRequest)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE expense
+		SET refund_of_expense_id = NULL, version = version + 1
+		WHERE id = $1
+	`, expenseID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to unlink refund: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = recordHistory(ctx, tx, historyEntry{
+		ExpenseID: expenseID,
+		EventType: historyEventRefundUnlink,
+		OldValue:  map[string]interface{}{"refund_of_expense_id": originalID},
+		NewValue:  map[string]interface{}{"refund_of_expense_id": nil},
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to record history: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Refund unlinked"}`))
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+	"ookkee/rules"
+)
+
+// draftRuleID stands in for the ID of a draft rule that is not saved yet, so it sorts after
+// saved rules of the same priority as it would once created. Reports show it as 0.
+const draftRuleID int64 = math.MaxInt64
+
+// defaultDryRunLimit caps each list of rows in a dry-run report; the counts are not capped
+const defaultDryRunLimit = 200
+
+// dryRunRow is an expense the evaluated rules match, with what they would set
+type dryRunRow struct {
+	ExpenseID          int64         `json:"expense_id"`
+	ProjectID          int64         `json:"project_id"`
+	RowIndex           int           `json:"row_index"`
+	Description        string        `json:"description"`
+	Amount             *models.Money `json:"amount"`
+	AcceptedCategoryID *int64        `json:"accepted_category_id"` // the category it has now
+	CategoryID         *int64        `json:"category_id"`          // the category the rules set
+	CategoryRuleID     int64         `json:"category_rule_id,omitempty"`
+	IsPersonal         *bool         `json:"is_personal"`
+	Tags               []string      `json:"tags"`
+	RuleIDs            []int64       `json:"rule_ids"`
+	WouldApply         bool          `json:"would_apply"` // applying the rules now would change the row
+}
+
+// dryRunConflictRule is one side of a conflict: a matching rule and the value it sets
+type dryRunConflictRule struct {
+	RuleID     int64  `json:"rule_id"`
+	CategoryID *int64 `json:"category_id,omitempty"`
+	IsPersonal *bool  `json:"is_personal,omitempty"`
+}
+
+// dryRunConflict is an expense on which matching rules disagree about a field. The first
+// rule in evaluation order wins.
+type dryRunConflict struct {
+	ExpenseID    int64                `json:"expense_id"`
+	ProjectID    int64                `json:"project_id"`
+	RowIndex     int                  `json:"row_index"`
+	Description  string               `json:"description"`
+	Field        string               `json:"field"` // category or is_personal
+	WinnerRuleID int64                `json:"winner_rule_id"`
+	Rules        []dryRunConflictRule `json:"rules"`
+}
+
+// dryRunReport is what a set of rules, or a draft among them, would do
+type dryRunReport struct {
+	ProjectIDs        []int64          `json:"project_ids"`         // projects evaluated
+	SkippedProjectIDs []int64          `json:"skipped_project_ids"` // projects whose list lacks the draft's category
+	EvaluatedCount    int              `json:"evaluated_count"`
+	MatchedCount      int              `json:"matched_count"`
+	WouldApplyCount   int              `json:"would_apply_count"`
+	OverrideCount     int              `json:"override_count"`
+	ConflictCount     int              `json:"conflict_count"`
+	Matched           []dryRunRow      `json:"matched"`
+	Overrides         []dryRunRow      `json:"overrides"` // rows whose accepted category the rules would replace
+	Conflicts         []dryRunConflict `json:"conflicts"`
+}
+
+// reportRuleID shows the draft's stand-in ID as 0
+func reportRuleID(ruleID int64) int64 {
+	if ruleID == draftRuleID {
+		return 0
+	}
+	return ruleID
+}
+
+// reportRuleIDs maps reportRuleID over rule IDs
+func reportRuleIDs(ruleIDs []int64) []int64 {
+	reported := make([]int64, len(ruleIDs))
+	for i, ruleID := range ruleIDs {
+		reported[i] = reportRuleID(ruleID)
+	}
+	return reported
+}
+
+// ruleConflicts lists the fields on which the matching rules (in evaluation order) set
+// different values
+func ruleConflicts(matching []*rules.Rule) map[string][]dryRunConflictRule {
+	conflicts := make(map[string][]dryRunConflictRule)
+
+	var categorySides, personalSides []dryRunConflictRule
+	categories := make(map[int64]bool)
+	personal := make(map[bool]bool)
+	for _, rule := range matching {
+		if categoryID := rule.Actions.CategoryID; categoryID != nil {
+			categorySides = append(categorySides, dryRunConflictRule{RuleID: reportRuleID(rule.ID), CategoryID: categoryID})
+			categories[*categoryID] = true
+		}
+		if isPersonal := rule.Actions.IsPersonal; isPersonal != nil {
+			personalSides = append(personalSides, dryRunConflictRule{RuleID: reportRuleID(rule.ID), IsPersonal: isPersonal})
+			personal[*isPersonal] = true
+		}
+	}
+	if len(categories) > 1 {
+		conflicts["category"] = categorySides
+	}
+	if len(personal) > 1 {
+		conflicts["is_personal"] = personalSides
+	}
+	return conflicts
+}
+
+// dryRunProject evaluates rules over all of a project's rule-eligible expenses, accepted or
+// not, adding to the report. With a draft, only rows the draft matches are reported, an
+// override is a row where the draft's category wins over a different accepted one, and
+// only conflicts the draft takes part in are listed.
+func dryRunProject(ctx context.Context, q dbQuerier, projectID int64, ruleSet []*rules.Rule, draft *rules.Rule,
+	limit int, report *dryRunReport) error {
+	rows, err := q.Query(ctx, ruleExpenseSelect+`
+		ORDER BY row_index ASC
+	`, projectID)
+	if err != nil {
+		return err
+	}
+	expenses, err := scanRuleCandidates(rows)
+	if err != nil {
+		return err
+	}
+
+	report.EvaluatedCount += len(expenses)
+	for _, expense := range expenses {
+		if draft != nil && !draft.Matches(expense.Expense) {
+			continue
+		}
+		outcome := rules.Evaluate(ruleSet, expense.Expense)
+		if !outcome.Matched() {
+			continue
+		}
+
+		_, changed := planRuleOutcome(expense, outcome)
+		row := dryRunRow{
+			ExpenseID:          expense.ID,
+			ProjectID:          projectID,
+			RowIndex:           expense.RowIndex,
+			Description:        expense.Expense.Description,
+			Amount:             expense.Expense.Amount,
+			AcceptedCategoryID: expense.State.AcceptedCategoryID,
+			CategoryID:         outcome.CategoryID,
+			CategoryRuleID:     reportRuleID(outcome.CategoryRuleID),
+			IsPersonal:         outcome.IsPersonal,
+			Tags:               outcome.Tags,
+			RuleIDs:            reportRuleIDs(outcome.MatchedRuleIDs),
+			WouldApply:         expense.State.AcceptedCategoryID == nil && changed,
+		}
+
+		report.MatchedCount++
+		if len(report.Matched) < limit {
+			report.Matched = append(report.Matched, row)
+		}
+		if row.WouldApply {
+			report.WouldApplyCount++
+		}
+
+		overrides := expense.State.AcceptedCategoryID != nil && outcome.CategoryID != nil &&
+			!sameCategoryID(expense.State.AcceptedCategoryID, outcome.CategoryID)
+		if draft != nil && outcome.CategoryRuleID != draft.ID {
+			overrides = false
+		}
+		if overrides {
+			report.OverrideCount++
+			if len(report.Overrides) < limit {
+				report.Overrides = append(report.Overrides, row)
+			}
+		}
+
+		var matching []*rules.Rule
+		for _, rule := range ruleSet {
+			if containsRuleID(outcome.MatchedRuleIDs, rule.ID) {
+				matching = append(matching, rule)
+			}
+		}
+		conflicts := ruleConflicts(matching)
+		for _, field := range []string{"category", "is_personal"} {
+			sides, ok := conflicts[field]
+			if !ok {
+				continue
+			}
+			if draft != nil && !conflictIncludes(sides, reportRuleID(draft.ID)) {
+				continue
+			}
+			report.ConflictCount++
+			if len(report.Conflicts) < limit {
+				report.Conflicts = append(report.Conflicts, dryRunConflict{
+					ExpenseID:    expense.ID,
+					ProjectID:    projectID,
+					RowIndex:     expense.RowIndex,
+					Description:  expense.Expense.Description,
+					Field:        field,
+					WinnerRuleID: sides[0].RuleID,
+					Rules:        sides,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// containsRuleID reports whether ruleIDs contains ruleID
+func containsRuleID(ruleIDs []int64, ruleID int64) bool {
+	for _, id := range ruleIDs {
+		if id == ruleID {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictIncludes reports whether a rule is one of a conflict's sides
+func conflictIncludes(sides []dryRunConflictRule, ruleID int64) bool {
+	for _, side := range sides {
+		if side.RuleID == ruleID {
+			return true
+		}
+	}
+	return false
+}
+
+// DryRunRules reports what categorization rules would do without changing anything. It
+// evaluates a draft rule (rule), a saved rule (rule_id, or with rule the saved rule as
+// edited), or without either the full enabled rule set, against one project (project_id)
+// or all of the user's projects. A draft runs alongside the enabled rules in its scope,
+// whether or not it is enabled itself. The report lists the matched rows, the rows whose
+// accepted category would be overridden, and the rows on which matching rules disagree.
+// Rows already categorized are evaluated too, though applying rules leaves them alone.
+func DryRunRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		ProjectID *int64 `json:"project_id"`
+		RuleID    *int64 `json:"rule_id"`
+		Rule      *struct {
+			ProjectID  *int64                `json:"project_id"`
+			Name       string                `json:"name"`
+			Priority   *int                  `json:"priority"`
+			Conditions models.RuleConditions `json:"conditions"`
+			Actions    models.RuleActions    `json:"actions"`
+		} `json:"rule"`
+		Limit *int `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultDryRunLimit
+	if req.Limit != nil {
+		if *req.Limit < 0 {
+			http.Error(w, "limit cannot be negative", http.StatusBadRequest)
+			return
+		}
+		limit = *req.Limit
+	}
+
+	var draft *rules.Rule
+	if req.RuleID != nil || req.Rule != nil {
+		rule := models.CategorizationRule{ID: draftRuleID, Name: "Draft", Priority: defaultRulePriority}
+		if req.RuleID != nil {
+			saved, err := loadRule(ctx, database.Pool, *req.RuleID)
+			if err == pgx.ErrNoRows {
+				http.Error(w, "Rule not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to get rule: %v", err), http.StatusInternalServerError)
+				return
+			}
+			rule = saved
+		}
+		if req.Rule != nil {
+			if req.RuleID == nil {
+				rule.ProjectID = req.Rule.ProjectID
+			}
+			if req.Rule.Name != "" {
+				rule.Name = req.Rule.Name
+			}
+			if req.Rule.Priority != nil {
+				rule.Priority = *req.Rule.Priority
+			}
+			rule.Conditions = req.Rule.Conditions
+			rule.Actions = req.Rule.Actions
+		}
+
+		var ok bool
+		if draft, ok = compileRuleRequest(ctx, w, rule); !ok {
+			return
+		}
+	}
+
+	scope := req.ProjectID
+	if draft != nil && draft.ProjectID != nil {
+		if scope != nil && *scope != *draft.ProjectID {
+			http.Error(w, "The rule only runs on its own project", http.StatusBadRequest)
+			return
+		}
+		scope = draft.ProjectID
+	}
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT id FROM project
+		WHERE user_id = $1 AND deleted_at IS NULL AND ($2::bigint IS NULL OR id = $2)
+		ORDER BY id ASC
+	`, models.TEST_USER_ID, scope)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch projects: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var projectIDs []int64
+	for rows.Next() {
+		var projectID int64
+		if err := rows.Scan(&projectID); err != nil {
+			rows.Close()
+			http.Error(w, fmt.Sprintf("Failed to fetch projects: %v", err), http.StatusInternalServerError)
+			return
+		}
+		projectIDs = append(projectIDs, projectID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch projects: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if scope != nil && len(projectIDs) == 0 {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	report := dryRunReport{
+		ProjectIDs:        []int64{},
+		SkippedProjectIDs: []int64{},
+		Matched:           []dryRunRow{},
+		Overrides:         []dryRunRow{},
+		Conflicts:         []dryRunConflict{},
+	}
+	for _, projectID := range projectIDs {
+		ruleSet, err := projectRules(ctx, database.Pool, projectID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch rules: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if draft != nil {
+			if categoryID := draft.Actions.CategoryID; categoryID != nil {
+				err := checkProjectCategory(ctx, database.Pool, projectID, *categoryID)
+				if err == errCategoryNotInProject {
+					report.SkippedProjectIDs = append(report.SkippedProjectIDs, projectID)
+					continue
+				}
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Failed to check category: %v", err), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			withDraft := []*rules.Rule{draft}
+			for _, rule := range ruleSet {
+				if rule.ID != draft.ID {
+					withDraft = append(withDraft, rule)
+				}
+			}
+			rules.Sort(withDraft)
+			ruleSet = withDraft
+		}
+
+		report.ProjectIDs = append(report.ProjectIDs, projectID)
+		if err := dryRunProject(ctx, database.Pool, projectID, ruleSet, draft, limit, &report); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to evaluate rules: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
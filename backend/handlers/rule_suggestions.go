@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+	"ookkee/rules"
+)
+
+// Defaults for the rule suggestion thresholds
+const (
+	defaultSuggestionMinSupport   = 3
+	defaultSuggestionMinPrecision = 0.9
+	defaultSuggestionLimit        = 50
+)
+
+// ruleSuggestion is a mined pattern with what accepting it would create and change
+type ruleSuggestion struct {
+	rules.Suggestion
+	Key            string `json:"key"`
+	CategoryPath   string `json:"category_path"`
+	ProjectID      *int64 `json:"project_id"`      // scope of the rule: the category's project, nil for all projects
+	PendingMatches int    `json:"pending_matches"` // uncategorized expenses the rule would categorize now
+}
+
+// suggestionCategory is an active category a suggested rule can point at
+type suggestionCategory struct {
+	ProjectID *int64
+	Path      string
+}
+
+// loadRuleHistory reads the accepted categorizations in the user's active projects that
+// rules could have made: active expenses that are not transfers or linked refunds
+func loadRuleHistory(ctx context.Context, q dbQuerier) ([]rules.History, error) {
+	rows, err := q.Query(ctx, `
+		SELECT COALESCE(e.description, ''), e.vendor_id, COALESCE(v.name, ''), e.accepted_category_id
+		FROM expense e
+		JOIN project p ON p.id = e.project_id
+		LEFT JOIN vendor v ON v.id = e.vendor_id
+		WHERE p.user_id = $1
+		  AND p.deleted_at IS NULL
+		  AND e.deleted_at IS NULL
+		  AND e.transfer_id IS NULL
+		  AND e.refund_of_expense_id IS NULL
+		  AND e.accepted_category_id IS NOT NULL
+		ORDER BY e.id ASC
+	`, models.TEST_USER_ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []rules.History{}
+	for rows.Next() {
+		var h rules.History
+		if err := rows.Scan(&h.Description, &h.VendorID, &h.VendorName, &h.CategoryID); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+// loadSuggestionCategories reads the user's active categories with their paths, leaving out
+// those of deleted projects and those under an archived parent
+func loadSuggestionCategories(ctx context.Context, q dbQuerier) (map[int64]suggestionCategory, error) {
+	rows, err := q.Query(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT c.id, c.project_id, c.name::text AS path
+			FROM expense_category c
+			LEFT JOIN project p ON p.id = c.project_id
+			WHERE c.user_id = $1 AND c.deleted_at IS NULL AND c.parent_id IS NULL
+			  AND (c.project_id IS NULL OR p.deleted_at IS NULL)
+			UNION ALL
+			SELECT c.id, c.project_id, tree.path || $2 || c.name
+			FROM expense_category c
+			JOIN tree ON c.parent_id = tree.id
+			WHERE c.deleted_at IS NULL
+		)
+		SELECT id, project_id, path FROM tree
+	`, models.TEST_USER_ID, categoryPathSeparator)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make(map[int64]suggestionCategory)
+	for rows.Next() {
+		var id int64
+		var category suggestionCategory
+		if err := rows.Scan(&id, &category.ProjectID, &category.Path); err != nil {
+			return nil, err
+		}
+		categories[id] = category
+	}
+	return categories, rows.Err()
+}
+
+// ruleCoversSuggestion reports whether an existing rule already has exactly the suggested
+// pattern as its only condition, whatever its actions
+func ruleCoversSuggestion(rule models.CategorizationRule, suggestion rules.Suggestion) bool {
+	conditions := rule.Conditions
+	if conditions.DescriptionRegex != "" || conditions.Source != "" || conditions.AmountMin != nil ||
+		conditions.AmountMax != nil || len(conditions.RawData) > 0 {
+		return false
+	}
+	if suggestion.Kind == rules.SuggestVendor {
+		return conditions.DescriptionContains == "" && conditions.VendorID != nil &&
+			suggestion.VendorID != nil && *conditions.VendorID == *suggestion.VendorID
+	}
+	return conditions.VendorID == nil && strings.EqualFold(strings.TrimSpace(conditions.DescriptionContains), suggestion.Pattern)
+}
+
+// loadAllRules reads every rule of the user, in all scopes
+func loadAllRules(ctx context.Context, q dbQuerier) ([]models.CategorizationRule, error) {
+	rows, err := q.Query(ctx, ruleSelect+`
+		WHERE user_id = $1
+		ORDER BY id ASC
+	`, models.TEST_USER_ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loaded := []models.CategorizationRule{}
+	for rows.Next() {
+		var rule models.CategorizationRule
+		if err := scanRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, rule)
+	}
+	return loaded, rows.Err()
+}
+
+// pendingProject is a project's current rule candidates and category list
+type pendingProject struct {
+	ID         int64
+	Candidates []ruleCandidate
+	Categories map[int64]bool
+}
+
+// loadPendingProjects reads the rule candidates and category list of each active project
+func loadPendingProjects(ctx context.Context, q dbQuerier) ([]pendingProject, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id FROM project WHERE user_id = $1 AND deleted_at IS NULL ORDER BY id ASC
+	`, models.TEST_USER_ID)
+	if err != nil {
+		return nil, err
+	}
+	var projectIDs []int64
+	for rows.Next() {
+		var projectID int64
+		if err := rows.Scan(&projectID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		projectIDs = append(projectIDs, projectID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	projects := []pendingProject{}
+	for _, projectID := range projectIDs {
+		candidates, err := loadRuleCandidates(ctx, q, projectID, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		project := pendingProject{ID: projectID, Candidates: candidates, Categories: make(map[int64]bool)}
+		categoryRows, err := q.Query(ctx, `SELECT id FROM project_categories($1)`, projectID)
+		if err != nil {
+			return nil, err
+		}
+		for categoryRows.Next() {
+			var categoryID int64
+			if err := categoryRows.Scan(&categoryID); err != nil {
+				categoryRows.Close()
+				return nil, err
+			}
+			project.Categories[categoryID] = true
+		}
+		categoryRows.Close()
+		if err := categoryRows.Err(); err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, nil
+}
+
+// countPendingMatches counts the uncategorized expenses a suggested rule would match in the
+// projects it runs on
+func countPendingMatches(rule *rules.Rule, projects []pendingProject) int {
+	count := 0
+	for _, project := range projects {
+		if rule.ProjectID != nil && *rule.ProjectID != project.ID {
+			continue
+		}
+		if !project.Categories[*rule.Actions.CategoryID] {
+			continue
+		}
+		for _, candidate := range project.Candidates {
+			if rule.Matches(candidate.Expense) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// GetRuleSuggestions proposes categorization rules mined from the accepted categories in
+// all of the user's projects: vendors and description words whose expenses nearly all share
+// one category. Each suggestion reports its support (expenses matched), precision (share in
+// the category), coverage (share of all accepted history it explains) and how many
+// uncategorized expenses it would settle now. Patterns an existing rule already uses are
+// left out. Query parameters: min_support (default 3), min_precision (0-1, default 0.9)
+// and limit (default 50).
+func GetRuleSuggestions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	opts := rules.SuggestOptions{MinSupport: defaultSuggestionMinSupport, MinPrecision: defaultSuggestionMinPrecision}
+	if value := query.Get("min_support"); value != "" {
+		minSupport, err := strconv.Atoi(value)
+		if err != nil || minSupport < 1 {
+			http.Error(w, "min_support must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		opts.MinSupport = minSupport
+	}
+	if value := query.Get("min_precision"); value != "" {
+		minPrecision, err := strconv.ParseFloat(value, 64)
+		if err != nil || minPrecision < 0 || minPrecision > 1 {
+			http.Error(w, "min_precision must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		opts.MinPrecision = minPrecision
+	}
+	limit := defaultSuggestionLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	history, err := loadRuleHistory(ctx, database.Pool)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch categorization history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	categories, err := loadSuggestionCategories(ctx, database.Pool)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch categories: %v", err), http.StatusInternalServerError)
+		return
+	}
+	existing, err := loadAllRules(ctx, database.Pool)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	projects, err := loadPendingProjects(ctx, database.Pool)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch uncategorized expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	suggestions := []ruleSuggestion{}
+	for _, suggestion := range rules.Suggest(history, opts) {
+		if len(suggestions) == limit {
+			break
+		}
+		category, ok := categories[suggestion.CategoryID]
+		if !ok {
+			continue
+		}
+		covered := false
+		for _, rule := range existing {
+			if ruleCoversSuggestion(rule, suggestion) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+
+		rule := suggestion.Rule()
+		rule.ProjectID = category.ProjectID
+		compiled, err := rules.Compile(rule)
+		if err != nil {
+			continue // a vendor with a blank name
+		}
+		suggestions = append(suggestions, ruleSuggestion{
+			Suggestion:     suggestion,
+			Key:            suggestion.Key(),
+			CategoryPath:   category.Path,
+			ProjectID:      category.ProjectID,
+			PendingMatches: countPendingMatches(compiled, projects),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"suggestions":   suggestions,
+		"history_count": len(history),
+		"min_support":   opts.MinSupport,
+		"min_precision": opts.MinPrecision,
+	})
+}
+
+// AcceptRuleSuggestion turns a suggestion (its key) into an enabled rule, scoped like the
+// category it sets. The name and priority can be given; they default to the pattern and
+// 100. A pattern an existing rule already uses is a conflict.
+func AcceptRuleSuggestion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		Key      string  `json:"key"`
+		Name     *string `json:"name"`
+		Priority *int    `json:"priority"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	suggestion, err := rules.ParseSuggestionKey(req.Key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	projectID, err := categoryProjectID(ctx, database.Pool, suggestion.CategoryID)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Suggested category not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if suggestion.Kind == rules.SuggestVendor {
+		err := database.Pool.QueryRow(ctx, `
+			SELECT name FROM vendor WHERE id = $1 AND user_id = $2
+		`, *suggestion.VendorID, models.TEST_USER_ID).Scan(&suggestion.Pattern)
+		if err == pgx.ErrNoRows {
+			http.Error(w, "Rule vendor not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get vendor: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	existing, err := loadAllRules(ctx, database.Pool)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	for _, rule := range existing {
+		if ruleCoversSuggestion(rule, suggestion) {
+			http.Error(w, fmt.Sprintf("Rule %q already uses this pattern", rule.Name), http.StatusConflict)
+			return
+		}
+	}
+
+	rule := suggestion.Rule()
+	rule.ProjectID = projectID
+	rule.Priority = defaultRulePriority
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+
+	compiled, ok := compileRuleRequest(ctx, w, rule)
+	if !ok {
+		return
+	}
+
+	created, err := insertRule(ctx, database.Pool, compiled)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
@@ -0,0 +1,590 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+	"ookkee/rules"
+)
+
+// defaultRulePriority is the priority of rules created without one
+const defaultRulePriority = 100
+
+// ruleSelect reads categorization_rule rows
+const ruleSelect = `
+	SELECT id, project_id, name, priority, enabled, conditions, actions, created_at, updated_at
+	FROM categorization_rule`
+
+// scanRule scans a row read with ruleSelect
+func scanRule(row pgx.Row, rule *models.CategorizationRule) error {
+	var conditions, actions []byte
+	err := row.Scan(&rule.ID, &rule.ProjectID, &rule.Name, &rule.Priority, &rule.Enabled, &conditions, &actions,
+		&rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(conditions, &rule.Conditions); err != nil {
+		return fmt.Errorf("rule %d has invalid conditions: %w", rule.ID, err)
+	}
+	if err := json.Unmarshal(actions, &rule.Actions); err != nil {
+		return fmt.Errorf("rule %d has invalid actions: %w", rule.ID, err)
+	}
+	return nil
+}
+
+// loadRules reads the user's rules in evaluation order. With applicable unset it reads one
+// list: a project's own rules, or with projectID nil the user-wide ones. With applicable
+// set it reads the enabled rules that run on the project: its own and the user-wide ones.
+func loadRules(ctx context.Context, q dbQuerier, projectID *int64, applicable bool) ([]models.CategorizationRule, error) {
+	scope := "project_id IS NOT DISTINCT FROM $2"
+	if applicable {
+		scope = "enabled AND (project_id IS NULL OR project_id = $2)"
+	}
+	rows, err := q.Query(ctx, ruleSelect+`
+		WHERE user_id = $1 AND `+scope+`
+		ORDER BY priority ASC, id ASC
+	`, models.TEST_USER_ID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loaded := []models.CategorizationRule{}
+	for rows.Next() {
+		var rule models.CategorizationRule
+		if err := scanRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, rule)
+	}
+	return loaded, rows.Err()
+}
+
+// loadRule reads one of the user's rules
+func loadRule(ctx context.Context, q dbQuerier, ruleID int64) (models.CategorizationRule, error) {
+	var rule models.CategorizationRule
+	err := scanRule(q.QueryRow(ctx, ruleSelect+`
+		WHERE user_id = $1 AND id = $2
+	`, models.TEST_USER_ID, ruleID), &rule)
+	return rule, err
+}
+
+// projectRules compiles the enabled rules that run on a project, in evaluation order. Rules
+// that no longer compile, or whose category is not in the project's list, are skipped.
+func projectRules(ctx context.Context, q dbQuerier, projectID int64) ([]*rules.Rule, error) {
+	loaded, err := loadRules(ctx, q, &projectID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := []*rules.Rule{}
+	for _, rule := range loaded {
+		ready, err := rules.Compile(rule)
+		if err != nil {
+			log.Printf("Skipping categorization rule %d: %v", rule.ID, err)
+			continue
+		}
+		if categoryID := ready.Actions.CategoryID; categoryID != nil {
+			err := checkProjectCategory(ctx, q, projectID, *categoryID)
+			if err == errCategoryNotInProject {
+				log.Printf("Skipping categorization rule %d on project %d: category %d is not in its list", rule.ID, projectID, *categoryID)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		compiled = append(compiled, ready)
+	}
+	rules.Sort(compiled)
+	return compiled, nil
+}
+
+// ruleCandidate is an expense the rules may change: active, not a transfer or a linked
+// refund, and without an accepted category
+type ruleCandidate struct {
+	ID       int64
+	RowIndex int
+	Expense  rules.Expense
+	State    expenseState // with its tags
+}
+
+// ruleExpenseSelect reads a project's expenses that rules look at: active, not transfers
+// and not linked refunds. Callers add filters, ordering and locking.
+const ruleExpenseSelect = `
+	SELECT id, row_index, COALESCE(description, ''), vendor_id, COALESCE(source, ''), amount, raw_data,
+	       accepted_category_id, suggested_category_id, COALESCE(is_personal, FALSE), business_pct, tags
+	FROM expense
+	WHERE project_id = $1
+	  AND deleted_at IS NULL
+	  AND transfer_id IS NULL
+	  AND refund_of_expense_id IS NULL`
+
+// scanRuleCandidates scans rows read with ruleExpenseSelect
+func scanRuleCandidates(rows pgx.Rows) ([]ruleCandidate, error) {
+	defer rows.Close()
+
+	candidates := []ruleCandidate{}
+	for rows.Next() {
+		var candidate ruleCandidate
+		var rawData json.RawMessage
+		err := rows.Scan(&candidate.ID, &candidate.RowIndex, &candidate.Expense.Description, &candidate.Expense.VendorID,
+			&candidate.Expense.Source, &candidate.Expense.Amount, &rawData, &candidate.State.AcceptedCategoryID,
+			&candidate.State.SuggestedCategoryID, &candidate.State.IsPersonal, &candidate.State.BusinessPct, &candidate.State.Tags)
+		if err != nil {
+			return nil, err
+		}
+		if candidate.State.Tags == nil {
+			candidate.State.Tags = []string{}
+		}
+		candidate.Expense.RawData = rules.ParseRawData(rawData)
+		candidates = append(candidates, candidate)
+	}
+	return candidates, rows.Err()
+}
+
+// loadRuleCandidates reads a project's rule candidates, locking them when lock is set
+func loadRuleCandidates(ctx context.Context, q dbQuerier, projectID int64, lock bool) ([]ruleCandidate, error) {
+	locking := ""
+	if lock {
+		locking = "FOR UPDATE"
+	}
+	rows, err := q.Query(ctx, ruleExpenseSelect+`
+		  AND accepted_category_id IS NULL
+		ORDER BY row_index ASC
+		`+locking, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return scanRuleCandidates(rows)
+}
+
+// planRuleOutcome works out a candidate's state, tags included, after the rules' outcome,
+// and whether anything changes. A personal flag the row already has leaves its business
+// percentage alone.
+func planRuleOutcome(candidate ruleCandidate, outcome rules.Outcome) (expenseState, bool) {
+	state := candidate.State
+	changed := false
+
+	if outcome.CategoryID != nil && !sameCategoryID(state.AcceptedCategoryID, outcome.CategoryID) {
+		state.AcceptedCategoryID = outcome.CategoryID
+		changed = true
+	}
+	if outcome.IsPersonal != nil && *outcome.IsPersonal != state.IsPersonal {
+		state.IsPersonal = *outcome.IsPersonal
+		businessPct := 100
+		if state.IsPersonal {
+			businessPct = 0
+		}
+		state.BusinessPct = &businessPct
+		changed = true
+	}
+
+	state.Tags = append([]string{}, candidate.State.Tags...)
+	for _, tag := range outcome.Tags {
+		if !containsString(state.Tags, tag) {
+			state.Tags = append(state.Tags, tag)
+			changed = true
+		}
+	}
+	return state, changed
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// applyCategorizationRules runs a project's rules over its uncategorized expenses. All the
+// changes, tags included, are one undo step and every changed row gets a rule_apply history
+// entry. Returns the number of expenses changed.
+func applyCategorizationRules(ctx context.Context, tx pgx.Tx, projectID int64) (int, error) {
+	compiled, err := projectRules(ctx, tx, projectID)
+	if err != nil || len(compiled) == 0 {
+		return 0, err
+	}
+
+	candidates, err := loadRuleCandidates(ctx, tx, projectID, true)
+	if err != nil {
+		return 0, err
+	}
+
+	type application struct {
+		change  expenseChange
+		ruleIDs []int64
+		refunds []expenseChange
+	}
+	var applications []application
+	var changes []expenseChange
+	for _, candidate := range candidates {
+		outcome := rules.Evaluate(compiled, candidate.Expense)
+		if !outcome.Matched() {
+			continue
+		}
+		state, changed := planRuleOutcome(candidate, outcome)
+		if !changed {
+			continue
+		}
+
+		_, err := tx.Exec(ctx, `
+			UPDATE expense
+			SET accepted_category_id = $2::bigint,
+			    accepted_at = CASE
+			        WHEN accepted_category_id IS NOT DISTINCT FROM $2::bigint THEN accepted_at
+			        ELSE CURRENT_TIMESTAMP
+			    END,
+			    is_personal = $3, business_pct = $4, tags = $5, version = version + 1
+			WHERE id = $1
+		`, candidate.ID, state.AcceptedCategoryID, state.IsPersonal, state.BusinessPct, state.Tags)
+		if err != nil {
+			return 0, fmt.Errorf("failed to apply rules to expense %d: %w", candidate.ID, err)
+		}
+
+		app := application{
+			change:  expenseChange{ExpenseID: candidate.ID, Old: candidate.State, New: state},
+			ruleIDs: outcome.MatchedRuleIDs,
+		}
+		if state.AcceptedCategoryID != nil && !sameCategoryID(candidate.State.AcceptedCategoryID, state.AcceptedCategoryID) {
+			if app.refunds, err = syncRefundCategories(ctx, tx, candidate.ID, *state.AcceptedCategoryID); err != nil {
+				return 0, err
+			}
+		}
+		changes = append(changes, app.change)
+		changes = append(changes, app.refunds...)
+		applications = append(applications, app)
+	}
+
+	changeSetID, err := recordChangeSet(ctx, tx, projectID, changeActionApplyRules, changes)
+	if err != nil {
+		return 0, err
+	}
+	var setID *int64
+	if changeSetID != 0 {
+		setID = &changeSetID
+	}
+
+	var history []historyEntry
+	for _, app := range applications {
+		history = append(history, historyEntry{
+			ExpenseID:  app.change.ExpenseID,
+			EventType:  historyEventRuleApply,
+			CategoryID: app.change.New.AcceptedCategoryID,
+			OldValue: map[string]interface{}{
+				"accepted_category_id": app.change.Old.AcceptedCategoryID,
+				"is_personal":          app.change.Old.IsPersonal,
+				"business_pct":         app.change.Old.BusinessPct,
+				"tags":                 app.change.Old.Tags,
+			},
+			NewValue: map[string]interface{}{
+				"accepted_category_id": app.change.New.AcceptedCategoryID,
+				"is_personal":          app.change.New.IsPersonal,
+				"business_pct":         app.change.New.BusinessPct,
+				"tags":                 app.change.New.Tags,
+				"rule_ids":             app.ruleIDs,
+			},
+			ChangeSetID: setID,
+		})
+		for _, refund := range app.refunds {
+			history = append(history, changeHistoryEntries(refund, changeSetID, &app.change.ExpenseID)...)
+		}
+	}
+	if err := recordHistory(ctx, tx, history...); err != nil {
+		return 0, err
+	}
+
+	return len(applications), nil
+}
+
+// applyRulesBeforeAI runs the categorization rules so the rows they settle are not sent to
+// the model. Failures are logged and the AI batch goes ahead.
+func applyRulesBeforeAI(ctx context.Context, projectID int64) int {
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("Failed to apply categorization rules: %v", err)
+		return 0
+	}
+	defer tx.Rollback(ctx)
+
+	applied, err := applyCategorizationRules(ctx, tx, projectID)
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		log.Printf("Failed to apply categorization rules: %v", err)
+		return 0
+	}
+	if applied > 0 {
+		log.Printf("Categorization rules updated %d expenses in project %d", applied, projectID)
+	}
+	return applied
+}
+
+// compileRuleRequest validates a rule for saving: it must compile, and its category and
+// vendor must belong to the user and fit the rule's scope. It writes an error response on
+// failure.
+func compileRuleRequest(ctx context.Context, w http.ResponseWriter, rule models.CategorizationRule) (*rules.Rule, bool) {
+	compiled, err := rules.Compile(rule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if categoryID := compiled.Actions.CategoryID; categoryID != nil {
+		err := checkScopeCategory(ctx, database.Pool, compiled.ProjectID, *categoryID)
+		if err == errCategoryNotInProject {
+			http.Error(w, "Rule category is not in the rule's category list", http.StatusBadRequest)
+			return nil, false
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check category: %v", err), http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+
+	if vendorID := compiled.Conditions.VendorID; vendorID != nil {
+		var exists bool
+		err := database.Pool.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM vendor WHERE id = $1 AND user_id = $2)
+		`, *vendorID, models.TEST_USER_ID).Scan(&exists)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check vendor: %v", err), http.StatusInternalServerError)
+			return nil, false
+		}
+		if !exists {
+			http.Error(w, "Rule vendor not found", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	return compiled, true
+}
+
+// insertRule saves a compiled rule for the user and reads it back
+func insertRule(ctx context.Context, q dbQuerier, compiled *rules.Rule) (models.CategorizationRule, error) {
+	conditions, err := json.Marshal(compiled.Conditions)
+	if err != nil {
+		return models.CategorizationRule{}, err
+	}
+	actions, err := json.Marshal(compiled.Actions)
+	if err != nil {
+		return models.CategorizationRule{}, err
+	}
+
+	var ruleID int64
+	err = q.QueryRow(ctx, `
+		INSERT INTO categorization_rule (user_id, project_id, name, priority, enabled, conditions, actions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, models.TEST_USER_ID, compiled.ProjectID, compiled.Name, compiled.Priority, compiled.Enabled,
+		conditions, actions).Scan(&ruleID)
+	if err != nil {
+		return models.CategorizationRule{}, err
+	}
+	return loadRule(ctx, q, ruleID)
+}
+
+// GetRules lists the user-wide categorization rules, or with project_id a project's own
+// rules, in evaluation order
+func GetRules(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := categoryListParam(w, r)
+	if !ok {
+		return
+	}
+
+	loaded, err := loadRules(r.Context(), database.Pool, projectID, false)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loaded)
+}
+
+// CreateRule adds a categorization rule for all projects, or for one (project_id).
+// Priority defaults to 100 and new rules are enabled unless enabled is false.
+func CreateRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		ProjectID  *int64                `json:"project_id"`
+		Name       string                `json:"name"`
+		Priority   *int                  `json:"priority"`
+		Enabled    *bool                 `json:"enabled"`
+		Conditions models.RuleConditions `json:"conditions"`
+		Actions    models.RuleActions    `json:"actions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID != nil {
+		var exists bool
+		err := database.Pool.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM project WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+		`, *req.ProjectID, models.TEST_USER_ID).Scan(&exists)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	rule := models.CategorizationRule{
+		ProjectID:  req.ProjectID,
+		Name:       req.Name,
+		Priority:   defaultRulePriority,
+		Enabled:    true,
+		Conditions: req.Conditions,
+		Actions:    req.Actions,
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+
+	compiled, ok := compileRuleRequest(ctx, w, rule)
+	if !ok {
+		return
+	}
+
+	created, err := insertRule(ctx, database.Pool, compiled)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdateRule changes a rule's name, priority, enabled flag, conditions or actions. Fields
+// that are omitted are left alone; conditions and actions are replaced as a whole.
+func UpdateRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ruleID, err := strconv.ParseInt(chi.URLParam(r, "ruleID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name       *string                `json:"name"`
+		Priority   *int                   `json:"priority"`
+		Enabled    *bool                  `json:"enabled"`
+		Conditions *models.RuleConditions `json:"conditions"`
+		Actions    *models.RuleActions    `json:"actions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := loadRule(ctx, database.Pool, ruleID)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.Conditions != nil {
+		rule.Conditions = *req.Conditions
+	}
+	if req.Actions != nil {
+		rule.Actions = *req.Actions
+	}
+
+	compiled, ok := compileRuleRequest(ctx, w, rule)
+	if !ok {
+		return
+	}
+
+	conditions, err := json.Marshal(compiled.Conditions)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode conditions: %v", err), http.StatusInternalServerError)
+		return
+	}
+	actions, err := json.Marshal(compiled.Actions)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode actions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = database.Pool.Exec(ctx, `
+		UPDATE categorization_rule
+		SET name = $2, priority = $3, enabled = $4, conditions = $5, actions = $6, updated_at = NOW()
+		WHERE id = $1
+	`, ruleID, compiled.Name, compiled.Priority, compiled.Enabled, conditions, actions)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := loadRule(ctx, database.Pool, ruleID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteRule removes a categorization rule. Expenses it already changed keep their values.
+func DeleteRule(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ruleID, err := strconv.ParseInt(chi.URLParam(r, "ruleID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := database.Pool.Exec(ctx, `
+		DELETE FROM categorization_rule WHERE id = $1 AND user_id = $2
+	`, ruleID, models.TEST_USER_ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Rule deleted successfully"}`))
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// dbQuerier is satisfied by both the connection pool and a transaction
+type dbQuerier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// defaultUserSettings are used until a user saves their own
+var defaultUserSettings = models.UserSettings{
+	PropagationMode:            models.PropagationExact,
+	PropagationThreshold:       0.6,
+	PropagationAmountTolerance: 0,
+}
+
+// loadUserSettings returns the current user's settings, falling back to defaults
+func loadUserSettings(ctx context.Context, q dbQuerier) (models.UserSettings, error) {
+	settings := defaultUserSettings
+	err := q.QueryRow(ctx, `
+		SELECT propagation_mode, propagation_threshold, propagation_amount_tolerance, updated_at
+		FROM user_settings
+		WHERE user_id = $1
+	`, models.TEST_USER_ID).Scan(&settings.PropagationMode, &settings.PropagationThreshold,
+		&settings.PropagationAmountTolerance, &settings.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return defaultUserSettings, nil
+	}
+	return settings, err
+}
+
+// validatePropagationSettings checks mode, threshold and tolerance ranges
+func validatePropagationSettings(settings models.UserSettings) error {
+	switch settings.PropagationMode {
+	case models.PropagationOff, models.PropagationExact, models.PropagationNormalized,
+		models.PropagationTrigram, models.PropagationAmount, models.PropagationVendor:
+	default:
+		return fmt.Errorf("propagation_mode must be one of off, exact, normalized, trigram, amount, vendor")
+	}
+	if settings.PropagationThreshold <= 0 || settings.PropagationThreshold > 1 {
+		return fmt.Errorf("propagation_threshold must be greater than 0 and at most 1")
+	}
+	if settings.PropagationAmountTolerance < 0 {
+		return fmt.Errorf("propagation_amount_tolerance must not be negative")
+	}
+	return nil
+}
+
+// GetSettings returns the current user's settings
+func GetSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	settings, err := loadUserSettings(ctx, database.Pool)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateSettings saves the current user's settings. Omitted fields keep their current values.
+func UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	settings, err := loadUserSettings(ctx, database.Pool)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Decode over the current values so partial updates work
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePropagationSettings(settings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = database.Pool.QueryRow(ctx, `
+		INSERT INTO user_settings (user_id, propagation_mode, propagation_threshold, propagation_amount_tolerance)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET propagation_mode = EXCLUDED.propagation_mode,
+		    propagation_threshold = EXCLUDED.propagation_threshold,
+		    propagation_amount_tolerance = EXCLUDED.propagation_amount_tolerance,
+		    updated_at = NOW()
+		RETURNING updated_at
+	`, models.TEST_USER_ID, settings.PropagationMode, settings.PropagationThreshold,
+		settings.PropagationAmountTolerance).Scan(&settings.UpdatedAt)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(settings)
+}
@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+	"ookkee/pdf"
+)
+
+// taxReportCategory is one category's contribution to a tax report
+type taxReportCategory struct {
+	CategoryID   int64        `json:"category_id"`
+	CategoryName string       `json:"category_name"`
+	Amount       models.Money `json:"amount"`
+	ExpenseCount int          `json:"expense_count"`
+}
+
+// taxReportLine is one form line with the categories that roll up to it
+type taxReportLine struct {
+	TaxLineID    int64               `json:"tax_line_id"`
+	Line         string              `json:"line"`
+	Description  string              `json:"description"`
+	Amount       models.Money        `json:"amount"`
+	ExpenseCount int                 `json:"expense_count"`
+	Categories   []taxReportCategory `json:"categories"`
+}
+
+// taxReport aggregates a project's deductible expenses by the lines of one tax form.
+// Amounts are expenses, so positive; refunds reduce them.
+type taxReport struct {
+	ProjectID        int64               `json:"project_id"`
+	ProjectName      string              `json:"project_name"`
+	Form             string              `json:"form"`
+	Currency         string              `json:"currency"`
+	Lines            []taxReportLine     `json:"lines"`
+	Unmapped         []taxReportCategory `json:"unmapped"`
+	Total            models.Money        `json:"total"`
+	UnmappedTotal    models.Money        `json:"unmapped_total"`
+	UnconvertedCount int                 `json:"unconverted_count"`
+}
+
+// loadTaxLine reads a tax line visible to the user: built-in or their own
+func loadTaxLine(ctx context.Context, q dbQuerier, taxLineID int64) (models.TaxLine, error) {
+	var line models.TaxLine
+	err := q.QueryRow(ctx, `
+		SELECT id, form, line, description, sort_order, user_id IS NULL, created_at
+		FROM tax_line
+		WHERE id = $1 AND (user_id IS NULL OR user_id = $2)
+	`, taxLineID, models.TEST_USER_ID).Scan(&line.ID, &line.Form, &line.Line, &line.Description,
+		&line.SortOrder, &line.IsBuiltin, &line.CreatedAt)
+	return line, err
+}
+
+// loadTaxLines reads the lines of one form, or of every form when form is empty
+func loadTaxLines(ctx context.Context, q dbQuerier, form string) ([]models.TaxLine, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, form, line, description, sort_order, user_id IS NULL, created_at
+		FROM tax_line
+		WHERE (user_id IS NULL OR user_id = $1)
+		  AND ($2 = '' OR form = $2)
+		ORDER BY form ASC, sort_order ASC, id ASC
+	`, models.TEST_USER_ID, form)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.TaxLine{}
+	for rows.Next() {
+		var line models.TaxLine
+		err := rows.Scan(&line.ID, &line.Form, &line.Line, &line.Description, &line.SortOrder, &line.IsBuiltin, &line.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// GetTaxLines lists the tax lines available for mapping. Optional filter: form.
+func GetTaxLines(w http.ResponseWriter, r *http.Request) {
+	lines, err := loadTaxLines(r.Context(), database.Pool, r.URL.Query().Get("form"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch tax lines: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lines)
+}
+
+// CreateTaxLine adds a line to a user-defined form (or an extra line to a built-in one)
+func CreateTaxLine(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req struct {
+		Form        string `json:"form"`
+		Line        string `json:"line"`
+		Description string `json:"description"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Form = strings.TrimSpace(req.Form)
+	req.Line = strings.TrimSpace(req.Line)
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Form == "" || req.Line == "" || req.Description == "" {
+		http.Error(w, "Form, line and description are required", http.StatusBadRequest)
+		return
+	}
+
+	var line models.TaxLine
+	err := database.Pool.QueryRow(ctx, `
+		INSERT INTO tax_line (user_id, form, line, description, sort_order)
+		SELECT $1, $2, $3, $4, COALESCE(MAX(sort_order), 0) + 1
+		FROM tax_line
+		WHERE form = $2 AND (user_id IS NULL OR user_id = $1)
+		ON CONFLICT DO NOTHING
+		RETURNING id, form, line, description, sort_order, FALSE, created_at
+	`, models.TEST_USER_ID, req.Form, req.Line, req.Description).Scan(&line.ID, &line.Form, &line.Line,
+		&line.Description, &line.SortOrder, &line.IsBuiltin, &line.CreatedAt)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "That form already has this line", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create tax line: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(line)
+}
+
+// DeleteTaxLine removes one of the user's own tax lines; categories mapped to it become
+// unmapped. Built-in lines can't be deleted.
+func DeleteTaxLine(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	taxLineID := chi.URLParam(r, "taxLineID")
+	if taxLineID == "" {
+		http.Error(w, "Tax line ID is required", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := database.Pool.Exec(ctx, `
+		DELETE FROM tax_line WHERE id = $1 AND user_id = $2
+	`, taxLineID, models.TEST_USER_ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete tax line: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Tax line not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Tax line deleted successfully"}`))
+}
+
+// SetCategoryTaxLine maps a category to a tax line, or clears the mapping when tax_line_id
+// is null. Subcategories without their own mapping use their parent's.
+func SetCategoryTaxLine(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	categoryID := chi.URLParam(r, "categoryID")
+	if categoryID == "" {
+		http.Error(w, "Category ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		TaxLineID *int64 `json:"tax_line_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.TaxLineID != nil {
+		if _, err := loadTaxLine(ctx, database.Pool, *req.TaxLineID); err != nil {
+			if err == pgx.ErrNoRows {
+				http.Error(w, "Tax line not found", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to fetch tax line: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	tag, err := database.Pool.Exec(ctx, `
+		UPDATE expense_category
+		SET tax_line_id = $1, updated_at = NOW()
+		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
+	`, req.TaxLineID, categoryID, models.TEST_USER_ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update category: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Category tax line updated successfully"}`))
+}
+
+// buildTaxReport aggregates the project's accepted expenses by the lines of form. Only the
+// business-use portion counts, transfers are left out, and subcategories without a mapping
+// use their nearest mapped ancestor's line. Categories mapped to another form's lines are
+// left to that form's report; categories with no mapping at all are listed as unmapped.
+func buildTaxReport(ctx context.Context, projectID int64, form, currency string) (*taxReport, error) {
+	report := &taxReport{
+		ProjectID: projectID,
+		Form:      form,
+		Currency:  currency,
+		Lines:     []taxReportLine{},
+		Unmapped:  []taxReportCategory{},
+	}
+
+	err := database.Pool.QueryRow(ctx, `
+		SELECT name FROM project WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, projectID, models.TEST_USER_ID).Scan(&report.ProjectName)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := loadTaxLines(ctx, database.Pool, form)
+	if err != nil {
+		return nil, err
+	}
+	lineIndex := make(map[int64]int, len(lines))
+	for i, line := range lines {
+		lineIndex[line.ID] = i
+		report.Lines = append(report.Lines, taxReportLine{
+			TaxLineID:   line.ID,
+			Line:        line.Line,
+			Description: line.Description,
+			Categories:  []taxReportCategory{},
+		})
+	}
+
+	rows, err := database.Pool.Query(ctx, `
+		WITH RECURSIVE category_line AS (
+			SELECT id, tax_line_id
+			FROM expense_category
+			WHERE user_id = $1 AND parent_id IS NULL
+			UNION ALL
+			SELECT c.id, COALESCE(c.tax_line_id, cl.tax_line_id)
+			FROM expense_category c
+			JOIN category_line cl ON c.parent_id = cl.id
+		)
+		SELECT ec.id, ec.name, cl.tax_line_id,
+		       COALESCE(ROUND(SUM(-x.converted_amount * x.business_pct / 100), 2), 0) AS amount,
+		       COUNT(*) AS expense_count,
+		       COUNT(*) FILTER (WHERE x.amount IS NOT NULL AND x.converted_amount IS NULL) AS unconverted_count
+		FROM (
+			SELECT e.accepted_category_id, e.amount,
+			       COALESCE(e.business_pct, c.default_business_pct, 100) AS business_pct,
+			       convert_amount(p.user_id, e.amount, COALESCE(e.currency, p.currency), $3, e.expense_date) AS converted_amount
+			FROM expense e
+			JOIN project p ON e.project_id = p.id
+			JOIN expense_category c ON e.accepted_category_id = c.id
+			WHERE e.project_id = $2
+			  AND e.deleted_at IS NULL
+			  AND e.transfer_id IS NULL
+		) x
+		JOIN expense_category ec ON ec.id = x.accepted_category_id
+		LEFT JOIN category_line cl ON cl.id = ec.id
+		WHERE x.business_pct > 0
+		GROUP BY ec.id, ec.name, cl.tax_line_id
+		ORDER BY ec.name ASC
+	`, models.TEST_USER_ID, projectID, currency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var category taxReportCategory
+		var taxLineID *int64
+		var unconverted int
+		err := rows.Scan(&category.CategoryID, &category.CategoryName, &taxLineID, &category.Amount,
+			&category.ExpenseCount, &unconverted)
+		if err != nil {
+			return nil, err
+		}
+
+		if taxLineID == nil {
+			report.Unmapped = append(report.Unmapped, category)
+			report.UnmappedTotal += category.Amount
+			report.UnconvertedCount += unconverted
+			continue
+		}
+
+		i, ok := lineIndex[*taxLineID]
+		if !ok {
+			continue // mapped to another form
+		}
+		line := &report.Lines[i]
+		line.Categories = append(line.Categories, category)
+		line.Amount += category.Amount
+		line.ExpenseCount += category.ExpenseCount
+		report.Total += category.Amount
+		report.UnconvertedCount += unconverted
+	}
+
+	return report, rows.Err()
+}
+
+// taxReportFromRequest reads the project, form and currency parameters and builds the report,
+// writing an error response on failure
+func taxReportFromRequest(w http.ResponseWriter, r *http.Request) (*taxReport, bool) {
+	ctx := r.Context()
+	projectIDStr := chi.URLParam(r, "projectID")
+	projectID, err := strconv.ParseInt(projectIDStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	form := r.URL.Query().Get("form")
+	if form == "" {
+		form = models.TaxFormScheduleC
+	}
+
+	currency, err := reportCurrency(ctx, r, projectIDStr)
+	if err != nil {
+		writeReportCurrencyError(w, err)
+		return nil, false
+	}
+
+	report, err := buildTaxReport(ctx, projectID, form, currency)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build tax report: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	return report, true
+}
+
+// GetProjectTaxReport returns the project's totals per tax line. Query params: form
+// (default Schedule C) and currency.
+func GetProjectTaxReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := taxReportFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetProjectTaxReportCSV exports the tax report: one row per line, then unmapped categories
+func GetProjectTaxReportCSV(w http.ResponseWriter, r *http.Request) {
+	report, ok := taxReportFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=tax-report.csv")
+
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"Form", "Line", "Description", fmt.Sprintf("Amount (%s)", report.Currency), "Categories"}); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to write CSV header: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	records := make([][]string, 0, len(report.Lines)+len(report.Unmapped)+2)
+	for _, line := range report.Lines {
+		names := make([]string, len(line.Categories))
+		for i, category := range line.Categories {
+			names[i] = category.CategoryName
+		}
+		records = append(records, []string{report.Form, line.Line, line.Description, line.Amount.String(), strings.Join(names, "; ")})
+	}
+	records = append(records, []string{report.Form, "", "Total", report.Total.String(), ""})
+	for _, category := range report.Unmapped {
+		records = append(records, []string{"Unmapped", "", category.CategoryName, category.Amount.String(), ""})
+	}
+	if len(report.Unmapped) > 0 {
+		records = append(records, []string{"Unmapped", "", "Total", report.UnmappedTotal.String(), ""})
+	}
+
+	for _, record := range records {
+		if err := writer.Write(record); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write CSV row: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetProjectTaxReportPDF exports the tax report as a printable PDF for clients
+func GetProjectTaxReportPDF(w http.ResponseWriter, r *http.Request) {
+	report, ok := taxReportFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	doc := pdf.New(fmt.Sprintf("%s - %s", report.Form, report.ProjectName))
+	doc.BoldLine(fmt.Sprintf("%s: %s", report.Form, report.ProjectName))
+	doc.Line(fmt.Sprintf("Amounts in %s", report.Currency))
+	doc.Line("")
+
+	amountWidth := 14
+	descriptionWidth := pdf.LineWidth - 6 - amountWidth - 2
+	row := func(line, description string, amount models.Money) string {
+		if len([]rune(description)) > descriptionWidth {
+			description = string([]rune(description)[:descriptionWidth-3]) + "..."
+		}
+		return fmt.Sprintf("%-5s %-*s  %*s", line, descriptionWidth, description, amountWidth, amount)
+	}
+
+	doc.BoldLine(fmt.Sprintf("%-5s %-*s  %*s", "Line", descriptionWidth, "Description", amountWidth, "Amount"))
+	for _, line := range report.Lines {
+		doc.Line(row(line.Line, line.Description, line.Amount))
+	}
+	doc.BoldLine(row("", "Total", report.Total))
+
+	if len(report.Unmapped) > 0 {
+		doc.Line("")
+		doc.BoldLine("Unmapped categories (not included above)")
+		for _, category := range report.Unmapped {
+			doc.Line(row("", category.CategoryName, category.Amount))
+		}
+		doc.BoldLine(row("", "Unmapped total", report.UnmappedTotal))
+	}
+
+	if report.UnconvertedCount > 0 {
+		doc.Line("")
+		doc.Line(fmt.Sprintf("%d expenses have no exchange rate to %s and are not included.", report.UnconvertedCount, report.Currency))
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename=tax-report.pdf")
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc.Bytes())
+}
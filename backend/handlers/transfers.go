@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// defaultTransferWindowDays is how far apart the two legs of a transfer may post
+const defaultTransferWindowDays = 3
+
+// linkTransfer records a transfer between two expenses and points both rows at it
+func linkTransfer(ctx context.Context, tx pgx.Tx, projectID, outflowID, inflowID int64, status string) (models.ExpenseTransfer, error) {
+	var transfer models.ExpenseTransfer
+	err := tx.QueryRow(ctx, `
+		INSERT INTO expense_transfer (project_id, outflow_expense_id, inflow_expense_id, status)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (outflow_expense_id, inflow_expense_id) DO UPDATE
+		SET status = EXCLUDED.status, updated_at = NOW()
+		RETURNING id, project_id, outflow_expense_id, inflow_expense_id, status, created_at, updated_at
+	`, projectID, outflowID, inflowID, status).Scan(&transfer.ID, &transfer.ProjectID, &transfer.OutflowExpenseID,
+		&transfer.InflowExpenseID, &transfer.Status, &transfer.CreatedAt, &transfer.UpdatedAt)
+	if err != nil {
+		return transfer, fmt.Errorf("failed to create transfer: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE expense
+		SET transfer_id = $1, version = version + 1
+		WHERE id = ANY($2)
+	`, transfer.ID, []int64{outflowID, inflowID})
+	if err != nil {
+		return transfer, fmt.Errorf("failed to link expenses: %w", err)
+	}
+
+	err = recordHistory(ctx, tx, transferHistoryEntries(transfer, historyEventTransferLink)...)
+	return transfer, err
+}
+
+// transferHistoryEntries builds a link/unlink audit entry for both legs of a transfer
+func transferHistoryEntries(transfer models.ExpenseTransfer, eventType string) []historyEntry {
+	linked := eventType == historyEventTransferLink
+	var oldTransferID, newTransferID *int64
+	if linked {
+		newTransferID = &transfer.ID
+	} else {
+		oldTransferID = &transfer.ID
+	}
+
+	var entries []historyEntry
+	for _, expenseID := range []int64{transfer.OutflowExpenseID, transfer.InflowExpenseID} {
+		entries = append(entries, historyEntry{
+			ExpenseID: expenseID,
+			EventType: eventType,
+			OldValue:  map[string]interface{}{"transfer_id": oldTransferID},
+			NewValue:  map[string]interface{}{"transfer_id": newTransferID, "status": transfer.Status},
+		})
+	}
+	return entries
+}
+
+// lockProject locks a project owned by the current user for the rest of the transaction,
+// returning pgx.ErrNoRows when it doesn't exist
+func lockProject(ctx context.Context, tx pgx.Tx, projectID int64) error {
+	var lockedID int64
+	return tx.QueryRow(ctx, `
+		SELECT id
+		FROM project
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`, projectID, models.TEST_USER_ID).Scan(&lockedID)
+}
+
+// detectTransfers links opposite-sign expenses of equal size from different sources that
+// posted within windowDays of each other. Closest dates win; pairs the user rejected
+// before are never proposed again.
+func detectTransfers(ctx context.Context, tx pgx.Tx, projectID int64, windowDays int) ([]models.ExpenseTransfer, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT o.id, i.id
+		FROM expense o
+		JOIN expense i
+		  ON i.project_id = o.project_id
+		 AND i.amount = -o.amount
+		 AND i.source IS DISTINCT FROM o.source
+		 AND i.currency IS NOT DISTINCT FROM o.currency
+		WHERE o.project_id = $1
+		  AND o.amount < 0
+		  AND o.deleted_at IS NULL AND i.deleted_at IS NULL
+		  AND o.transfer_id IS NULL AND i.transfer_id IS NULL
+		  AND o.source IS NOT NULL AND i.source IS NOT NULL
+		  AND o.expense_date IS NOT NULL AND i.expense_date IS NOT NULL
+		  AND abs(o.expense_date - i.expense_date) <= $2
+		  AND NOT EXISTS (
+		      SELECT 1 FROM expense_transfer t
+		      WHERE t.outflow_expense_id = o.id
+		        AND t.inflow_expense_id = i.id
+		        AND t.status = 'rejected'
+		  )
+		ORDER BY abs(o.expense_date - i.expense_date) ASC, o.row_index ASC, i.row_index ASC
+	`, projectID, windowDays)
+	if err != nil {
+		return nil, err
+	}
+
+	type pair struct{ outflowID, inflowID int64 }
+	var candidates []pair
+	for rows.Next() {
+		var p pair
+		if err := rows.Scan(&p.outflowID, &p.inflowID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Greedy one-to-one matching in closest-date order
+	used := make(map[int64]bool)
+	transfers := []models.ExpenseTransfer{}
+	for _, p := range candidates {
+		if used[p.outflowID] || used[p.inflowID] {
+			continue
+		}
+		used[p.outflowID] = true
+		used[p.inflowID] = true
+
+		transfer, err := linkTransfer(ctx, tx, projectID, p.outflowID, p.inflowID, models.TransferDetected)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, nil
+}
+
+// GetTransfers lists a project's transfers with both legs. Pass status to filter.
+func GetTransfers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID := chi.URLParam(r, "projectID")
+	if projectID == "" {
+		http.Error(w, "Project ID is required", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT t.id, t.project_id, t.outflow_expense_id, t.inflow_expense_id, t.status, t.created_at, t.updated_at,
+		       o.row_index, o.source, o.date_text, o.description, o.amount,
+		       i.row_index, i.source, i.date_text, i.description, i.amount
+		FROM expense_transfer t
+		JOIN project p ON t.project_id = p.id
+		JOIN expense o ON t.outflow_expense_id = o.id
+		JOIN expense i ON t.inflow_expense_id = i.id
+		WHERE t.project_id = $1 AND p.user_id = $2
+		  AND ($3 = '' OR t.status = $3)
+		ORDER BY t.status ASC, o.row_index ASC
+	`, projectID, models.TEST_USER_ID, status)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch transfers: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	transfers := []models.ExpenseTransfer{}
+	for rows.Next() {
+		var transfer models.ExpenseTransfer
+		outflow, inflow := &models.Expense{}, &models.Expense{}
+		err := rows.Scan(&transfer.ID, &transfer.ProjectID, &transfer.OutflowExpenseID, &transfer.InflowExpenseID,
+			&transfer.Status, &transfer.CreatedAt, &transfer.UpdatedAt,
+			&outflow.RowIndex, &outflow.Source, &outflow.DateText, &outflow.Description, &outflow.Amount,
+			&inflow.RowIndex, &inflow.Source, &inflow.DateText, &inflow.Description, &inflow.Amount)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to scan transfer: %v", err), http.StatusInternalServerError)
+			return
+		}
+		outflow.ID, outflow.ProjectID = transfer.OutflowExpenseID, transfer.ProjectID
+		inflow.ID, inflow.ProjectID = transfer.InflowExpenseID, transfer.ProjectID
+		transfer.Outflow, transfer.Inflow = outflow, inflow
+		transfers = append(transfers, transfer)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
+
+// DetectTransfers runs transfer detection over a project. Optional window_days query param.
+func DetectTransfers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	windowDays := defaultTransferWindowDays
+	if windowStr := r.URL.Query().Get("window_days"); windowStr != "" {
+		if windowDays, err = strconv.Atoi(windowStr); err != nil || windowDays < 0 {
+			http.Error(w, "Invalid window_days", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockProject(ctx, tx, projectID); err == pgx.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	transfers, err := detectTransfers(ctx, tx, projectID, windowDays)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to detect transfers: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   fmt.Sprintf("Detected %d transfers", len(transfers)),
+		"transfers": transfers,
+	})
+}
+
+// CreateTransfer manually links two expenses in a project as a confirmed transfer
+func CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		OutflowExpenseID int64 `json:"outflow_expense_id"`
+		InflowExpenseID  int64 `json:"inflow_expense_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.OutflowExpenseID == 0 || req.InflowExpenseID == 0 || req.OutflowExpenseID == req.InflowExpenseID {
+		http.Error(w, "Two different expense IDs are required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockProject(ctx, tx, projectID); err == pgx.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Both legs must be active rows of this project that aren't already linked, and as in
+	// detection the outflow must be negative and the inflow positive
+	var eligible, signed int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE (id = $3 AND amount < 0) OR (id = $4 AND amount > 0))
+		FROM expense
+		WHERE id = ANY($1) AND project_id = $2 AND deleted_at IS NULL AND transfer_id IS NULL
+	`, []int64{req.OutflowExpenseID, req.InflowExpenseID}, projectID,
+		req.OutflowExpenseID, req.InflowExpenseID).Scan(&eligible, &signed)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if eligible != 2 {
+		http.Error(w, "Both expenses must belong to this project and not already be part of a transfer", http.StatusBadRequest)
+		return
+	}
+	if signed != 2 {
+		http.Error(w, "The outflow must have a negative amount and the inflow a positive amount", http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := linkTransfer(ctx, tx, projectID, req.OutflowExpenseID, req.InflowExpenseID, models.TransferConfirmed)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to link transfer: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// ConfirmTransfer marks a detected transfer as confirmed
+func ConfirmTransfer(w http.ResponseWriter, r *http.Request) {
+	setTransferStatus(w, r, models.TransferConfirmed)
+}
+
+// RejectTransfer marks a transfer as rejected and unlinks its expenses so they count again.
+// The rejected pair is remembered and not re-detected.
+func RejectTransfer(w http.ResponseWriter, r *http.Request) {
+	setTransferStatus(w, r, models.TransferRejected)
+}
+
+// setTransferStatus confirms or rejects a transfer owned by the current user
+func setTransferStatus(w http.ResponseWriter, r *http.Request, status string) {
+	ctx := r.Context()
+	transferID := chi.URLParam(r, "transferID")
+	if transferID == "" {
+		http.Error(w, "Transfer ID is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var transfer models.ExpenseTransfer
+	var previousStatus string
+	err = tx.QueryRow(ctx, `
+		UPDATE expense_transfer t
+		SET status = $1, updated_at = NOW()
+		FROM project p, expense_transfer previous
+		WHERE t.id = $2
+		  AND previous.id = t.id
+		  AND t.project_id = p.id
+		  AND p.user_id = $3
+		RETURNING t.id, t.project_id, t.outflow_expense_id, t.inflow_expense_id, t.status,
+		          t.created_at, t.updated_at, previous.status
+	`, status, transferID, models.TEST_USER_ID).Scan(&transfer.ID, &transfer.ProjectID, &transfer.OutflowExpenseID,
+		&transfer.InflowExpenseID, &transfer.Status, &transfer.CreatedAt, &transfer.UpdatedAt, &previousStatus)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Transfer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update transfer: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if status == models.TransferConfirmed && previousStatus == models.TransferRejected {
+		http.Error(w, "Rejected transfers must be linked again manually", http.StatusConflict)
+		return
+	}
+
+	if status == models.TransferRejected && previousStatus != models.TransferRejected {
+		_, err = tx.Exec(ctx, `
+			UPDATE expense
+			SET transfer_id = NULL, version = version + 1
+			WHERE transfer_id = $1
+		`, transfer.ID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to unlink expenses: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if err := recordHistory(ctx, tx, transferHistoryEntries(transfer, historyEventTransferUnlink)...); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to record history: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transfer)
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/models"
+)
+
+// Change set actions recorded in expense_change_set.action
+const (
+	changeActionUpdateExpense    = "update_expense"
+	changeActionBulkUpdate       = "bulk_update"
+	changeActionCategorizeSeries = "categorize_series"
+	changeActionApplyRules       = "apply_rules"
+)
+
+// expenseState is the reversible subset of an expense row. Tags are nil when the change
+// does not track them, and restoring such a state leaves the row's tags alone.
+type expenseState struct {
+	AcceptedCategoryID  *int64   `json:"accepted_category_id"`
+	SuggestedCategoryID *int64   `json:"suggested_category_id"`
+	IsPersonal          bool     `json:"is_personal"`
+	BusinessPct         *int     `json:"business_pct"`
+	Tags                []string `json:"tags,omitempty"`
+}
+
+// expenseChange captures one row's state before and after a mutation
+type expenseChange struct {
+	ExpenseID int64        `json:"expense_id"`
+	Old       expenseState `json:"old"`
+	New       expenseState `json:"new"`
+}
+
+// recordChangeSet stores a group of expense changes as a single undoable step.
+// Recording a new step discards anything that was undone, as in a text editor.
+func recordChangeSet(ctx context.Context, tx pgx.Tx, projectID int64, action string, changes []expenseChange) (int64, error) {
+	if len(changes) == 0 {
+		return 0, nil
+	}
+
+	// Clear the redo stack for this project
+	_, err := tx.Exec(ctx, `
+		DELETE FROM expense_change_set
+		WHERE project_id = $1 AND undone_at IS NOT NULL
+	`, projectID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear redo stack: %w", err)
+	}
+
+	var changeSetID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO expense_change_set (project_id, user_id, action)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, projectID, models.TEST_USER_ID, action).Scan(&changeSetID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create change set: %w", err)
+	}
+
+	for _, change := range changes {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO expense_change (change_set_id, expense_id,
+			                            old_accepted_category_id, new_accepted_category_id,
+			                            old_suggested_category_id, new_suggested_category_id,
+			                            old_is_personal, new_is_personal,
+			                            old_business_pct, new_business_pct,
+			                            old_tags, new_tags)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`, changeSetID, change.ExpenseID,
+			change.Old.AcceptedCategoryID, change.New.AcceptedCategoryID,
+			change.Old.SuggestedCategoryID, change.New.SuggestedCategoryID,
+			change.Old.IsPersonal, change.New.IsPersonal,
+			change.Old.BusinessPct, change.New.BusinessPct,
+			change.Old.Tags, change.New.Tags)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record change for expense %d: %w", change.ExpenseID, err)
+		}
+	}
+
+	return changeSetID, nil
+}
+
+// applyExpenseState writes a stored state back onto an expense row
+func applyExpenseState(ctx context.Context, tx pgx.Tx, expenseID int64, state expenseState) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE expense
+		SET accepted_category_id = $1::bigint,
+		    accepted_at = CASE
+		        WHEN $1::bigint IS NULL THEN NULL
+		        WHEN accepted_category_id IS NOT DISTINCT FROM $1::bigint THEN accepted_at
+		        ELSE CURRENT_TIMESTAMP
+		    END,
+		    suggested_category_id = $2::bigint,
+		    suggested_at = CASE
+		        WHEN $2::bigint IS NULL THEN NULL
+		        WHEN suggested_category_id IS NOT DISTINCT FROM $2::bigint THEN suggested_at
+		        ELSE CURRENT_TIMESTAMP
+		    END,
+		    is_personal = $3,
+		    business_pct = $4,
+		    tags = COALESCE($6::text[], tags),
+		    version = version + 1
+		WHERE id = $5
+	`, state.AcceptedCategoryID, state.SuggestedCategoryID, state.IsPersonal, state.BusinessPct, expenseID, state.Tags)
+	return err
+}
+
+// loadChangeSetChanges returns the rows recorded for a change set in the order they were
+// recorded, or newest first when undoing. A set can change the same expense more than once,
+// so undo must write the earliest old state last.
+func loadChangeSetChanges(ctx context.Context, tx pgx.Tx, changeSetID int64, newestFirst bool) ([]expenseChange, error) {
+	order := "ASC"
+	if newestFirst {
+		order = "DESC"
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT expense_id,
+		       old_accepted_category_id, new_accepted_category_id,
+		       old_suggested_category_id, new_suggested_category_id,
+		       old_is_personal, new_is_personal,
+		       old_business_pct, new_business_pct,
+		       old_tags, new_tags
+		FROM expense_change
+		WHERE change_set_id = $1
+		ORDER BY id `+order, changeSetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []expenseChange
+	for rows.Next() {
+		var change expenseChange
+		err := rows.Scan(&change.ExpenseID,
+			&change.Old.AcceptedCategoryID, &change.New.AcceptedCategoryID,
+			&change.Old.SuggestedCategoryID, &change.New.SuggestedCategoryID,
+			&change.Old.IsPersonal, &change.New.IsPersonal,
+			&change.Old.BusinessPct, &change.New.BusinessPct,
+			&change.Old.Tags, &change.New.Tags)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// UndoProjectChange reverts the most recent change set in a project
+func UndoProjectChange(w http.ResponseWriter, r *http.Request) {
+	replayChangeSet(w, r, true)
+}
+
+// RedoProjectChange re-applies the most recently undone change set in a project
+func RedoProjectChange(w http.ResponseWriter, r *http.Request) {
+	replayChangeSet(w, r, false)
+}
+
+// replayChangeSet pops the undo (or redo) stack and writes the old (or new) states back
+func replayChangeSet(w http.ResponseWriter, r *http.Request, undo bool) {
+	ctx := r.Context()
+	projectID := chi.URLParam(r, "projectID")
+	if projectID == "" {
+		http.Error(w, "Project ID is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Undo takes the newest active set; redo takes the most recently undone one
+	selectQuery := `
+		SELECT id, action
+		FROM expense_change_set
+		WHERE project_id = $1 AND user_id = $2 AND undone_at IS NULL
+		ORDER BY id DESC
+		LIMIT 1
+		FOR UPDATE
+	`
+	if !undo {
+		selectQuery = `
+			SELECT id, action
+			FROM expense_change_set
+			WHERE project_id = $1 AND user_id = $2 AND undone_at IS NOT NULL
+			ORDER BY undone_at DESC, id ASC
+			LIMIT 1
+			FOR UPDATE
+		`
+	}
+
+	var changeSetID int64
+	var action string
+	err = tx.QueryRow(ctx, selectQuery, projectID, models.TEST_USER_ID).Scan(&changeSetID, &action)
+	if err == pgx.ErrNoRows {
+		message := "Nothing to redo"
+		if undo {
+			message = "Nothing to undo"
+		}
+		http.Error(w, message, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get change set: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	changes, err := loadChangeSetChanges(ctx, tx, changeSetID, undo)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load changes: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	expenseIDs := make([]int64, 0, len(changes))
+	for _, change := range changes {
+		from, to, eventType := change.Old, change.New, historyEventRedo
+		if undo {
+			from, to, eventType = change.New, change.Old, historyEventUndo
+		}
+		if err := applyExpenseState(ctx, tx, change.ExpenseID, to); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to restore expense %d: %v", change.ExpenseID, err), http.StatusInternalServerError)
+			return
+		}
+
+		err := recordHistory(ctx, tx, historyEntry{
+			ExpenseID:   change.ExpenseID,
+			EventType:   eventType,
+			CategoryID:  to.AcceptedCategoryID,
+			OldValue:    from,
+			NewValue:    to,
+			ChangeSetID: &changeSetID,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to record history: %v", err), http.StatusInternalServerError)
+			return
+		}
+		expenseIDs = append(expenseIDs, change.ExpenseID)
+	}
+
+	markQuery := `UPDATE expense_change_set SET undone_at = NOW() WHERE id = $1`
+	if !undo {
+		markQuery = `UPDATE expense_change_set SET undone_at = NULL WHERE id = $1`
+	}
+	if _, err := tx.Exec(ctx, markQuery, changeSetID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update change set: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	message := fmt.Sprintf("Redid %d expense changes", len(changes))
+	if undo {
+		message = fmt.Sprintf("Undid %d expense changes", len(changes))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       message,
+		"change_set_id": changeSetID,
+		"action":        action,
+		"expense_ids":   expenseIDs,
+		"changes":       changes,
+	})
+}
@@ -6,12 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"ookkee/database"
 	"ookkee/models"
 )
@@ -66,8 +67,17 @@ func FileUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Get project currency from form data (optional)
+	currency := defaultCurrency
+	if currencyValue := r.FormValue("currency"); currencyValue != "" {
+		if currency, err = normalizeCurrency(currencyValue); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Process CSV and create project
-	project, err := processCSVAndCreateProject(ctx, filepath, projectName, header.Filename)
+	project, err := processCSVAndCreateProject(ctx, filepath, projectName, header.Filename, currency)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to process CSV: %v", err), http.StatusInternalServerError)
 		return
@@ -85,7 +95,7 @@ func FileUpload(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func processCSVAndCreateProject(ctx context.Context, filepath, projectName, originalName string) (*models.Project, error) {
+func processCSVAndCreateProject(ctx context.Context, filepath, projectName, originalName, currency string) (*models.Project, error) {
 	// Open and read CSV file
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -116,12 +126,12 @@ func processCSVAndCreateProject(ctx context.Context, filepath, projectName, orig
 	// Create project
 	var project models.Project
 	err = tx.QueryRow(ctx, `
-		INSERT INTO project (user_id, name, original_name, csv_path, row_count) 
-		VALUES ($1, $2, $3, $4, $5) 
-		RETURNING id, user_id, name, original_name, csv_path, row_count, created_at, updated_at
-	`, models.TEST_USER_ID, projectName, originalName, filepath, len(dataRows)).Scan(
+		INSERT INTO project (user_id, name, original_name, csv_path, row_count, currency) 
+		VALUES ($1, $2, $3, $4, $5, $6) 
+		RETURNING id, user_id, name, original_name, csv_path, row_count, currency, inherit_categories, created_at, updated_at
+	`, models.TEST_USER_ID, projectName, originalName, filepath, len(dataRows), currency).Scan(
 		&project.ID, &project.UserID, &project.Name, &project.OriginalName,
-		&project.CSVPath, &project.RowCount, &project.CreatedAt, &project.UpdatedAt)
+		&project.CSVPath, &project.RowCount, &project.Currency, &project.InheritCategories, &project.CreatedAt, &project.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create project: %w", err)
 	}
@@ -144,7 +154,8 @@ func processCSVAndCreateProject(ctx context.Context, filepath, projectName, orig
 		var source *string
 		var dateText *string
 		var description *string
-		var amount *float64
+		var amount *models.Money
+		var expenseCurrency *string
 
 		// Extract Source field
 		if sourceStr, ok := rawData["Source"].(string); ok && sourceStr != "" {
@@ -163,28 +174,78 @@ func processCSVAndCreateProject(ctx context.Context, filepath, projectName, orig
 
 		// Extract Amount field
 		if amtStr, ok := rawData["Amount"].(string); ok && amtStr != "" {
-			// Clean amount string: remove $, commas, and other common formatting
-			cleanAmount := strings.ReplaceAll(amtStr, "$", "")
-			cleanAmount = strings.ReplaceAll(cleanAmount, ",", "")
-			cleanAmount = strings.TrimSpace(cleanAmount)
-
-			if amt, err := strconv.ParseFloat(cleanAmount, 64); err == nil {
+			// ParseMoney strips $, commas and other common formatting
+			if amt, err := models.ParseMoney(amtStr); err == nil {
 				amount = &amt
 			}
 		}
 
+		// Extract Currency field; rows in the project's currency don't store their own
+		if currencyStr, ok := rawData["Currency"].(string); ok && currencyStr != "" {
+			if code, err := normalizeCurrency(currencyStr); err == nil && code != currency {
+				expenseCurrency = &code
+			}
+		}
+
 		_, err = tx.Exec(ctx, `
-			INSERT INTO expense (project_id, row_index, raw_data, source, date_text, description, amount) 
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
-		`, project.ID, i, rawDataJSON, source, dateText, description, amount)
+			INSERT INTO expense (project_id, row_index, raw_data, source, date_text, description, amount, currency) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, project.ID, i, rawDataJSON, source, dateText, description, amount, expenseCurrency)
 		if err != nil {
 			return nil, fmt.Errorf("failed to insert expense row %d: %w", i, err)
 		}
 	}
 
+	if err := runImportDetection(ctx, tx, "vendor assignment", func(tx pgx.Tx) (int, error) {
+		return assignVendors(ctx, tx, &project.ID)
+	}); err != nil {
+		return nil, err
+	}
+
+	// Link card payments and other inter-account transfers first so they aren't taken for
+	// refunds. Failures here shouldn't block the import.
+	if err := runImportDetection(ctx, tx, "transfer detection", func(tx pgx.Tx) (int, error) {
+		transfers, err := detectTransfers(ctx, tx, project.ID, defaultTransferWindowDays)
+		return len(transfers), err
+	}); err != nil {
+		return nil, err
+	}
+	if err := runImportDetection(ctx, tx, "refund matching", func(tx pgx.Tx) (int, error) {
+		matches, err := matchRefunds(ctx, tx, project.ID, defaultRefundWindowDays)
+		return len(matches), err
+	}); err != nil {
+		return nil, err
+	}
+
+	// Rules run last so they see vendors and skip the transfers and refunds just linked
+	if err := runImportDetection(ctx, tx, "categorization rules", func(tx pgx.Tx) (int, error) {
+		return applyCategorizationRules(ctx, tx, project.ID)
+	}); err != nil {
+		return nil, err
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	return &project, nil
 }
+
+// runImportDetection runs a post-import linking step in a savepoint. A failing step is
+// logged and rolled back without failing the import.
+func runImportDetection(ctx context.Context, tx pgx.Tx, name string, step func(pgx.Tx) (int, error)) error {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	linked, err := step(savepoint)
+	if err != nil {
+		log.Printf("Import %s failed: %v", name, err)
+		return savepoint.Rollback(ctx)
+	}
+	if linked > 0 {
+		log.Printf("Import %s linked %d rows", name, linked)
+	}
+	return savepoint.Commit(ctx)
+}
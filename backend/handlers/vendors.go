@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"ookkee/database"
+	"ookkee/merchant"
+	"ookkee/models"
+)
+
+// resolveVendor returns the vendor for a normalized merchant name, creating it on first sight
+func resolveVendor(ctx context.Context, tx pgx.Tx, name string) (int64, error) {
+	key := merchant.Key(name)
+
+	var vendorID int64
+	err := tx.QueryRow(ctx, `
+		SELECT vendor_id FROM vendor_alias WHERE user_id = $1 AND alias_key = $2
+	`, models.TEST_USER_ID, key).Scan(&vendorID)
+	if err != pgx.ErrNoRows {
+		return vendorID, err
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO vendor (user_id, name) VALUES ($1, $2) RETURNING id
+	`, models.TEST_USER_ID, name).Scan(&vendorID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create vendor: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO vendor_alias (user_id, alias_key, vendor_id) VALUES ($1, $2, $3)
+	`, models.TEST_USER_ID, key, vendorID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create vendor alias: %w", err)
+	}
+
+	return vendorID, nil
+}
+
+// assignVendors gives every active expense without a vendor its canonical vendor, in one
+// project or across all of the user's projects when projectID is nil. Rows that have no
+// category yet pick up the vendor's default category as a suggestion when it is in their
+// project's category list.
+func assignVendors(ctx context.Context, tx pgx.Tx, projectID *int64) (int, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT e.id, COALESCE(e.description, '')
+		FROM expense e
+		JOIN project p ON e.project_id = p.id
+		WHERE p.user_id = $1
+		  AND ($2::bigint IS NULL OR e.project_id = $2)
+		  AND e.vendor_id IS NULL
+		  AND e.deleted_at IS NULL
+	`, models.TEST_USER_ID, projectID)
+	if err != nil {
+		return 0, err
+	}
+
+	idsByName := make(map[string][]int64)
+	var names []string
+	for rows.Next() {
+		var id int64
+		var description string
+		if err := rows.Scan(&id, &description); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		name := merchant.Normalize(description)
+		if name == "" {
+			continue
+		}
+		if _, ok := idsByName[name]; !ok {
+			names = append(names, name)
+		}
+		idsByName[name] = append(idsByName[name], id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	assigned := 0
+	for _, name := range names {
+		vendorID, err := resolveVendor(ctx, tx, name)
+		if err != nil {
+			return 0, err
+		}
+
+		tag, err := tx.Exec(ctx, `
+			UPDATE expense e
+			SET vendor_id = v.id,
+			    suggested_category_id = CASE
+			        WHEN e.accepted_category_id IS NULL AND e.suggested_category_id IS NULL AND v.default_category_id IN (SELECT id FROM project_categories(e.project_id))
+			        THEN v.default_category_id ELSE e.suggested_category_id END,
+			    suggested_at = CASE
+			        WHEN e.accepted_category_id IS NULL AND e.suggested_category_id IS NULL AND v.default_category_id IN (SELECT id FROM project_categories(e.project_id))
+			        THEN CURRENT_TIMESTAMP ELSE e.suggested_at END,
+			    version = e.version + 1
+			FROM vendor v
+			WHERE v.id = $1 AND e.id = ANY($2)
+		`, vendorID, idsByName[name])
+		if err != nil {
+			return 0, fmt.Errorf("failed to assign vendor: %w", err)
+		}
+		assigned += int(tag.RowsAffected())
+	}
+
+	return assigned, nil
+}
+
+// BackfillVendors assigns vendors to expenses imported before vendors existed
+func BackfillVendors(ctx context.Context) (int, error) {
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	assigned, err := assignVendors(ctx, tx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return assigned, tx.Commit(ctx)
+}
+
+// loadVendor reads a vendor owned by the current user with its aliases and usage
+func loadVendor(ctx context.Context, q dbQuerier, vendorID int64) (models.Vendor, error) {
+	var vendor models.Vendor
+	err := q.QueryRow(ctx, `
+		SELECT v.id, v.name, v.default_category_id, v.created_at, v.updated_at,
+		       COALESCE((SELECT array_agg(a.alias_key ORDER BY a.alias_key) FROM vendor_alias a WHERE a.vendor_id = v.id), '{}'),
+		       (SELECT COUNT(*) FROM expense e WHERE e.vendor_id = v.id AND e.deleted_at IS NULL)
+		FROM vendor v
+		WHERE v.id = $1 AND v.user_id = $2
+	`, vendorID, models.TEST_USER_ID).Scan(&vendor.ID, &vendor.Name, &vendor.DefaultCategoryID,
+		&vendor.CreatedAt, &vendor.UpdatedAt, &vendor.Aliases, &vendor.ExpenseCount)
+	return vendor, err
+}
+
+// GetVendors lists the user's vendors with their aliases and expense counts
+func GetVendors(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT v.id, v.name, v.default_category_id, v.created_at, v.updated_at,
+		       COALESCE((SELECT array_agg(a.alias_key ORDER BY a.alias_key) FROM vendor_alias a WHERE a.vendor_id = v.id), '{}'),
+		       (SELECT COUNT(*) FROM expense e WHERE e.vendor_id = v.id AND e.deleted_at IS NULL)
+		FROM vendor v
+		WHERE v.user_id = $1
+		ORDER BY lower(v.name) ASC
+	`, models.TEST_USER_ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch vendors: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	vendors := []models.Vendor{}
+	for rows.Next() {
+		var vendor models.Vendor
+		err := rows.Scan(&vendor.ID, &vendor.Name, &vendor.DefaultCategoryID, &vendor.CreatedAt,
+			&vendor.UpdatedAt, &vendor.Aliases, &vendor.ExpenseCount)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to scan vendor: %v", err), http.StatusInternalServerError)
+			return
+		}
+		vendors = append(vendors, vendor)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vendors)
+}
+
+// UpdateVendor renames a vendor and/or sets its default category (-1 clears it)
+func UpdateVendor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vendorID, err := strconv.ParseInt(chi.URLParam(r, "vendorID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid vendor ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name              *string `json:"name"`
+		DefaultCategoryID *int64  `json:"default_category_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	updateFields := []string{}
+	args := []interface{}{}
+	argIndex := 1
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			http.Error(w, "Vendor name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		updateFields = append(updateFields, fmt.Sprintf("name = $%d", argIndex))
+		args = append(args, name)
+		argIndex++
+	}
+
+	if req.DefaultCategoryID != nil {
+		if *req.DefaultCategoryID == -1 {
+			updateFields = append(updateFields, "default_category_id = NULL")
+		} else {
+			updateFields = append(updateFields, fmt.Sprintf("default_category_id = $%d", argIndex))
+			args = append(args, *req.DefaultCategoryID)
+			argIndex++
+		}
+	}
+
+	if len(updateFields) == 0 {
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
+
+	updateFields = append(updateFields, "updated_at = NOW()")
+	args = append(args, vendorID, models.TEST_USER_ID)
+
+	tag, err := database.Pool.Exec(ctx, fmt.Sprintf(`
+		UPDATE vendor
+		SET %s
+		WHERE id = $%d AND user_id = $%d
+	`, strings.Join(updateFields, ", "), argIndex, argIndex+1), args...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update vendor: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "Vendor not found", http.StatusNotFound)
+		return
+	}
+
+	vendor, err := loadVendor(ctx, database.Pool, vendorID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch vendor: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(vendor)
+}
+
+// MergeVendors folds other vendors into this one: their expenses, aliases and the rules that
+// match them move over, a missing default category is taken from the first source that has
+// one, and the sources are deleted
+func MergeVendors(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vendorID, err := strconv.ParseInt(chi.URLParam(r, "vendorID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid vendor ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		SourceVendorIDs []int64 `json:"source_vendor_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.SourceVendorIDs) == 0 {
+		http.Error(w, "source_vendor_ids is required", http.StatusBadRequest)
+		return
+	}
+	// A source listed twice is merged once
+	seen := make(map[int64]bool, len(req.SourceVendorIDs))
+	sourceIDs := req.SourceVendorIDs[:0]
+	for _, sourceID := range req.SourceVendorIDs {
+		if sourceID == vendorID {
+			http.Error(w, "Cannot merge a vendor into itself", http.StatusBadRequest)
+			return
+		}
+		if !seen[sourceID] {
+			seen[sourceID] = true
+			sourceIDs = append(sourceIDs, sourceID)
+		}
+	}
+	req.SourceVendorIDs = sourceIDs
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to begin transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Every vendor involved must belong to the user
+	var owned int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM vendor WHERE id = ANY($1) AND user_id = $2
+	`, append([]int64{vendorID}, req.SourceVendorIDs...), models.TEST_USER_ID).Scan(&owned)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check vendors: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if owned != len(req.SourceVendorIDs)+1 {
+		http.Error(w, "Vendor not found", http.StatusNotFound)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE vendor t
+		SET default_category_id = (
+		        SELECT s.default_category_id FROM vendor s
+		        WHERE s.id = ANY($2) AND s.default_category_id IS NOT NULL
+		        ORDER BY array_position($2, s.id) LIMIT 1),
+		    updated_at = NOW()
+		WHERE t.id = $1 AND t.default_category_id IS NULL
+	`, vendorID, req.SourceVendorIDs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to merge default category: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	mergeSteps := []struct{ what, sql string }{
+		{"expenses", `UPDATE expense SET vendor_id = $1, version = version + 1 WHERE vendor_id = ANY($2)`},
+		{"aliases", `UPDATE vendor_alias SET vendor_id = $1 WHERE vendor_id = ANY($2)`},
+		{"rules", `UPDATE categorization_rule
+			SET conditions = jsonb_set(conditions, '{vendor_id}', to_jsonb($1::bigint)), updated_at = NOW()
+			WHERE (conditions->>'vendor_id')::bigint = ANY($2)`},
+		{"vendors", `DELETE FROM vendor WHERE id = ANY($2) AND id <> $1`},
+	}
+	for _, step := range mergeSteps {
+		if _, err := tx.Exec(ctx, step.sql, vendorID, req.SourceVendorIDs); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to merge %s: %v", step.what, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	vendor, err := loadVendor(ctx, tx, vendorID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch vendor: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to commit transaction: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(vendor)
+}
+
+// GetProjectVendorTotals reports spending per vendor for a project (excluding personal
+// expenses and transfers), largest first. Amounts are converted to the report currency;
+// rows with no usable exchange rate are left out and counted.
+func GetProjectVendorTotals(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID, err := strconv.ParseInt(chi.URLParam(r, "projectID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = database.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM project WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, projectID, models.TEST_USER_ID).Scan(&exists)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get project: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	currency, err := reportCurrency(ctx, r, strconv.FormatInt(projectID, 10))
+	if err != nil {
+		writeReportCurrencyError(w, err)
+		return
+	}
+
+	rows, err := database.Pool.Query(ctx, `
+		SELECT v.id, v.name, COALESCE(SUM(x.converted_amount), 0) AS total_amount, COUNT(*) AS expense_count,
+		       COUNT(*) FILTER (WHERE x.amount IS NOT NULL AND x.converted_amount IS NULL) AS unconverted_count
+		FROM (
+			SELECT e.vendor_id, e.amount,
+			       convert_amount(p.user_id, e.amount, COALESCE(e.currency, p.currency), $2, e.expense_date) AS converted_amount
+			FROM expense e
+			JOIN project p ON e.project_id = p.id
+			WHERE e.project_id = $1
+			  AND e.deleted_at IS NULL
+			  AND (e.is_personal IS NULL OR e.is_personal = FALSE)
+			  AND e.transfer_id IS NULL
+		) x
+		JOIN vendor v ON x.vendor_id = v.id
+		GROUP BY v.id, v.name
+		ORDER BY total_amount ASC
+	`, projectID, currency)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch vendor totals: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type VendorTotal struct {
+		VendorID         int64        `json:"vendor_id"`
+		VendorName       string       `json:"vendor_name"`
+		TotalAmount      models.Money `json:"total_amount"`
+		Currency         string       `json:"currency"`
+		ExpenseCount     int          `json:"expense_count"`
+		UnconvertedCount int          `json:"unconverted_count"`
+	}
+
+	totals := []VendorTotal{}
+	for rows.Next() {
+		total := VendorTotal{Currency: currency}
+		err := rows.Scan(&total.VendorID, &total.VendorName, &total.TotalAmount, &total.ExpenseCount, &total.UnconvertedCount)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to scan vendor total: %v", err), http.StatusInternalServerError)
+			return
+		}
+		totals = append(totals, total)
+	}
+
+	if err = rows.Err(); err != nil {
+		http.Error(w, fmt.Sprintf("Row iteration error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(totals)
+}
@@ -156,7 +156,7 @@ func (p *JobProcessor) runAICategorizationJob(ctx context.Context, job *AICatego
 	}
 
 	// Step 2: Get available categories from database
-	categoryDetails, err := ai.GetAllCategories(ctx)
+	categoryDetails, err := ai.GetProjectCategories(ctx, job.ProjectID)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -59,6 +60,13 @@ func main() {
 	handlers.SetJobManager(jobManager)
 	handlers.SetJobProcessor(jobProcessor)
 
+	// Give expenses imported before vendors existed their canonical vendor
+	if assigned, err := handlers.BackfillVendors(context.Background()); err != nil {
+		log.Printf("Vendor backfill failed: %v", err)
+	} else if assigned > 0 {
+		log.Printf("Assigned vendors to %d expenses", assigned)
+	}
+
 	// Setup router
 	r := chi.NewRouter()
 
@@ -68,8 +76,8 @@ func main() {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   strings.Split(CORSOrigins, ","),
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
@@ -85,25 +93,109 @@ func main() {
 		// Projects
 		r.Get("/projects", handlers.GetProjects)
 		r.Get("/projects/{projectID}/expenses", handlers.GetExpenses)
+		r.Post("/projects/{projectID}/expenses", handlers.CreateExpense)
+		r.Put("/projects/{projectID}/expenses/bulk", handlers.BulkUpdateExpenses)
+		r.Get("/projects/{projectID}/expenses/deleted", handlers.GetDeletedExpenses)
+		r.Get("/projects/{projectID}/expenses/csv", handlers.GetExpensesCSV)
 		r.Get("/projects/{projectID}/totals", handlers.GetProjectTotals)
 		r.Get("/projects/{projectID}/totals/csv", handlers.GetProjectTotalsCSV)
+		r.Get("/projects/{projectID}/totals/vendors", handlers.GetProjectVendorTotals)
 		r.Get("/projects/{projectID}/progress", handlers.GetProjectProgress)
+		r.Get("/projects/{projectID}/anomalies", handlers.GetProjectAnomalies)
+		r.Get("/projects/{projectID}/tax-report", handlers.GetProjectTaxReport)
+		r.Get("/projects/{projectID}/tax-report/csv", handlers.GetProjectTaxReportCSV)
+		r.Get("/projects/{projectID}/tax-report/pdf", handlers.GetProjectTaxReportPDF)
+		r.Get("/projects/{projectID}/budgets/report", handlers.GetProjectBudgetReport)
 		r.Put("/projects/{projectID}", handlers.UpdateProject)
 		r.Delete("/projects/{projectID}", handlers.DeleteProject)
 		r.Post("/projects/{projectID}/ai-categorize", handlers.AICategorizeExpenses)
+		r.Post("/projects/{projectID}/undo", handlers.UndoProjectChange)
+		r.Post("/projects/{projectID}/redo", handlers.RedoProjectChange)
+		r.Get("/projects/{projectID}/activity", handlers.GetProjectActivity)
+		r.Get("/projects/{projectID}/transfers", handlers.GetTransfers)
+		r.Post("/projects/{projectID}/transfers", handlers.CreateTransfer)
+		r.Post("/projects/{projectID}/transfers/detect", handlers.DetectTransfers)
+		r.Post("/projects/{projectID}/refunds/match", handlers.MatchRefunds)
+		r.Get("/projects/{projectID}/refunds/unmatched", handlers.GetUnmatchedCredits)
+		r.Get("/projects/{projectID}/recurring", handlers.GetProjectRecurring)
 
 		// Job endpoints
 		r.Get("/jobs/{jobID}", handlers.GetJobStatus)
 
 		// Expenses
 		r.Put("/expenses/{expenseID}", handlers.UpdateExpense)
+		r.Delete("/expenses/{expenseID}", handlers.DeleteExpense)
+		r.Post("/expenses/{expenseID}/restore", handlers.RestoreExpense)
+		r.Get("/expenses/{expenseID}/history", handlers.GetExpenseHistory)
+		r.Get("/expenses/{expenseID}/propagation-preview", handlers.GetPropagationPreview)
+		r.Put("/expenses/{expenseID}/refund", handlers.LinkRefund)
+		r.Delete("/expenses/{expenseID}/refund", handlers.UnlinkRefund)
+
+		// Recurring charges across all projects
+		r.Get("/recurring", handlers.GetRecurring)
+		r.Post("/recurring/categorize", handlers.CategorizeRecurringSeries)
+
+		// Exchange rates
+		r.Get("/exchange-rates", handlers.GetExchangeRates)
+		r.Post("/exchange-rates", handlers.CreateExchangeRate)
+		r.Post("/exchange-rates/import", handlers.ImportExchangeRates)
+		r.Delete("/exchange-rates/{rateID}", handlers.DeleteExchangeRate)
+
+		// Vendors
+		r.Get("/vendors", handlers.GetVendors)
+		r.Put("/vendors/{vendorID}", handlers.UpdateVendor)
+		r.Post("/vendors/{vendorID}/merge", handlers.MergeVendors)
+
+		// Transfers
+		r.Post("/transfers/{transferID}/confirm", handlers.ConfirmTransfer)
+		r.Post("/transfers/{transferID}/reject", handlers.RejectTransfer)
+
+		// Settings
+		r.Get("/settings", handlers.GetSettings)
+		r.Put("/settings", handlers.UpdateSettings)
 
 		// Categories
 		r.Get("/categories", handlers.GetCategories)
 		r.Post("/categories", handlers.CreateCategory)
+		r.Put("/categories/order", handlers.ReorderCategories)
+		r.Get("/categories/export", handlers.ExportCategories)
+		r.Post("/categories/import", handlers.ImportCategories)
+		r.Get("/categories/archived", handlers.GetArchivedCategories)
+		r.Delete("/categories/archived", handlers.PurgeArchivedCategories)
+		r.Delete("/categories/archived/{categoryID}", handlers.PurgeArchivedCategory)
 		r.Put("/categories/{categoryID}", handlers.UpdateCategory)
 		r.Delete("/categories/{categoryID}", handlers.DeleteCategory)
 		r.Put("/categories/{categoryID}/move", handlers.MoveCategory)
+		r.Put("/categories/{categoryID}/parent", handlers.SetCategoryParent)
+		r.Post("/categories/{categoryID}/merge", handlers.MergeCategories)
+		r.Post("/categories/{categoryID}/restore", handlers.RestoreCategory)
+		r.Put("/categories/{categoryID}/tax-line", handlers.SetCategoryTaxLine)
+
+		// Built-in category sets
+		r.Get("/category-templates", handlers.GetCategoryTemplates)
+		r.Get("/category-templates/{templateKey}", handlers.GetCategoryTemplate)
+		r.Post("/category-templates/{templateKey}/apply", handlers.ApplyCategoryTemplate)
+
+		// Budgets
+		r.Get("/budgets", handlers.GetBudgets)
+		r.Post("/budgets", handlers.CreateBudget)
+		r.Get("/budgets/report", handlers.GetBudgetReport)
+		r.Put("/budgets/{budgetID}", handlers.UpdateBudget)
+		r.Delete("/budgets/{budgetID}", handlers.DeleteBudget)
+
+		// Categorization rules
+		r.Get("/rules", handlers.GetRules)
+		r.Post("/rules", handlers.CreateRule)
+		r.Get("/rules/suggestions", handlers.GetRuleSuggestions)
+		r.Post("/rules/suggestions/accept", handlers.AcceptRuleSuggestion)
+		r.Post("/rules/dry-run", handlers.DryRunRules)
+		r.Put("/rules/{ruleID}", handlers.UpdateRule)
+		r.Delete("/rules/{ruleID}", handlers.DeleteRule)
+
+		// Tax form lines
+		r.Get("/tax-lines", handlers.GetTaxLines)
+		r.Post("/tax-lines", handlers.CreateTaxLine)
+		r.Delete("/tax-lines/{taxLineID}", handlers.DeleteTaxLine)
 	})
 
 	// Ensure uploads directory exists
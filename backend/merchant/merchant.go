@@ -0,0 +1,107 @@
+// Package merchant turns raw bank and card statement descriptions into canonical
+// vendor names, e.g. "SQ *BLUE BOTTLE 0423 SAN FRANCISCO CA" → "Blue Bottle".
+package merchant
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	// bankMarkerPattern matches leading words banks add before the merchant
+	// ("POS DEBIT", "PURCHASE AUTHORIZED ON 04/23", "CHECKCARD 0423")
+	bankMarkerPattern = regexp.MustCompile(`^(?:POS|DEBIT|CREDIT|CHECKCARD|PURCHASE|RECURRING|AUTHORIZED|ON|PAYMENT|PMT|VISA|MC|ACH|\d{1,2}/\d{1,2}(?:/\d{2,4})?|\d{4})\s+`)
+
+	// processorPrefixPattern matches payment processors that front the real merchant
+	// (Square, Toast, Shopify, PayPal, ...); everything up to the '*' is dropped
+	processorPrefixPattern = regexp.MustCompile(`^(?:SQ|SQU|SQSP|TST|SP|PP|PAYPAL|IN|PY|BT|WPY|ZLR|CKE|FS|PAR)\s*\*\s*`)
+
+	// cardSuffixPattern matches masked card numbers ("XXXX1234", "CARD 1234")
+	cardSuffixPattern = regexp.MustCompile(`(?:X{2,}|\*{2,})\s*\d+|\bCARD\s*\d{4}\b`)
+
+	// domainPattern matches web prefixes and suffixes on online merchants
+	domainPattern = regexp.MustCompile(`^WWW\.|\.(?:COM|NET|ORG|IO|CO|AI|APP)\b`)
+
+	// separatorPattern matches anything that isn't part of a merchant word
+	separatorPattern = regexp.MustCompile(`[^A-Z0-9&']+`)
+)
+
+// usStates are the trailing location codes card networks append after the city
+var usStates = map[string]bool{
+	"AL": true, "AK": true, "AZ": true, "AR": true, "CA": true, "CO": true, "CT": true, "DE": true,
+	"DC": true, "FL": true, "GA": true, "HI": true, "ID": true, "IL": true, "IN": true, "IA": true,
+	"KS": true, "KY": true, "LA": true, "ME": true, "MD": true, "MA": true, "MI": true, "MN": true,
+	"MS": true, "MO": true, "MT": true, "NE": true, "NV": true, "NH": true, "NJ": true, "NM": true,
+	"NY": true, "NC": true, "ND": true, "OH": true, "OK": true, "OR": true, "PA": true, "RI": true,
+	"SC": true, "SD": true, "TN": true, "TX": true, "UT": true, "VT": true, "VA": true, "WA": true,
+	"WV": true, "WI": true, "WY": true, "PR": true, "US": true, "USA": true,
+}
+
+// Normalize returns the canonical vendor name for a statement description, or "" when
+// nothing recognizable is left.
+func Normalize(description string) string {
+	s := strings.ToUpper(strings.TrimSpace(description))
+
+	// 1. Leading bank markers, repeatedly ("POS DEBIT 0423 ...")
+	for {
+		stripped := bankMarkerPattern.ReplaceAllString(s, "")
+		if stripped == s {
+			break
+		}
+		s = stripped
+	}
+
+	// 2. Processor prefixes ("SQ *", "TST* ", "PAYPAL *")
+	s = processorPrefixPattern.ReplaceAllString(s, "")
+
+	// 3. Remaining '*' separates a merchant from its reference ("AMZN MKTP US*2K4XY")
+	if before, after, found := strings.Cut(s, "*"); found {
+		if strings.TrimSpace(before) != "" {
+			s = before
+		} else {
+			s = after
+		}
+	}
+
+	// 4. Card suffixes and domains
+	s = cardSuffixPattern.ReplaceAllString(s, " ")
+	s = domainPattern.ReplaceAllString(s, " ")
+
+	tokens := strings.Fields(separatorPattern.ReplaceAllString(s, " "))
+
+	// 5. Everything from the first store or phone number on is location detail
+	for i, token := range tokens {
+		if i > 0 && strings.IndexFunc(token, unicode.IsDigit) >= 0 {
+			tokens = tokens[:i]
+			break
+		}
+	}
+
+	// 6. Trailing state or country codes
+	for len(tokens) > 1 && usStates[tokens[len(tokens)-1]] {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	return titleCase(tokens)
+}
+
+// Key returns the comparison key for a vendor name; names differing only by case share a key
+func Key(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// titleCase joins upper-case tokens as "Blue Bottle". Acronyms come out as "Ibm"; vendors
+// can be renamed when that reads wrong.
+func titleCase(tokens []string) string {
+	words := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		runes := []rune(strings.ToLower(token))
+		if len(runes) == 0 {
+			continue
+		}
+		runes[0] = unicode.ToUpper(runes[0])
+		words = append(words, string(runes))
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,34 @@
+package merchant
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		description string
+		want        string
+	}{
+		{"SQ *BLUE BOTTLE 0423 SAN FRANCISCO CA", "Blue Bottle"},
+		{"TST* SWEETGREEN 123 NEW YORK NY", "Sweetgreen"},
+		{"PAYPAL *SPOTIFY 4029357733", "Spotify"},
+		{"AMZN Mktp US*2K4XY1Z30", "Amzn Mktp"},
+		{"NETFLIX.COM 866-579-7172 CA", "Netflix"},
+		{"POS DEBIT 0423 STARBUCKS #1234 SEATTLE WA", "Starbucks"},
+		{"PURCHASE AUTHORIZED ON 04/23 SHELL OIL 57442", "Shell Oil"},
+		{"GITHUB, INC. XXXX1234", "Github Inc"},
+		{"7-ELEVEN 33021", "7 Eleven"},
+		{"Uber *Trip", "Uber"},
+		{"  ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.description); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.description, got, tt.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	if Key("Blue  Bottle") != Key("BLUE BOTTLE") {
+		t.Errorf("Key should ignore case and spacing")
+	}
+}
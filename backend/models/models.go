@@ -9,14 +9,16 @@ import (
 const TEST_USER_ID = "00000000-0000-0000-0000-000000000001"
 
 type Project struct {
-	ID           int64     `json:"id"`
-	UserID       string    `json:"user_id"`
-	Name         string    `json:"name"`
-	OriginalName string    `json:"original_name"`
-	CSVPath      string    `json:"csv_path"`
-	RowCount     int       `json:"row_count"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID                int64     `json:"id"`
+	UserID            string    `json:"user_id"`
+	Name              string    `json:"name"`
+	OriginalName      string    `json:"original_name"`
+	CSVPath           string    `json:"csv_path"`
+	RowCount          int       `json:"row_count"`
+	Currency          string    `json:"currency"`
+	InheritCategories bool      `json:"inherit_categories"` // the user's defaults join the project's own categories
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
 }
 
 type Expense struct {
@@ -27,30 +29,240 @@ type Expense struct {
 	Source              *string         `json:"source"`
 	DateText            *string         `json:"date_text"`
 	Description         *string         `json:"description"`
-	Amount              *float64        `json:"amount"`
+	Amount              *Money          `json:"amount"`
 	SuggestedCategoryID *int64          `json:"suggested_category_id"`
 	AcceptedCategoryID  *int64          `json:"accepted_category_id"`
 	IsPersonal          bool            `json:"is_personal"`
+	BusinessPct         *int            `json:"business_pct"`
+	IsManual            bool            `json:"is_manual"`
+	TransferID          *int64          `json:"transfer_id"`
+	RefundOfExpenseID   *int64          `json:"refund_of_expense_id"`
+	VendorID            *int64          `json:"vendor_id"`
+	Currency            *string         `json:"currency"`
+	Tags                []string        `json:"tags"`
+	Version             int             `json:"version"`
+	DeletedAt           *time.Time      `json:"deleted_at,omitempty"`
 }
 
 type Category struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	Hotkey    *string   `json:"hotkey"`
-	SortOrder int       `json:"sort_order"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                 int64     `json:"id"`
+	Name               string    `json:"name"`
+	Description        *string   `json:"description"`
+	IncludeGuidance    *string   `json:"include_guidance"` // what belongs in the category
+	ExcludeGuidance    *string   `json:"exclude_guidance"` // what does not, and where it goes instead
+	Examples           []string  `json:"examples"`         // expense descriptions that belong here
+	Hotkey             *string   `json:"hotkey"`
+	ProjectID          *int64    `json:"project_id"` // nil for the user's defaults
+	ParentID           *int64    `json:"parent_id"`
+	Depth              int       `json:"depth"`
+	SortOrder          int       `json:"sort_order"` // position among siblings
+	DefaultBusinessPct *int      `json:"default_business_pct"`
+	TaxLineID          *int64    `json:"tax_line_id"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// CategorySetEntry is one category in a category set. Parent is the path of the parent
+// category ("Travel" or "Travel > Lodging"), which must be listed before its children; list
+// order is the display order among siblings.
+type CategorySetEntry struct {
+	Name               string   `json:"name"`
+	Parent             string   `json:"parent,omitempty"`
+	Hotkey             *string  `json:"hotkey,omitempty"`
+	Description        *string  `json:"description,omitempty"`
+	IncludeGuidance    *string  `json:"include_guidance,omitempty"`
+	ExcludeGuidance    *string  `json:"exclude_guidance,omitempty"`
+	Examples           []string `json:"examples,omitempty"`
+	TaxForm            *string  `json:"tax_form,omitempty"`
+	TaxLine            *string  `json:"tax_line,omitempty"`
+	DefaultBusinessPct *int     `json:"default_business_pct,omitempty"`
+}
+
+// CategorySet is a portable chart of categories: an export of the user's categories or
+// one of the built-in templates
+type CategorySet struct {
+	Key         string             `json:"key,omitempty"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Categories  []CategorySetEntry `json:"categories"`
+}
+
+// TaxFormScheduleC is the built-in form, IRS Schedule C (Form 1040)
+const TaxFormScheduleC = "Schedule C"
+
+// TaxLine is one line of a tax form that categories are mapped to. Built-in lines
+// (Schedule C) are shared; users can add lines for other forms.
+type TaxLine struct {
+	ID          int64     `json:"id"`
+	Form        string    `json:"form"`
+	Line        string    `json:"line"`
+	Description string    `json:"description"`
+	SortOrder   int       `json:"sort_order"`
+	IsBuiltin   bool      `json:"is_builtin"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Transfer statuses for ExpenseTransfer.Status
+const (
+	TransferDetected  = "detected"
+	TransferConfirmed = "confirmed"
+	TransferRejected  = "rejected"
+)
+
+// ExpenseTransfer links an outflow in one source to the matching inflow in another
+// (e.g. a checking account payment and the credit card's payment credit)
+type ExpenseTransfer struct {
+	ID               int64     `json:"id"`
+	ProjectID        int64     `json:"project_id"`
+	OutflowExpenseID int64     `json:"outflow_expense_id"`
+	InflowExpenseID  int64     `json:"inflow_expense_id"`
+	Status           string    `json:"status"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	Outflow          *Expense  `json:"outflow,omitempty"`
+	Inflow           *Expense  `json:"inflow,omitempty"`
+}
+
+// ExchangeRate says 1 unit of BaseCurrency was worth Rate units of QuoteCurrency on RateDate
+type ExchangeRate struct {
+	ID            int64     `json:"id"`
+	RateDate      time.Time `json:"rate_date"`
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Rate          Rate      `json:"rate"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Vendor is a canonical merchant that expenses are grouped under. Aliases are the
+// normalized merchant keys that resolve to it.
+type Vendor struct {
+	ID                int64     `json:"id"`
+	Name              string    `json:"name"`
+	DefaultCategoryID *int64    `json:"default_category_id"`
+	Aliases           []string  `json:"aliases"`
+	ExpenseCount      int       `json:"expense_count"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Cadences for RecurringSeries.Cadence
+const (
+	CadenceWeekly  = "weekly"
+	CadenceMonthly = "monthly"
+	CadenceAnnual  = "annual"
+)
+
+// RecurringSeries is a run of charges from one merchant at a regular cadence and a
+// steady amount, e.g. a SaaS subscription. Amounts are costs, so positive.
+type RecurringSeries struct {
+	Key                string    `json:"key"`
+	Merchant           string    `json:"merchant"`
+	Description        string    `json:"description"`
+	Cadence            string    `json:"cadence"`
+	Occurrences        int       `json:"occurrences"`
+	Currency           string    `json:"currency"`
+	AverageAmount      Money     `json:"average_amount"`
+	AnnualizedCost     Money     `json:"annualized_cost"`
+	FirstDate          time.Time `json:"first_date"`
+	LastDate           time.Time `json:"last_date"`
+	NextExpectedDate   time.Time `json:"next_expected_date"`
+	AcceptedCategoryID *int64    `json:"accepted_category_id"`
+	ProjectIDs         []int64   `json:"project_ids"`
+	ExpenseIDs         []int64   `json:"expense_ids"`
+}
+
+// Periods for CategoryBudget.Period
+const (
+	BudgetMonthly = "monthly"
+	BudgetAnnual  = "annual"
+)
+
+// CategoryBudget caps spending in a category and its subcategories per calendar month or
+// year, within one project or, with no project, across all of the user's projects
+type CategoryBudget struct {
+	ID           int64     `json:"id"`
+	CategoryID   int64     `json:"category_id"`
+	CategoryPath string    `json:"category_path"` // e.g. "Office > Software"
+	ProjectID    *int64    `json:"project_id"`    // nil for all projects
+	Period       string    `json:"period"`
+	Amount       Money     `json:"amount"`
+	Currency     string    `json:"currency"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// RuleConditions are the tests a CategorizationRule makes; every condition that is set
+// must hold. Text comparisons ignore case.
+type RuleConditions struct {
+	DescriptionContains string            `json:"description_contains,omitempty"`
+	DescriptionRegex    string            `json:"description_regex,omitempty"`
+	VendorID            *int64            `json:"vendor_id,omitempty"`
+	Source              string            `json:"source,omitempty"`     // equal to the expense's source
+	AmountMin           *Money            `json:"amount_min,omitempty"` // inclusive
+	AmountMax           *Money            `json:"amount_max,omitempty"` // inclusive
+	RawData             map[string]string `json:"raw_data,omitempty"`   // CSV column → text the value contains
+}
+
+// RuleActions are what a matching CategorizationRule does to an expense
+type RuleActions struct {
+	CategoryID *int64   `json:"category_id,omitempty"` // accepted category
+	IsPersonal *bool    `json:"is_personal,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// CategorizationRule is a user-defined rule that categorizes expenses without the AI. Rules
+// run in ascending priority; the first matching rule with a category or personal flag sets
+// it, and the tags of every matching rule are added.
+type CategorizationRule struct {
+	ID         int64          `json:"id"`
+	ProjectID  *int64         `json:"project_id"` // nil for all projects
+	Name       string         `json:"name"`
+	Priority   int            `json:"priority"`
+	Enabled    bool           `json:"enabled"`
+	Conditions RuleConditions `json:"conditions"`
+	Actions    RuleActions    `json:"actions"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// Propagation modes for UserSettings.PropagationMode
+const (
+	PropagationOff        = "off"        // never auto-propagate accepted categories
+	PropagationExact      = "exact"      // case-insensitive identical descriptions
+	PropagationNormalized = "normalized" // descriptions equal after stripping digits and punctuation
+	PropagationTrigram    = "trigram"    // pg_trgm similarity at or above PropagationThreshold
+	PropagationAmount     = "amount"     // normalized match plus amount within PropagationAmountTolerance
+	PropagationVendor     = "vendor"     // same canonical vendor
+)
+
+// UserSettings holds per-user preferences
+type UserSettings struct {
+	PropagationMode            string     `json:"propagation_mode"`
+	PropagationThreshold       float64    `json:"propagation_threshold"`
+	PropagationAmountTolerance Money      `json:"propagation_amount_tolerance"`
+	UpdatedAt                  *time.Time `json:"updated_at,omitempty"`
 }
 
 // ExpenseCategory is an alias for Category (for AI categorization compatibility)
 type ExpenseCategory = Category
 
-// ExpenseHistory tracks AI categorization attempts
+// ExpenseHistory is one audit event for an expense: AI suggestions, manual
+// accepts/clears, personal toggles, propagations, edits, deletes and undo/redo
 type ExpenseHistory struct {
-	ID                  int64     `json:"id"`
-	ExpenseID           int64     `json:"expense_id"`
-	SuggestedCategoryID *int64    `json:"suggested_category_id"`
-	AIModel             *string   `json:"ai_model"`
-	ConfidenceScore     *float32  `json:"confidence_score"`
-	Reasoning           *string   `json:"reasoning"`
-	CreatedAt           time.Time `json:"created_at"`
+	ID          int64           `json:"id"`
+	ExpenseID   int64           `json:"expense_id"`
+	EventType   string          `json:"event_type"`
+	CategoryID  *int64          `json:"category_id"`
+	ModelName   *string         `json:"model_name"`
+	Actor       *string         `json:"actor"`
+	OldValue    json.RawMessage `json:"old_value"`
+	NewValue    json.RawMessage `json:"new_value"`
+	ChangeSetID *int64          `json:"change_set_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ExpenseActivity is a history event with enough expense context for a project feed
+type ExpenseActivity struct {
+	ExpenseHistory
+	RowIndex    int     `json:"row_index"`
+	Description *string `json:"description"`
 }
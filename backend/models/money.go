@@ -0,0 +1,190 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Money is an exact amount in cents (hundredths of the currency unit). It scans from and
+// encodes to Postgres NUMERIC and marshals to a JSON number with two decimals, so amounts
+// never pass through float64 on their way between the database, CSV files and the API.
+type Money int64
+
+// decimalPattern is a plain decimal number: optional sign, digits, optional fraction. It
+// keeps out the fractions ("1/3") and exponents ("1e5") big.Rat would otherwise accept.
+var decimalPattern = regexp.MustCompile(`^[+-]?\d+(\.\d+)?$`)
+
+// parseDecimal reads a plain decimal number exactly
+func parseDecimal(text string) (*big.Rat, bool) {
+	if !decimalPattern.MatchString(text) {
+		return nil, false
+	}
+	return new(big.Rat).SetString(text)
+}
+
+// MoneyFromCents returns the amount for a whole number of cents
+func MoneyFromCents(cents int64) Money {
+	return Money(cents)
+}
+
+// ParseMoney parses an amount as it appears in bank exports: "$1,234.56", "-12.34",
+// "(12.34)" and "12.34-" are all accepted. More than two decimals round half away from zero.
+func ParseMoney(text string) (Money, error) {
+	clean := strings.TrimSpace(text)
+	negative := false
+	if strings.HasPrefix(clean, "(") && strings.HasSuffix(clean, ")") {
+		negative = true
+		clean = clean[1 : len(clean)-1]
+	}
+	if strings.HasSuffix(clean, "-") {
+		negative = !negative
+		clean = strings.TrimSuffix(clean, "-")
+	}
+	clean = strings.NewReplacer("$", "", "€", "", "£", "", ",", "", " ", "").Replace(clean)
+	if clean == "" {
+		return 0, fmt.Errorf("invalid amount: %q", text)
+	}
+
+	value, ok := parseDecimal(clean)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount: %q", text)
+	}
+	if negative {
+		value.Neg(value)
+	}
+	return moneyFromRat(value)
+}
+
+// moneyFromRat rounds an exact value to cents
+func moneyFromRat(value *big.Rat) (Money, error) {
+	cents, err := scaleRat(value, 100)
+	if err != nil {
+		return 0, fmt.Errorf("amount out of range: %s", value.FloatString(2))
+	}
+	return Money(cents), nil
+}
+
+// scaleRat multiplies an exact value by scale and rounds half away from zero
+func scaleRat(value *big.Rat, scale int64) (int64, error) {
+	scaled := new(big.Rat).Mul(value, big.NewRat(scale, 1))
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+
+	// Round half away from zero: compare twice the remainder with the denominator
+	remainder.Abs(remainder).Lsh(remainder, 1)
+	if remainder.Cmp(scaled.Denom()) >= 0 {
+		if scaled.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	if !quotient.IsInt64() {
+		return 0, fmt.Errorf("value out of range")
+	}
+	return quotient.Int64(), nil
+}
+
+// numericRat converts a finite, non-NULL numeric to an exact value
+func numericRat(n pgtype.Numeric, typeName string) (*big.Rat, error) {
+	if !n.Valid {
+		return nil, fmt.Errorf("cannot scan NULL into %s", typeName)
+	}
+	if n.NaN || n.InfinityModifier != pgtype.Finite {
+		return nil, fmt.Errorf("cannot scan non-finite numeric into %s", typeName)
+	}
+
+	value := new(big.Rat).SetInt(n.Int)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(absInt32(n.Exp))), nil)
+	if n.Exp >= 0 {
+		value.Mul(value, new(big.Rat).SetInt(scale))
+	} else {
+		value.Quo(value, new(big.Rat).SetInt(scale))
+	}
+	return value, nil
+}
+
+// Cents returns the amount as a whole number of cents
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// Float64 returns the amount in currency units, for statistics that don't need exactness
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// Abs returns the amount without its sign
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// String formats the amount with exactly two decimals, e.g. "-1234.50"
+func (m Money) String() string {
+	sign := ""
+	cents := uint64(m)
+	if m < 0 {
+		sign = "-"
+		cents = uint64(-m)
+		if m == math.MinInt64 {
+			cents = uint64(math.MaxInt64) + 1
+		}
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// MarshalJSON writes the amount as a JSON number with two decimals
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number or a numeric string without going through float64
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	text := string(bytes.Trim(data, `"`))
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner
+func (m *Money) ScanNumeric(n pgtype.Numeric) error {
+	value, err := numericRat(n, "Money")
+	if err != nil {
+		return err
+	}
+
+	parsed, err := moneyFromRat(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(m)), Exp: -2, Valid: true}, nil
+}
+
+func absInt32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
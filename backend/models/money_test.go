@@ -0,0 +1,142 @@
+package models
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		text string
+		want Money
+	}{
+		{"12.34", 1234},
+		{"-12.34", -1234},
+		{"$1,234.56", 123456},
+		{"-$1,234.56", -123456},
+		{"(45.10)", -4510},
+		{"45.10-", -4510},
+		{" 7 ", 700},
+		{"0.1", 10},
+		{"0.005", 1},
+		{"-0.005", -1},
+		{"0.0049", 0},
+		{"€99.99", 9999},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.text)
+		if err != nil {
+			t.Errorf("ParseMoney(%q) returned error: %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	for _, text := range []string{"", "abc", "$", "12.3.4", "99999999999999999999", "1/3", "1e5", "12.", ".5", "0x10"} {
+		if _, err := ParseMoney(text); err == nil {
+			t.Errorf("ParseMoney(%q) should fail", text)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := map[Money]string{
+		0:       "0.00",
+		5:       "0.05",
+		-5:      "-0.05",
+		123456:  "1234.56",
+		-100000: "-1000.00",
+	}
+	for amount, want := range tests {
+		if got := amount.String(); got != want {
+			t.Errorf("Money(%d).String() = %q, want %q", amount, got, want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var payload struct {
+		Amount  Money  `json:"amount"`
+		Missing *Money `json:"missing"`
+		Text    Money  `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": -19.99, "missing": null, "text": "3.10"}`), &payload); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if payload.Amount != -1999 || payload.Missing != nil || payload.Text != 310 {
+		t.Errorf("Unmarshal got %+v", payload)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `{"amount":-19.99,"missing":null,"text":3.10}`; string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+}
+
+func TestMoneyNumeric(t *testing.T) {
+	tests := []struct {
+		numeric pgtype.Numeric
+		want    Money
+	}{
+		{pgtype.Numeric{Int: big.NewInt(-1234), Exp: -2, Valid: true}, -1234},
+		{pgtype.Numeric{Int: big.NewInt(5), Exp: 3, Valid: true}, 500000},
+		{pgtype.Numeric{Int: big.NewInt(123456), Exp: -4, Valid: true}, 1235},
+		{pgtype.Numeric{Int: big.NewInt(-123450), Exp: -4, Valid: true}, -1235},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := got.ScanNumeric(tt.numeric); err != nil {
+			t.Errorf("ScanNumeric(%v) returned error: %v", tt.numeric, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ScanNumeric(%v) = %d, want %d", tt.numeric, got, tt.want)
+		}
+	}
+
+	var null Money
+	if err := null.ScanNumeric(pgtype.Numeric{}); err == nil {
+		t.Errorf("ScanNumeric should reject NULL")
+	}
+
+	numeric, err := Money(-4510).NumericValue()
+	if err != nil || numeric.Int.Int64() != -4510 || numeric.Exp != -2 {
+		t.Errorf("NumericValue = %v, %v", numeric, err)
+	}
+}
+
+// TestMoneyAdditionIsExact checks that adding parsed amounts agrees with exact decimal
+// arithmetic to the cent; the totals report itself is tested in handlers
+func TestMoneyAdditionIsExact(t *testing.T) {
+	amounts := []string{"0.10", "0.20", "19.99", "-3.33", "1234567.89", "0.01"}
+
+	var total Money
+	exact := new(big.Rat)
+	for i := 0; i < 100000; i++ {
+		text := amounts[i%len(amounts)]
+		amount, err := ParseMoney(text)
+		if err != nil {
+			t.Fatalf("ParseMoney(%q) failed: %v", text, err)
+		}
+		total += amount
+
+		value, _ := new(big.Rat).SetString(text)
+		exact.Add(exact, value)
+	}
+
+	if got, want := total.String(), exact.FloatString(2); got != want {
+		t.Errorf("Money total = %s, want %s", got, want)
+	}
+	if big.NewRat(int64(total), 100).Cmp(exact) != 0 {
+		t.Errorf("Money total %s is not exact", total)
+	}
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// rateScale is the number of Rate units in 1: rates keep eight decimals, as the
+// exchange_rate.rate column does
+const rateScale = 100000000
+
+// Rate is an exact exchange rate in hundred-millionths. Like Money it scans from and encodes
+// to Postgres NUMERIC and marshals to a JSON number without passing through float64.
+type Rate int64
+
+// ParseRate parses a plain decimal rate such as "1.0845". More than eight decimals round
+// half away from zero.
+func ParseRate(text string) (Rate, error) {
+	value, ok := parseDecimal(strings.TrimSpace(text))
+	if !ok {
+		return 0, fmt.Errorf("invalid rate: %q", text)
+	}
+	return rateFromRat(value)
+}
+
+// rateFromRat rounds an exact value to eight decimals
+func rateFromRat(value *big.Rat) (Rate, error) {
+	scaled, err := scaleRat(value, rateScale)
+	if err != nil {
+		return 0, fmt.Errorf("rate out of range: %s", value.FloatString(8))
+	}
+	return Rate(scaled), nil
+}
+
+// String formats the rate with its significant decimals, e.g. "1.0845" or "150.0"
+func (r Rate) String() string {
+	text := big.NewRat(int64(r), rateScale).FloatString(8)
+	text = strings.TrimRight(text, "0")
+	if strings.HasSuffix(text, ".") {
+		text += "0"
+	}
+	return text
+}
+
+// MarshalJSON writes the rate as a JSON number
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number or a numeric string without going through float64
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	parsed, err := ParseRate(string(bytes.Trim(data, `"`)))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner
+func (r *Rate) ScanNumeric(n pgtype.Numeric) error {
+	value, err := numericRat(n, "Rate")
+	if err != nil {
+		return err
+	}
+	parsed, err := rateFromRat(value)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer
+func (r Rate) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(r)), Exp: -8, Valid: true}, nil
+}
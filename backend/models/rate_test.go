@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		text string
+		want Rate
+	}{
+		{"1.0845", 108450000},
+		{" 150 ", 15000000000},
+		{"0.000000005", 1},
+		{"0.000000004", 0},
+		{"7.123456789", 712345679},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.text)
+		if err != nil {
+			t.Errorf("ParseRate(%q) returned error: %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	for _, text := range []string{"", "abc", "1/3", "1e5", "1,5"} {
+		if _, err := ParseRate(text); err == nil {
+			t.Errorf("ParseRate(%q) should fail", text)
+		}
+	}
+}
+
+func TestRateJSONAndNumeric(t *testing.T) {
+	var payload struct {
+		Rate Rate `json:"rate"`
+	}
+	if err := json.Unmarshal([]byte(`{"rate": 0.9213}`), &payload); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if payload.Rate != 92130000 {
+		t.Errorf("Unmarshal got %d", payload.Rate)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil || string(data) != `{"rate":0.9213}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+	if got := Rate(15000000000).String(); got != "150.0" {
+		t.Errorf("String = %q, want 150.0", got)
+	}
+
+	var scanned Rate
+	if err := scanned.ScanNumeric(pgtype.Numeric{Int: big.NewInt(108450000), Exp: -8, Valid: true}); err != nil || scanned != 108450000 {
+		t.Errorf("ScanNumeric = %d, %v", scanned, err)
+	}
+	numeric, err := Rate(108450000).NumericValue()
+	if err != nil || numeric.Int.Int64() != 108450000 || numeric.Exp != -8 {
+		t.Errorf("NumericValue = %v, %v", numeric, err)
+	}
+}
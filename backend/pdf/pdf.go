@@ -0,0 +1,152 @@
+// Package pdf writes simple text reports as PDF files: US Letter pages of monospaced lines,
+// optionally bold, with no dependencies beyond the standard library.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	pageWidth    = 612 // US Letter, in points
+	pageHeight   = 792
+	margin       = 54
+	fontSize     = 9
+	lineHeight   = 12
+	linesPerPage = (pageHeight - 2*margin) / lineHeight
+)
+
+// LineWidth is how many characters fit across a page at the report font size
+const LineWidth = (pageWidth - 2*margin) * 10 / (fontSize * 6) // Courier is 0.6em wide
+
+type line struct {
+	text string
+	bold bool
+}
+
+// Document is a text report built line by line. Pages break automatically.
+type Document struct {
+	title string
+	lines []line
+}
+
+// New starts a document; the title goes into the file's metadata
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// Line adds a line of regular text. Text longer than LineWidth is cut off.
+func (d *Document) Line(text string) {
+	d.lines = append(d.lines, line{text: text})
+}
+
+// BoldLine adds a line of bold text
+func (d *Document) BoldLine(text string) {
+	d.lines = append(d.lines, line{text: text, bold: true})
+}
+
+// PageBreak starts a new page unless the current one is empty
+func (d *Document) PageBreak() {
+	for len(d.lines)%linesPerPage != 0 {
+		d.lines = append(d.lines, line{})
+	}
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() []byte {
+	pages := make([][]line, 0, len(d.lines)/linesPerPage+1)
+	for start := 0; start < len(d.lines); start += linesPerPage {
+		end := start + linesPerPage
+		if end > len(d.lines) {
+			end = len(d.lines)
+		}
+		pages = append(pages, d.lines[start:end])
+	}
+	if len(pages) == 0 {
+		pages = append(pages, nil)
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3 regular font, 4 bold font, 5 info, then a page and
+	// its content stream for each page
+	const firstPageObject = 6
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObject+2*i)
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	objects = append(objects, fmt.Sprintf("<< /Title (%s) /Producer (ookkee) >>", escape(d.title)))
+
+	for i, page := range pages {
+		content := pageContent(page)
+		objects = append(objects, fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, firstPageObject+2*i+1))
+		objects = append(objects, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// pageContent draws a page's lines from the top margin down
+func pageContent(lines []line) string {
+	var content strings.Builder
+	content.WriteString("BT\n")
+	fmt.Fprintf(&content, "%d TL\n%d %d Td\n", lineHeight, margin, pageHeight-margin-fontSize)
+	for i, l := range lines {
+		font := "F1"
+		if l.bold {
+			font = "F2"
+		}
+		if i > 0 {
+			content.WriteString("T*\n")
+		}
+		text := l.text
+		if len([]rune(text)) > LineWidth {
+			text = string([]rune(text)[:LineWidth])
+		}
+		fmt.Fprintf(&content, "/%s %d Tf (%s) Tj\n", font, fontSize, escape(text))
+	}
+	content.WriteString("ET")
+	return content.String()
+}
+
+// escape makes text safe inside a PDF string literal. Characters outside Latin-1 become '?'.
+func escape(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			escaped.WriteByte('\\')
+			escaped.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			escaped.WriteByte(' ')
+		case r < 0x20 || r > 0xFF:
+			escaped.WriteByte('?')
+		case r < 0x80:
+			escaped.WriteRune(r)
+		default:
+			fmt.Fprintf(&escaped, "\\%03o", r)
+		}
+	}
+	return escaped.String()
+}
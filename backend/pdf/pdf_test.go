@@ -0,0 +1,91 @@
+package pdf
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBytesStructure(t *testing.T) {
+	doc := New("Schedule C")
+	doc.BoldLine("Schedule C (Form 1040)")
+	doc.Line("Line 8  Advertising  120.00")
+
+	out := doc.Bytes()
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) {
+		t.Fatalf("missing PDF header")
+	}
+	if !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("missing EOF marker")
+	}
+
+	// startxref must point at the xref table, and every xref entry at its object
+	match := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if match == nil {
+		t.Fatalf("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		want := strconv.Itoa(i+1) + " 0 obj\n"
+		if !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q, want %q", i+1, out[offset:offset+len(want)], want)
+		}
+	}
+
+	if !bytes.Contains(out, []byte("(Line 8  Advertising  120.00) Tj")) {
+		t.Errorf("missing line text")
+	}
+	if !bytes.Contains(out, []byte("/F2 9 Tf (Schedule C \\(Form 1040\\)) Tj")) {
+		t.Errorf("bold line not escaped or not bold")
+	}
+}
+
+func TestPageBreaks(t *testing.T) {
+	doc := New("Long")
+	for i := 0; i < linesPerPage*2+1; i++ {
+		doc.Line("row " + strconv.Itoa(i))
+	}
+	if got := bytes.Count(doc.Bytes(), []byte("/Type /Page ")); got != 3 {
+		t.Errorf("got %d pages, want 3", got)
+	}
+
+	doc = New("Sections")
+	doc.Line("first")
+	doc.PageBreak()
+	doc.Line("second")
+	if got := bytes.Count(doc.Bytes(), []byte("/Type /Page ")); got != 2 {
+		t.Errorf("got %d pages after PageBreak, want 2", got)
+	}
+
+	if got := bytes.Count(New("Empty").Bytes(), []byte("/Type /Page ")); got != 1 {
+		t.Errorf("empty document has %d pages, want 1", got)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := map[string]string{
+		`a\b`:     `a\\b`,
+		"(x)":     `\(x\)`,
+		"Café":    `Caf\351`,
+		"→ ok":    "? ok",
+		"a\tb\nc": "a b c",
+	}
+	for in, want := range tests {
+		if got := escape(in); got != want {
+			t.Errorf("escape(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	long := strings.Repeat("x", LineWidth+10)
+	if strings.Contains(pageContent([]line{{text: long}}), long) {
+		t.Errorf("long line was not cut to LineWidth")
+	}
+}
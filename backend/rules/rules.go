@@ -0,0 +1,228 @@
+// Package rules evaluates user-defined categorization rules against expenses, e.g.
+// "description contains GITHUB → Software" or "source is Amex, amount at most -0.01 and
+// description contains DELTA → Airfare".
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"ookkee/models"
+)
+
+// Expense is what rules see of an expense
+type Expense struct {
+	Description string
+	VendorID    *int64
+	Source      string
+	Amount      *models.Money
+	RawData     map[string]string // CSV column → value
+}
+
+// Rule is a validated rule ready for matching
+type Rule struct {
+	models.CategorizationRule
+
+	pattern *regexp.Regexp
+}
+
+// Outcome is the combined effect of the rules that match one expense
+type Outcome struct {
+	CategoryID     *int64
+	CategoryRuleID int64 // the rule that set CategoryID
+	IsPersonal     *bool
+	PersonalRuleID int64 // the rule that set IsPersonal
+	Tags           []string
+	MatchedRuleIDs []int64
+}
+
+// Matched reports whether any rule matched
+func (o Outcome) Matched() bool {
+	return len(o.MatchedRuleIDs) > 0
+}
+
+// NormalizeTags lower-cases and trims tags, dropping blanks and duplicates
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// Compile validates a rule and prepares it for matching. A rule needs a name, at least one
+// condition and at least one action.
+func Compile(rule models.CategorizationRule) (*Rule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return nil, fmt.Errorf("rule name is required")
+	}
+
+	conditions := &rule.Conditions
+	conditions.DescriptionContains = strings.TrimSpace(conditions.DescriptionContains)
+	conditions.Source = strings.TrimSpace(conditions.Source)
+	rawData := make(map[string]string, len(conditions.RawData))
+	for column, value := range conditions.RawData {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			return nil, fmt.Errorf("raw_data condition has no column name")
+		}
+		rawData[column] = strings.TrimSpace(value)
+	}
+	conditions.RawData = rawData
+	if len(rawData) == 0 {
+		conditions.RawData = nil
+	}
+
+	if conditions.DescriptionContains == "" && conditions.DescriptionRegex == "" && conditions.VendorID == nil &&
+		conditions.Source == "" && conditions.AmountMin == nil && conditions.AmountMax == nil && len(rawData) == 0 {
+		return nil, fmt.Errorf("rule %s has no conditions", rule.Name)
+	}
+	if conditions.AmountMin != nil && conditions.AmountMax != nil && *conditions.AmountMin > *conditions.AmountMax {
+		return nil, fmt.Errorf("rule %s: amount_min is greater than amount_max", rule.Name)
+	}
+
+	compiled := &Rule{CategorizationRule: rule}
+	if conditions.DescriptionRegex != "" {
+		pattern, err := regexp.Compile("(?i)" + conditions.DescriptionRegex)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid description_regex: %v", rule.Name, err)
+		}
+		compiled.pattern = pattern
+	}
+
+	actions := &compiled.Actions
+	actions.Tags = NormalizeTags(actions.Tags)
+	if len(actions.Tags) == 0 {
+		actions.Tags = nil
+	}
+	if actions.CategoryID == nil && actions.IsPersonal == nil && len(actions.Tags) == 0 {
+		return nil, fmt.Errorf("rule %s has no actions", rule.Name)
+	}
+
+	return compiled, nil
+}
+
+// containsFold reports whether s contains substr, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// Matches reports whether every condition of the rule holds for the expense. An expense
+// without an amount fails amount conditions.
+func (r *Rule) Matches(expense Expense) bool {
+	conditions := r.Conditions
+
+	if conditions.DescriptionContains != "" && !containsFold(expense.Description, conditions.DescriptionContains) {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(expense.Description) {
+		return false
+	}
+	if conditions.VendorID != nil && (expense.VendorID == nil || *expense.VendorID != *conditions.VendorID) {
+		return false
+	}
+	if conditions.Source != "" && !strings.EqualFold(strings.TrimSpace(expense.Source), conditions.Source) {
+		return false
+	}
+	if conditions.AmountMin != nil && (expense.Amount == nil || *expense.Amount < *conditions.AmountMin) {
+		return false
+	}
+	if conditions.AmountMax != nil && (expense.Amount == nil || *expense.Amount > *conditions.AmountMax) {
+		return false
+	}
+	for column, want := range conditions.RawData {
+		value, ok := rawDataValue(expense.RawData, column)
+		if !ok || !containsFold(value, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// rawDataValue looks up a CSV column by name, ignoring case when there is no exact match
+func rawDataValue(rawData map[string]string, column string) (string, bool) {
+	if value, ok := rawData[column]; ok {
+		return value, true
+	}
+	for name, value := range rawData {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Sort orders rules for evaluation: ascending priority, then oldest first
+func Sort(rules []*Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].ID < rules[j].ID
+	})
+}
+
+// Evaluate runs sorted rules against an expense. The first matching rule that sets a
+// category decides the category, and likewise for the personal flag; tags from every
+// matching rule are collected in rule order.
+func Evaluate(rules []*Rule, expense Expense) Outcome {
+	outcome := Outcome{Tags: []string{}}
+	seenTags := make(map[string]bool)
+	for _, rule := range rules {
+		if !rule.Matches(expense) {
+			continue
+		}
+		outcome.MatchedRuleIDs = append(outcome.MatchedRuleIDs, rule.ID)
+
+		if rule.Actions.CategoryID != nil && outcome.CategoryID == nil {
+			categoryID := *rule.Actions.CategoryID
+			outcome.CategoryID = &categoryID
+			outcome.CategoryRuleID = rule.ID
+		}
+		if rule.Actions.IsPersonal != nil && outcome.IsPersonal == nil {
+			isPersonal := *rule.Actions.IsPersonal
+			outcome.IsPersonal = &isPersonal
+			outcome.PersonalRuleID = rule.ID
+		}
+		for _, tag := range rule.Actions.Tags {
+			if !seenTags[tag] {
+				seenTags[tag] = true
+				outcome.Tags = append(outcome.Tags, tag)
+			}
+		}
+	}
+	return outcome
+}
+
+// ParseRawData turns an expense's raw_data JSON into column → text. Non-string values are
+// formatted as JSON.
+func ParseRawData(raw json.RawMessage) map[string]string {
+	values := make(map[string]interface{})
+	if len(raw) == 0 || json.Unmarshal(raw, &values) != nil {
+		return map[string]string{}
+	}
+
+	rawData := make(map[string]string, len(values))
+	for column, value := range values {
+		switch v := value.(type) {
+		case string:
+			rawData[column] = v
+		case nil:
+			rawData[column] = ""
+		default:
+			encoded, _ := json.Marshal(v)
+			rawData[column] = string(encoded)
+		}
+	}
+	return rawData
+}
@@ -0,0 +1,166 @@
+package rules
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"ookkee/models"
+)
+
+func money(cents int64) *models.Money {
+	m := models.MoneyFromCents(cents)
+	return &m
+}
+
+func id(v int64) *int64 {
+	return &v
+}
+
+func mustCompile(t *testing.T, rule models.CategorizationRule) *Rule {
+	t.Helper()
+	compiled, err := Compile(rule)
+	if err != nil {
+		t.Fatalf("Compile(%s): %v", rule.Name, err)
+	}
+	return compiled
+}
+
+func TestCompileValidation(t *testing.T) {
+	personal := true
+	tests := []struct {
+		name    string
+		rule    models.CategorizationRule
+		wantErr bool
+	}{
+		{"valid", models.CategorizationRule{Name: "GitHub",
+			Conditions: models.RuleConditions{DescriptionContains: "github"},
+			Actions:    models.RuleActions{CategoryID: id(1)}}, false},
+		{"no name", models.CategorizationRule{Name: " ",
+			Conditions: models.RuleConditions{DescriptionContains: "github"},
+			Actions:    models.RuleActions{CategoryID: id(1)}}, true},
+		{"no conditions", models.CategorizationRule{Name: "Everything",
+			Actions: models.RuleActions{IsPersonal: &personal}}, true},
+		{"blank tags are no action", models.CategorizationRule{Name: "Tags",
+			Conditions: models.RuleConditions{Source: "Amex"},
+			Actions:    models.RuleActions{Tags: []string{" ", ""}}}, true},
+		{"bad regex", models.CategorizationRule{Name: "Regex",
+			Conditions: models.RuleConditions{DescriptionRegex: "("},
+			Actions:    models.RuleActions{CategoryID: id(1)}}, true},
+		{"inverted amount range", models.CategorizationRule{Name: "Range",
+			Conditions: models.RuleConditions{AmountMin: money(500), AmountMax: money(100)},
+			Actions:    models.RuleActions{CategoryID: id(1)}}, true},
+		{"blank raw data column", models.CategorizationRule{Name: "Raw",
+			Conditions: models.RuleConditions{RawData: map[string]string{" ": "x"}},
+			Actions:    models.RuleActions{CategoryID: id(1)}}, true},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(tt.rule)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Compile error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	delta := mustCompile(t, models.CategorizationRule{Name: "Delta on Amex",
+		Conditions: models.RuleConditions{
+			DescriptionContains: "delta",
+			Source:              "AMEX",
+			AmountMax:           money(-1),
+		},
+		Actions: models.RuleActions{CategoryID: id(7)},
+	})
+	regex := mustCompile(t, models.CategorizationRule{Name: "Airlines",
+		Conditions: models.RuleConditions{DescriptionRegex: `^(united|delta) air`},
+		Actions:    models.RuleActions{CategoryID: id(7)},
+	})
+	vendor := mustCompile(t, models.CategorizationRule{Name: "Vendor",
+		Conditions: models.RuleConditions{VendorID: id(3), AmountMin: money(1000)},
+		Actions:    models.RuleActions{Tags: []string{"big"}},
+	})
+	raw := mustCompile(t, models.CategorizationRule{Name: "Card",
+		Conditions: models.RuleConditions{RawData: map[string]string{"card member": "smith"}},
+		Actions:    models.RuleActions{Tags: []string{"smith"}},
+	})
+
+	tests := []struct {
+		name    string
+		rule    *Rule
+		expense Expense
+		want    bool
+	}{
+		{"all conditions hold", delta, Expense{Description: "DELTA AIR 0062", Source: "Amex", Amount: money(-45000)}, true},
+		{"wrong source", delta, Expense{Description: "DELTA AIR 0062", Source: "Chase", Amount: money(-45000)}, false},
+		{"amount above max", delta, Expense{Description: "DELTA AIR 0062", Source: "Amex", Amount: money(45000)}, false},
+		{"no amount", delta, Expense{Description: "DELTA AIR 0062", Source: "Amex"}, false},
+		{"regex ignores case", regex, Expense{Description: "United Airlines"}, true},
+		{"regex anchored", regex, Expense{Description: "PAYMENT DELTA AIR"}, false},
+		{"vendor and minimum", vendor, Expense{VendorID: id(3), Amount: money(1000)}, true},
+		{"other vendor", vendor, Expense{VendorID: id(4), Amount: money(1000)}, false},
+		{"no vendor", vendor, Expense{Amount: money(1000)}, false},
+		{"raw data column ignores case", raw, Expense{RawData: map[string]string{"Card Member": "J SMITH"}}, true},
+		{"raw data value differs", raw, Expense{RawData: map[string]string{"Card Member": "A JONES"}}, false},
+		{"raw data column missing", raw, Expense{RawData: map[string]string{}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.rule.Matches(tt.expense); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluatePriority(t *testing.T) {
+	personal := true
+	business := false
+	all := []*Rule{
+		mustCompile(t, models.CategorizationRule{ID: 1, Name: "Amazon", Priority: 200,
+			Conditions: models.RuleConditions{DescriptionContains: "amazon"},
+			Actions:    models.RuleActions{CategoryID: id(10), IsPersonal: &personal, Tags: []string{"Online"}}}),
+		mustCompile(t, models.CategorizationRule{ID: 2, Name: "AWS", Priority: 100,
+			Conditions: models.RuleConditions{DescriptionContains: "amazon web services"},
+			Actions:    models.RuleActions{CategoryID: id(20), Tags: []string{"cloud", "online"}}}),
+		mustCompile(t, models.CategorizationRule{ID: 3, Name: "Business", Priority: 200,
+			Conditions: models.RuleConditions{DescriptionContains: "web"},
+			Actions:    models.RuleActions{IsPersonal: &business}}),
+	}
+	Sort(all)
+
+	outcome := Evaluate(all, Expense{Description: "AMAZON WEB SERVICES"})
+	if outcome.CategoryID == nil || *outcome.CategoryID != 20 || outcome.CategoryRuleID != 2 {
+		t.Errorf("category = %v from rule %d, want 20 from rule 2", outcome.CategoryID, outcome.CategoryRuleID)
+	}
+	if outcome.IsPersonal == nil || !*outcome.IsPersonal || outcome.PersonalRuleID != 1 {
+		t.Errorf("personal = %v from rule %d, want true from rule 1", outcome.IsPersonal, outcome.PersonalRuleID)
+	}
+	if want := []string{"cloud", "online"}; !reflect.DeepEqual(outcome.Tags, want) {
+		t.Errorf("tags = %v, want %v", outcome.Tags, want)
+	}
+	if want := []int64{2, 1, 3}; !reflect.DeepEqual(outcome.MatchedRuleIDs, want) {
+		t.Errorf("matched = %v, want %v", outcome.MatchedRuleIDs, want)
+	}
+
+	if outcome := Evaluate(all, Expense{Description: "Starbucks"}); outcome.Matched() {
+		t.Errorf("no rule should match, got %v", outcome.MatchedRuleIDs)
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{" Travel", "travel", "", "Client A "})
+	if want := []string{"travel", "client a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeTags = %v, want %v", got, want)
+	}
+}
+
+func TestParseRawData(t *testing.T) {
+	got := ParseRawData(json.RawMessage(`{"Card Member": "J SMITH", "Amount": 12.5, "Memo": null}`))
+	want := map[string]string{"Card Member": "J SMITH", "Amount": "12.5", "Memo": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRawData = %v, want %v", got, want)
+	}
+	if got := ParseRawData(nil); len(got) != 0 {
+		t.Errorf("ParseRawData(nil) = %v, want empty", got)
+	}
+}
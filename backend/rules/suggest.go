@@ -0,0 +1,298 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ookkee/merchant"
+	"ookkee/models"
+)
+
+// Suggestion kinds: a vendor, or a word that appears in descriptions
+const (
+	SuggestVendor      = "vendor"
+	SuggestDescription = "description"
+)
+
+// minTokenLength is the shortest description word worth a rule; shorter ones match too much
+const minTokenLength = 3
+
+// stopTokens are description words that say nothing about the merchant
+var stopTokens = map[string]bool{
+	"and": true, "the": true, "inc": true, "llc": true, "ltd": true, "corp": true, "company": true,
+	"com": true, "www": true, "net": true, "org": true, "usa": true, "intl": true, "international": true,
+	"payment": true, "purchase": true, "online": true, "store": true, "service": true, "services": true,
+	"pos": true, "debit": true, "credit": true, "card": true, "recurring": true, "autopay": true,
+}
+
+// History is one accepted categorization that suggestions are mined from
+type History struct {
+	Description string
+	VendorID    *int64
+	VendorName  string
+	CategoryID  int64
+}
+
+// SuggestOptions bound which patterns become suggestions
+type SuggestOptions struct {
+	MinSupport   int     // expenses the pattern must match
+	MinPrecision float64 // share of those already in the suggested category, 0 to 1
+}
+
+// Suggestion is a pattern that maps to one category in the accepted history
+type Suggestion struct {
+	Kind       string  `json:"kind"`
+	Pattern    string  `json:"pattern"` // vendor name, or the word descriptions contain
+	VendorID   *int64  `json:"vendor_id,omitempty"`
+	CategoryID int64   `json:"category_id"`
+	Support    int     `json:"support"`   // expenses the pattern matches
+	Matches    int     `json:"matches"`   // of those, the ones in CategoryID
+	Precision  float64 `json:"precision"` // Matches / Support
+	Coverage   float64 `json:"coverage"`  // Matches / all of the history
+}
+
+// Key identifies a suggestion so it can be accepted later: "vendor:<id>:<category>" or
+// "description:<word>:<category>"
+func (s Suggestion) Key() string {
+	pattern := s.Pattern
+	if s.Kind == SuggestVendor && s.VendorID != nil {
+		pattern = strconv.FormatInt(*s.VendorID, 10)
+	}
+	return fmt.Sprintf("%s:%s:%d", s.Kind, pattern, s.CategoryID)
+}
+
+// ParseSuggestionKey reads a key made by Key. Only the kind, pattern (or vendor) and
+// category are filled in; a vendor suggestion's Pattern is left empty.
+func ParseSuggestionKey(key string) (Suggestion, error) {
+	parts := strings.Split(strings.TrimSpace(key), ":")
+	if len(parts) != 3 || parts[1] == "" {
+		return Suggestion{}, fmt.Errorf("invalid suggestion key %q", key)
+	}
+	categoryID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return Suggestion{}, fmt.Errorf("invalid suggestion key %q", key)
+	}
+
+	suggestion := Suggestion{Kind: parts[0], CategoryID: categoryID}
+	switch suggestion.Kind {
+	case SuggestVendor:
+		vendorID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return Suggestion{}, fmt.Errorf("invalid suggestion key %q", key)
+		}
+		suggestion.VendorID = &vendorID
+	case SuggestDescription:
+		suggestion.Pattern = strings.ToLower(parts[1])
+	default:
+		return Suggestion{}, fmt.Errorf("invalid suggestion key %q", key)
+	}
+	return suggestion, nil
+}
+
+// Rule is the categorization rule a suggestion proposes, enabled and named after its
+// pattern
+func (s Suggestion) Rule() models.CategorizationRule {
+	categoryID := s.CategoryID
+	rule := models.CategorizationRule{
+		Enabled: true,
+		Actions: models.RuleActions{CategoryID: &categoryID},
+	}
+	if s.Kind == SuggestVendor {
+		vendorID := *s.VendorID
+		rule.Name = s.Pattern
+		rule.Conditions.VendorID = &vendorID
+	} else {
+		rule.Name = fmt.Sprintf("Description contains %q", s.Pattern)
+		rule.Conditions.DescriptionContains = s.Pattern
+	}
+	return rule
+}
+
+// descriptionTokens returns the distinct words of a description's vendor name that could
+// anchor a rule, lower-cased. Words the raw description does not contain are skipped so a
+// description_contains rule matches what was counted.
+func descriptionTokens(description string) []string {
+	lowered := strings.ToLower(description)
+	tokens := []string{}
+	seen := make(map[string]bool)
+	for _, word := range strings.Fields(strings.ToLower(merchant.Normalize(description))) {
+		if len(word) < minTokenLength || stopTokens[word] || seen[word] ||
+			strings.IndexFunc(word, unicode.IsLetter) < 0 || !strings.Contains(lowered, word) {
+			continue
+		}
+		seen[word] = true
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// patternStats counts a pattern's matches per category
+type patternStats struct {
+	rows       []int // indexes into the history
+	categories map[int64]int
+}
+
+func (p *patternStats) add(index int, categoryID int64) {
+	if p.categories == nil {
+		p.categories = make(map[int64]int)
+	}
+	p.rows = append(p.rows, index)
+	p.categories[categoryID]++
+}
+
+// top returns the pattern's most common category and its count, the lowest ID on ties
+func (p *patternStats) top() (int64, int) {
+	var best int64
+	count := 0
+	for categoryID, n := range p.categories {
+		if n > count || (n == count && categoryID < best) {
+			best, count = categoryID, n
+		}
+	}
+	return best, count
+}
+
+// ratio rounds n/total to three places
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(total)*1000) / 1000
+}
+
+// Suggest mines accepted categorizations for vendors and description words that map to one
+// category, keeping those with at least MinSupport expenses and MinPrecision of them in the
+// category. A word is dropped when a vendor suggestion for the same category already covers
+// every expense it matches, and words matching exactly the same expenses are suggested once.
+// Suggestions come back with the most matches first.
+func Suggest(history []History, opts SuggestOptions) []Suggestion {
+	if opts.MinSupport < 1 {
+		opts.MinSupport = 1
+	}
+
+	vendors := make(map[int64]*patternStats)
+	vendorNames := make(map[int64]string)
+	tokenCounts := make(map[string]int)
+	for i, h := range history {
+		if h.VendorID != nil {
+			if vendors[*h.VendorID] == nil {
+				vendors[*h.VendorID] = &patternStats{}
+				vendorNames[*h.VendorID] = h.VendorName
+			}
+			vendors[*h.VendorID].add(i, h.CategoryID)
+		}
+		for _, token := range descriptionTokens(h.Description) {
+			tokenCounts[token]++
+		}
+	}
+
+	// Only words found in enough vendor names are candidates; their support then counts every
+	// description that contains them
+	tokens := make(map[string]*patternStats)
+	for token, n := range tokenCounts {
+		if n >= opts.MinSupport {
+			tokens[token] = &patternStats{}
+		}
+	}
+	for i, h := range history {
+		lowered := strings.ToLower(h.Description)
+		for token, stats := range tokens {
+			if strings.Contains(lowered, token) {
+				stats.add(i, h.CategoryID)
+			}
+		}
+	}
+
+	qualifies := func(stats *patternStats) (Suggestion, bool) {
+		categoryID, matches := stats.top()
+		support := len(stats.rows)
+		if support < opts.MinSupport || ratio(matches, support) < opts.MinPrecision {
+			return Suggestion{}, false
+		}
+		return Suggestion{
+			CategoryID: categoryID,
+			Support:    support,
+			Matches:    matches,
+			Precision:  ratio(matches, support),
+			Coverage:   ratio(matches, len(history)),
+		}, true
+	}
+
+	suggestions := []Suggestion{}
+	vendorCategory := make(map[int64]int64) // vendor → category it is suggested for
+	for vendorID, stats := range vendors {
+		suggestion, ok := qualifies(stats)
+		if !ok {
+			continue
+		}
+		id := vendorID
+		suggestion.Kind = SuggestVendor
+		suggestion.Pattern = vendorNames[vendorID]
+		suggestion.VendorID = &id
+		vendorCategory[vendorID] = suggestion.CategoryID
+		suggestions = append(suggestions, suggestion)
+	}
+
+	// Longer words first, so of words matching the same expenses the most specific is kept
+	words := make([]string, 0, len(tokens))
+	for token := range tokens {
+		words = append(words, token)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+
+	seenRows := make(map[string]bool)
+	for _, token := range words {
+		stats := tokens[token]
+		suggestion, ok := qualifies(stats)
+		if !ok || coveredByVendor(history, stats.rows, vendorCategory, suggestion.CategoryID) {
+			continue
+		}
+		rowsKey := fmt.Sprintf("%d:%v", suggestion.CategoryID, stats.rows)
+		if seenRows[rowsKey] {
+			continue
+		}
+		seenRows[rowsKey] = true
+
+		suggestion.Kind = SuggestDescription
+		suggestion.Pattern = token
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Matches != b.Matches {
+			return a.Matches > b.Matches
+		}
+		if a.Precision != b.Precision {
+			return a.Precision > b.Precision
+		}
+		if a.Kind != b.Kind {
+			return a.Kind == SuggestVendor
+		}
+		return a.Key() < b.Key()
+	})
+	return suggestions
+}
+
+// coveredByVendor reports whether every row has a vendor that is suggested for categoryID
+func coveredByVendor(history []History, rows []int, vendorCategory map[int64]int64, categoryID int64) bool {
+	for _, i := range rows {
+		vendorID := history[i].VendorID
+		if vendorID == nil {
+			return false
+		}
+		if suggested, ok := vendorCategory[*vendorID]; !ok || suggested != categoryID {
+			return false
+		}
+	}
+	return true
+}
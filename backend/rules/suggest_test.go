@@ -0,0 +1,85 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func history(description string, vendorID *int64, vendorName string, categoryID int64) History {
+	return History{Description: description, VendorID: vendorID, VendorName: vendorName, CategoryID: categoryID}
+}
+
+func TestSuggest(t *testing.T) {
+	all := []History{
+		history("GITHUB, INC. XXXX1234", id(1), "Github", 10),
+		history("GITHUB, INC. XXXX1234", id(1), "Github", 10),
+		history("GITHUB, INC. XXXX9876", id(1), "Github", 10),
+		history("SQ *BLUE BOTTLE COFFEE", nil, "", 20),
+		history("SQ *BLUE BOTTLE COFFEE", nil, "", 20),
+		history("SQ *BLUE BOTTLE COFFEE", nil, "", 20),
+		history("SHELL OIL 57444", id(2), "Shell Oil", 30),
+		history("SHELL OIL 57444", id(2), "Shell Oil", 30),
+		history("SHELL OIL 57444", id(2), "Shell Oil", 40),
+		history("UBER TRIP", nil, "", 50),
+	}
+
+	got := Suggest(all, SuggestOptions{MinSupport: 3, MinPrecision: 0.9})
+
+	var keys []string
+	for _, s := range got {
+		keys = append(keys, s.Key())
+	}
+	// github is covered by its vendor; blue, bottle and coffee match the same rows, so only
+	// the longest word is kept; shell is 2/3 pure and uber too rare
+	if want := []string{"vendor:1:10", "description:bottle:20"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("suggestions = %v, want %v", keys, want)
+	}
+
+	vendor := got[0]
+	if vendor.Pattern != "Github" || vendor.Support != 3 || vendor.Matches != 3 || vendor.Precision != 1 || vendor.Coverage != 0.3 {
+		t.Errorf("vendor suggestion = %+v", vendor)
+	}
+
+	loose := Suggest(all, SuggestOptions{MinSupport: 3, MinPrecision: 0.6})
+	found := false
+	for _, s := range loose {
+		if s.Key() == "vendor:2:30" {
+			found = true
+			if s.Support != 3 || s.Matches != 2 || s.Precision != 0.667 {
+				t.Errorf("shell suggestion = %+v", s)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("lower precision threshold should suggest the Shell vendor")
+	}
+}
+
+func TestSuggestionKey(t *testing.T) {
+	suggestion := Suggestion{Kind: SuggestVendor, Pattern: "Github", VendorID: id(7), CategoryID: 3}
+	parsed, err := ParseSuggestionKey(suggestion.Key())
+	if err != nil {
+		t.Fatalf("ParseSuggestionKey(%q): %v", suggestion.Key(), err)
+	}
+	if parsed.Kind != SuggestVendor || parsed.VendorID == nil || *parsed.VendorID != 7 || parsed.CategoryID != 3 {
+		t.Errorf("parsed = %+v", parsed)
+	}
+
+	parsed, err = ParseSuggestionKey("description:Bottle:20")
+	if err != nil || parsed.Pattern != "bottle" || parsed.CategoryID != 20 {
+		t.Errorf("parsed = %+v, %v", parsed, err)
+	}
+	rule := parsed.Rule()
+	if rule.Conditions.DescriptionContains != "bottle" || *rule.Actions.CategoryID != 20 || !rule.Enabled {
+		t.Errorf("rule = %+v", rule)
+	}
+	if _, err := Compile(rule); err != nil {
+		t.Errorf("suggested rule does not compile: %v", err)
+	}
+
+	for _, key := range []string{"", "vendor:x:1", "description::1", "amount:5:1", "vendor:1"} {
+		if _, err := ParseSuggestionKey(key); err == nil {
+			t.Errorf("ParseSuggestionKey(%q) should fail", key)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+-- V10__Expand_expense_history.sql
+-- Turn expense_history into a full audit trail with old/new values and actor
+
+-- Allow every kind of expense change, not just AI suggestions
+ALTER TABLE expense_history DROP CONSTRAINT IF EXISTS expense_history_event_type_check;
+ALTER TABLE expense_history ADD CONSTRAINT expense_history_event_type_check CHECK
+  (event_type IN ('ai_suggest', 'retry', 'manual_accept', 'manual_clear', 'edit',
+                  'personal_toggle', 'propagate', 'create', 'delete', 'restore',
+                  'undo', 'redo'));
+
+-- Who made the change ('ai' or a user id) and what it changed
+ALTER TABLE expense_history ADD COLUMN actor TEXT;
+ALTER TABLE expense_history ADD COLUMN old_value JSONB;
+ALTER TABLE expense_history ADD COLUMN new_value JSONB;
+
+-- Link events produced by one undoable action
+ALTER TABLE expense_history ADD COLUMN change_set_id BIGINT
+  REFERENCES expense_change_set(id) ON DELETE SET NULL;
+
+-- Existing rows were all written by the AI categorizer
+UPDATE expense_history SET actor = 'ai' WHERE event_type = 'ai_suggest';
+
+-- Index for newest-first activity feeds
+CREATE INDEX idx_expense_hist_created ON expense_history(expense_id, created_at DESC);
@@ -0,0 +1,5 @@
+-- V11__Add_expense_version.sql
+-- Row version for optimistic concurrency control on expense updates
+
+-- Every write to an expense increments version; clients send it back in If-Match
+ALTER TABLE expense ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
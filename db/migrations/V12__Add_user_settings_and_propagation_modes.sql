@@ -0,0 +1,31 @@
+-- V12__Add_user_settings_and_propagation_modes.sql
+-- Per-user settings, starting with how accepted categories propagate to similar expenses
+
+-- 1. user_settings – one row per user; missing rows mean defaults
+CREATE TABLE user_settings (
+  user_id                       UUID          PRIMARY KEY,
+  propagation_mode              TEXT          NOT NULL DEFAULT 'exact' CHECK
+                                 (propagation_mode IN ('off', 'exact', 'normalized', 'trigram', 'amount')),
+  propagation_threshold         REAL          NOT NULL DEFAULT 0.6 CHECK
+                                 (propagation_threshold > 0 AND propagation_threshold <= 1),
+  propagation_amount_tolerance  NUMERIC(14,2) NOT NULL DEFAULT 0 CHECK
+                                 (propagation_amount_tolerance >= 0),
+  created_at                    TIMESTAMPTZ   DEFAULT NOW(),
+  updated_at                    TIMESTAMPTZ   DEFAULT NOW()
+);
+
+-- 2. normalize_description – lowercases, drops tokens containing digits (store numbers,
+-- trip codes, card suffixes) and collapses punctuation, so
+-- 'UBER *TRIP 8X2K' and 'UBER *TRIP 3J9L' both become 'uber trip'
+CREATE OR REPLACE FUNCTION normalize_description(description TEXT) RETURNS TEXT AS $$
+  SELECT btrim(regexp_replace(
+           regexp_replace(
+             regexp_replace(lower(COALESCE(description, '')), '\S*[0-9]\S*', ' ', 'g'),
+             '[^a-z]+', ' ', 'g'),
+           '\s+', ' ', 'g'))
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Index for normalized and amount-aware propagation
+CREATE INDEX idx_expense_desc_normalized
+    ON expense (project_id, normalize_description(description))
+    WHERE accepted_category_id IS NULL;
@@ -0,0 +1,68 @@
+-- V13__Add_transfer_detection.sql
+-- Link matching outflow/inflow pairs across statement sources (e.g. checking → credit card
+-- payment) so they are not counted twice in totals
+
+-- 1. parse_expense_date – best-effort parse of the CSV date text
+-- Supports YYYY-MM-DD, YYYY/MM/DD, MM/DD/YYYY and MM/DD/YY; anything else is NULL
+CREATE OR REPLACE FUNCTION parse_expense_date(date_text TEXT) RETURNS DATE AS $$
+DECLARE
+  parts TEXT[];
+BEGIN
+  IF date_text IS NULL THEN
+    RETURN NULL;
+  END IF;
+
+  parts := regexp_match(btrim(date_text), '^(\d{4})[-/](\d{1,2})[-/](\d{1,2})');
+  IF parts IS NOT NULL THEN
+    RETURN make_date(parts[1]::int, parts[2]::int, parts[3]::int);
+  END IF;
+
+  parts := regexp_match(btrim(date_text), '^(\d{1,2})[-/](\d{1,2})[-/](\d{4}|\d{2})$');
+  IF parts IS NOT NULL THEN
+    RETURN make_date(
+      CASE WHEN length(parts[3]) = 2 THEN 2000 + parts[3]::int ELSE parts[3]::int END,
+      parts[1]::int, parts[2]::int);
+  END IF;
+
+  RETURN NULL;
+EXCEPTION WHEN others THEN
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- Parsed date kept in step with date_text automatically
+ALTER TABLE expense ADD COLUMN expense_date DATE
+  GENERATED ALWAYS AS (parse_expense_date(date_text)) STORED;
+
+CREATE INDEX idx_expense_date ON expense (project_id, expense_date);
+
+-- 2. expense_transfer – a linked outflow/inflow pair
+CREATE TABLE expense_transfer (
+  id                  BIGSERIAL PRIMARY KEY,
+  project_id          BIGINT        NOT NULL
+                       REFERENCES project(id) ON DELETE CASCADE,
+  outflow_expense_id  BIGINT        NOT NULL
+                       REFERENCES expense(id) ON DELETE CASCADE,
+  inflow_expense_id   BIGINT        NOT NULL
+                       REFERENCES expense(id) ON DELETE CASCADE,
+  status              TEXT          NOT NULL DEFAULT 'detected' CHECK
+                       (status IN ('detected', 'confirmed', 'rejected')),
+  created_at          TIMESTAMPTZ   DEFAULT NOW(),
+  updated_at          TIMESTAMPTZ   DEFAULT NOW(),
+  CONSTRAINT uniq_transfer_pair UNIQUE (outflow_expense_id, inflow_expense_id)
+);
+
+CREATE INDEX idx_transfer_project ON expense_transfer(project_id, status);
+
+-- Expenses in a detected or confirmed transfer point at it; rejected pairs are unlinked
+ALTER TABLE expense ADD COLUMN transfer_id BIGINT
+  REFERENCES expense_transfer(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_expense_transfer ON expense (transfer_id) WHERE transfer_id IS NOT NULL;
+
+-- 3. Audit linking and unlinking
+ALTER TABLE expense_history DROP CONSTRAINT IF EXISTS expense_history_event_type_check;
+ALTER TABLE expense_history ADD CONSTRAINT expense_history_event_type_check CHECK
+  (event_type IN ('ai_suggest', 'retry', 'manual_accept', 'manual_clear', 'edit',
+                  'personal_toggle', 'propagate', 'create', 'delete', 'restore',
+                  'undo', 'redo', 'transfer_link', 'transfer_unlink'));
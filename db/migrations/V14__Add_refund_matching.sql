@@ -0,0 +1,17 @@
+-- V14__Add_refund_matching.sql
+-- Link refunds and chargebacks to the purchase they reverse so they share its category
+
+-- 1. A refund points at its original purchase; one purchase may have several partial refunds
+ALTER TABLE expense ADD COLUMN refund_of_expense_id BIGINT
+  REFERENCES expense(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_expense_refund_of ON expense (refund_of_expense_id)
+  WHERE refund_of_expense_id IS NOT NULL;
+
+-- 2. Audit linking and unlinking
+ALTER TABLE expense_history DROP CONSTRAINT IF EXISTS expense_history_event_type_check;
+ALTER TABLE expense_history ADD CONSTRAINT expense_history_event_type_check CHECK
+  (event_type IN ('ai_suggest', 'retry', 'manual_accept', 'manual_clear', 'edit',
+                  'personal_toggle', 'propagate', 'create', 'delete', 'restore',
+                  'undo', 'redo', 'transfer_link', 'transfer_unlink',
+                  'refund_link', 'refund_unlink'));
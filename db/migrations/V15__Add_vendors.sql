@@ -0,0 +1,40 @@
+-- V15__Add_vendors.sql
+-- Canonical vendors derived from statement descriptions, with optional default categories
+
+-- 1. vendor – one record per canonical merchant per user
+CREATE TABLE vendor (
+  id                   BIGSERIAL PRIMARY KEY,
+  user_id              UUID          NOT NULL,
+  name                 TEXT          NOT NULL,
+  default_category_id  BIGINT
+                        REFERENCES expense_category(id) ON DELETE SET NULL,
+  created_at           TIMESTAMPTZ   DEFAULT NOW(),
+  updated_at           TIMESTAMPTZ   DEFAULT NOW()
+);
+
+CREATE INDEX idx_vendor_user ON vendor(user_id, lower(name));
+
+-- 2. vendor_alias – normalized merchant keys that resolve to a vendor.
+-- Merging vendors moves the aliases, so future imports land on the surviving vendor.
+CREATE TABLE vendor_alias (
+  id          BIGSERIAL PRIMARY KEY,
+  user_id     UUID          NOT NULL,
+  alias_key   TEXT          NOT NULL,            -- merchant.Key of the normalized name
+  vendor_id   BIGINT        NOT NULL
+               REFERENCES vendor(id) ON DELETE CASCADE,
+  created_at  TIMESTAMPTZ   DEFAULT NOW(),
+  CONSTRAINT uniq_vendor_alias UNIQUE (user_id, alias_key)
+);
+
+CREATE INDEX idx_vendor_alias_vendor ON vendor_alias(vendor_id);
+
+-- 3. Each expense points at its vendor; assigned by the backend at import
+ALTER TABLE expense ADD COLUMN vendor_id BIGINT
+  REFERENCES vendor(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_expense_vendor ON expense (project_id, vendor_id);
+
+-- 4. Vendor-based propagation
+ALTER TABLE user_settings DROP CONSTRAINT IF EXISTS user_settings_propagation_mode_check;
+ALTER TABLE user_settings ADD CONSTRAINT user_settings_propagation_mode_check CHECK
+  (propagation_mode IN ('off', 'exact', 'normalized', 'trigram', 'amount', 'vendor'));
@@ -0,0 +1,59 @@
+-- V16__Add_currencies_and_exchange_rates.sql
+-- Currency per project and per expense, a user-maintained exchange rate table, and a
+-- conversion helper for reports
+
+-- 1. Currencies (ISO 4217 codes). An expense without its own currency uses its project's.
+ALTER TABLE project ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD'
+  CHECK (currency ~ '^[A-Z]{3}$');
+
+ALTER TABLE expense ADD COLUMN currency CHAR(3)
+  CHECK (currency ~ '^[A-Z]{3}$');
+
+-- 2. exchange_rate – 1 unit of base_currency = rate units of quote_currency on rate_date
+CREATE TABLE exchange_rate (
+  id              BIGSERIAL PRIMARY KEY,
+  user_id         UUID           NOT NULL,
+  rate_date       DATE           NOT NULL,
+  base_currency   CHAR(3)        NOT NULL CHECK (base_currency ~ '^[A-Z]{3}$'),
+  quote_currency  CHAR(3)        NOT NULL CHECK (quote_currency ~ '^[A-Z]{3}$'),
+  rate            NUMERIC(18,8)  NOT NULL CHECK (rate > 0),
+  created_at      TIMESTAMPTZ    DEFAULT NOW(),
+  updated_at      TIMESTAMPTZ    DEFAULT NOW(),
+  CONSTRAINT uniq_exchange_rate UNIQUE (user_id, base_currency, quote_currency, rate_date)
+);
+
+-- 3. convert_amount – converts using the user's rate nearest to the date (the latest rate
+-- when the date is unknown), trying the direct pair before the inverse. NULL when no rate.
+CREATE OR REPLACE FUNCTION convert_amount(p_user_id UUID, p_amount NUMERIC, p_from TEXT,
+                                          p_to TEXT, p_date DATE) RETURNS NUMERIC AS $$
+DECLARE
+  found_rate NUMERIC;
+BEGIN
+  IF p_amount IS NULL THEN
+    RETURN NULL;
+  END IF;
+  IF p_from = p_to THEN
+    RETURN p_amount;
+  END IF;
+
+  SELECT rate INTO found_rate
+  FROM exchange_rate
+  WHERE user_id = p_user_id AND base_currency = p_from AND quote_currency = p_to
+  ORDER BY CASE WHEN p_date IS NULL THEN 0 ELSE abs(rate_date - p_date) END, rate_date DESC
+  LIMIT 1;
+  IF found_rate IS NOT NULL THEN
+    RETURN round(p_amount * found_rate, 2);
+  END IF;
+
+  SELECT rate INTO found_rate
+  FROM exchange_rate
+  WHERE user_id = p_user_id AND base_currency = p_to AND quote_currency = p_from
+  ORDER BY CASE WHEN p_date IS NULL THEN 0 ELSE abs(rate_date - p_date) END, rate_date DESC
+  LIMIT 1;
+  IF found_rate IS NOT NULL THEN
+    RETURN round(p_amount / found_rate, 2);
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql STABLE;
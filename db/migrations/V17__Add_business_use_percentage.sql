@@ -0,0 +1,21 @@
+-- V17__Add_business_use_percentage.sql
+-- Partial business use: a business-use percentage per expense with per-category defaults.
+-- is_personal stays as the 0% shorthand and is kept in step by the backend.
+
+-- 1. Per-expense percentage; NULL means "use the category default" (100% when it has none)
+ALTER TABLE expense ADD COLUMN business_pct SMALLINT
+  CHECK (business_pct BETWEEN 0 AND 100);
+
+UPDATE expense SET business_pct = 0 WHERE is_personal = TRUE;
+
+-- 2. Per-category default, e.g. Utilities 30%
+ALTER TABLE expense_category ADD COLUMN default_business_pct SMALLINT
+  CHECK (default_business_pct BETWEEN 0 AND 100);
+
+-- 3. Undo/redo snapshots carry the percentage too
+ALTER TABLE expense_change ADD COLUMN old_business_pct SMALLINT;
+ALTER TABLE expense_change ADD COLUMN new_business_pct SMALLINT;
+
+UPDATE expense_change
+SET old_business_pct = CASE WHEN old_is_personal THEN 0 END,
+    new_business_pct = CASE WHEN new_is_personal THEN 0 END;
@@ -0,0 +1,23 @@
+-- V18__Add_category_hierarchy.sql
+-- Parent/child categories (e.g. Travel → Airfare, Lodging). sort_order now orders a
+-- category among its siblings rather than across the whole list.
+
+-- 1. Parent link; top-level categories have no parent
+ALTER TABLE expense_category ADD COLUMN parent_id BIGINT
+  REFERENCES expense_category(id) ON DELETE SET NULL;
+
+ALTER TABLE expense_category ADD CONSTRAINT chk_category_not_own_parent
+  CHECK (parent_id IS NULL OR parent_id <> id);
+
+CREATE INDEX idx_expense_category_parent ON expense_category(user_id, parent_id, sort_order)
+  WHERE deleted_at IS NULL;
+
+-- 2. Renumber existing categories 1..n so moves always have a neighbour to swap with
+UPDATE expense_category ec
+SET sort_order = numbered.position
+FROM (
+  SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY sort_order, id) AS position
+  FROM expense_category
+  WHERE deleted_at IS NULL
+) numbered
+WHERE ec.id = numbered.id;
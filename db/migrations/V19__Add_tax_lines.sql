@@ -0,0 +1,71 @@
+-- V19__Add_tax_lines.sql
+-- Tax form lines that categories roll up to: IRS Schedule C lines 8–27 are built in
+-- (user_id NULL); users can add lines for other forms.
+
+-- 1. tax_line – one line of a tax form
+CREATE TABLE tax_line (
+  id          BIGSERIAL PRIMARY KEY,
+  user_id     UUID,                    -- NULL for built-in lines
+  form        TEXT          NOT NULL,
+  line        TEXT          NOT NULL,  -- as printed on the form, e.g. '16a'
+  description TEXT          NOT NULL,
+  sort_order  INTEGER       NOT NULL DEFAULT 0,
+  created_at  TIMESTAMPTZ   DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX uniq_tax_line_form_line
+  ON tax_line (COALESCE(user_id, '00000000-0000-0000-0000-000000000000'::uuid), form, line);
+
+-- 2. Schedule C (Form 1040), Part II expenses
+INSERT INTO tax_line (form, line, description, sort_order) VALUES
+  ('Schedule C', '8',   'Advertising', 1),
+  ('Schedule C', '9',   'Car and truck expenses', 2),
+  ('Schedule C', '10',  'Commissions and fees', 3),
+  ('Schedule C', '11',  'Contract labor', 4),
+  ('Schedule C', '12',  'Depletion', 5),
+  ('Schedule C', '13',  'Depreciation and section 179 expense deduction', 6),
+  ('Schedule C', '14',  'Employee benefit programs', 7),
+  ('Schedule C', '15',  'Insurance (other than health)', 8),
+  ('Schedule C', '16a', 'Interest: mortgage (paid to banks, etc.)', 9),
+  ('Schedule C', '16b', 'Interest: other', 10),
+  ('Schedule C', '17',  'Legal and professional services', 11),
+  ('Schedule C', '18',  'Office expense', 12),
+  ('Schedule C', '19',  'Pension and profit-sharing plans', 13),
+  ('Schedule C', '20a', 'Rent or lease: vehicles, machinery, and equipment', 14),
+  ('Schedule C', '20b', 'Rent or lease: other business property', 15),
+  ('Schedule C', '21',  'Repairs and maintenance', 16),
+  ('Schedule C', '22',  'Supplies (not included in Part III)', 17),
+  ('Schedule C', '23',  'Taxes and licenses', 18),
+  ('Schedule C', '24a', 'Travel', 19),
+  ('Schedule C', '24b', 'Deductible meals', 20),
+  ('Schedule C', '25',  'Utilities', 21),
+  ('Schedule C', '26',  'Wages (less employment credits)', 22),
+  ('Schedule C', '27a', 'Other expenses', 23),
+  ('Schedule C', '27b', 'Energy efficient commercial buildings deduction', 24);
+
+-- 3. Category mapping
+ALTER TABLE expense_category ADD COLUMN tax_line_id BIGINT
+  REFERENCES tax_line(id) ON DELETE SET NULL;
+
+-- 4. Starting mappings for the seeded categories; Medical stays unmapped
+UPDATE expense_category ec
+SET tax_line_id = tl.id
+FROM (VALUES
+  ('Gasoline', '9'), ('Parking', '9'), ('Tolls', '9'), ('Auto Insurance', '9'),
+  ('Auto Maintenance', '9'), ('Auto Registration', '9'),
+  ('Meals', '24b'), ('Travel', '24a'),
+  ('Computer', '13'),
+  ('Payroll', '26'),
+  ('Renter''s Insurance', '15'),
+  ('Phone', '25'), ('Internet', '25'), ('Water', '25'), ('Electric', '25'), ('Gas Utility Bill', '25'),
+  ('Rent', '20b'),
+  ('Home Improvement', '21'),
+  ('Tax Prep', '17'),
+  ('Office Supplies', '18'), ('Postage', '18'), ('Software', '18'), ('Hosting', '18'),
+  ('Project Supplies', '22'),
+  ('Business Filings', '23'),
+  ('Fees', '10'),
+  ('Education/Training', '27a')
+) AS mapping(category_name, line)
+JOIN tax_line tl ON tl.form = 'Schedule C' AND tl.line = mapping.line AND tl.user_id IS NULL
+WHERE ec.name = mapping.category_name;
@@ -0,0 +1,9 @@
+-- V20__Add_category_merge_history.sql
+-- Audit expenses moved to another category when categories are merged
+
+ALTER TABLE expense_history DROP CONSTRAINT IF EXISTS expense_history_event_type_check;
+ALTER TABLE expense_history ADD CONSTRAINT expense_history_event_type_check CHECK
+  (event_type IN ('ai_suggest', 'retry', 'manual_accept', 'manual_clear', 'edit',
+                  'personal_toggle', 'propagate', 'create', 'delete', 'restore',
+                  'undo', 'redo', 'transfer_link', 'transfer_unlink',
+                  'refund_link', 'refund_unlink', 'category_merge'));
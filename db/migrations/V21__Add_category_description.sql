@@ -0,0 +1,4 @@
+-- V21__Add_category_description.sql
+-- Free-text description on categories, carried by category set templates and exports
+
+ALTER TABLE expense_category ADD COLUMN description TEXT;
@@ -0,0 +1,28 @@
+-- V22__Add_project_categories.sql
+-- Project-specific category lists. Categories with project_id NULL are the user's defaults;
+-- a project uses its own categories plus, when inherit_categories is set, the defaults.
+
+-- 1. Category ownership and the inherit flag
+ALTER TABLE expense_category ADD COLUMN project_id BIGINT
+  REFERENCES project(id) ON DELETE CASCADE;
+CREATE INDEX idx_expense_category_project ON expense_category(project_id);
+
+ALTER TABLE project ADD COLUMN inherit_categories BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- 2. Hotkeys are unique within a list rather than globally, and only among active
+--    categories. Clashes between a project's own list and the defaults it inherits are
+--    checked by the application.
+ALTER TABLE expense_category DROP CONSTRAINT IF EXISTS expense_category_hotkey_key;
+CREATE UNIQUE INDEX uniq_category_hotkey
+  ON expense_category (user_id, COALESCE(project_id, 0), hotkey)
+  WHERE deleted_at IS NULL AND hotkey IS NOT NULL;
+
+-- 3. project_categories(project) – the active categories a project uses
+CREATE OR REPLACE FUNCTION project_categories(p_project_id BIGINT)
+RETURNS SETOF expense_category AS $$
+  SELECT c.*
+  FROM expense_category c
+  JOIN project p ON p.id = p_project_id AND c.user_id = p.user_id
+  WHERE c.deleted_at IS NULL
+    AND (c.project_id = p.id OR (c.project_id IS NULL AND p.inherit_categories))
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,23 @@
+-- V23__Add_category_budgets.sql
+-- Spending budgets per category per calendar month or year, for one project or (project_id
+-- NULL) across all of the user's projects
+
+-- 1. category_budget – a budget covers the category and its subcategories
+CREATE TABLE category_budget (
+  id           BIGSERIAL PRIMARY KEY,
+  user_id      UUID           NOT NULL,
+  category_id  BIGINT         NOT NULL
+                REFERENCES expense_category(id) ON DELETE CASCADE,
+  project_id   BIGINT
+                REFERENCES project(id) ON DELETE CASCADE,   -- NULL for all projects
+  period       TEXT           NOT NULL CHECK (period IN ('monthly', 'annual')),
+  amount       NUMERIC(14,2)  NOT NULL CHECK (amount > 0),
+  currency     CHAR(3)        NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+  created_at   TIMESTAMPTZ    DEFAULT NOW(),
+  updated_at   TIMESTAMPTZ    DEFAULT NOW()
+);
+
+-- 2. One budget per category, scope and period
+CREATE UNIQUE INDEX uniq_category_budget
+  ON category_budget (category_id, COALESCE(project_id, 0), period);
+CREATE INDEX idx_category_budget_user ON category_budget (user_id, project_id);
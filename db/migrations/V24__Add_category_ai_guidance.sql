@@ -0,0 +1,6 @@
+-- V24__Add_category_ai_guidance.sql
+-- Categorization guidance on categories, given to the AI alongside the description
+
+ALTER TABLE expense_category ADD COLUMN include_guidance TEXT;   -- what belongs here
+ALTER TABLE expense_category ADD COLUMN exclude_guidance TEXT;   -- what does not, and where it goes
+ALTER TABLE expense_category ADD COLUMN examples TEXT[] NOT NULL DEFAULT '{}';  -- pinned example descriptions
@@ -0,0 +1,33 @@
+-- V25__Add_categorization_rules.sql
+-- User-defined categorization rules, applied at import and before AI categorization, and
+-- free-form tags on expenses that rules can add
+
+-- 1. categorization_rule – conditions and actions are JSON (see models.RuleConditions and
+--    models.RuleActions); rules run in ascending priority
+CREATE TABLE categorization_rule (
+  id           BIGSERIAL PRIMARY KEY,
+  user_id      UUID          NOT NULL,
+  project_id   BIGINT
+                REFERENCES project(id) ON DELETE CASCADE,   -- NULL for all projects
+  name         TEXT          NOT NULL,
+  priority     INTEGER       NOT NULL DEFAULT 100,
+  enabled      BOOLEAN       NOT NULL DEFAULT TRUE,
+  conditions   JSONB         NOT NULL,
+  actions      JSONB         NOT NULL,
+  created_at   TIMESTAMPTZ   DEFAULT NOW(),
+  updated_at   TIMESTAMPTZ   DEFAULT NOW()
+);
+
+CREATE INDEX idx_categorization_rule_user ON categorization_rule (user_id, project_id);
+
+-- 2. Tags on expenses (lower case)
+ALTER TABLE expense ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX idx_expense_tags ON expense USING GIN (tags);
+
+-- 3. Audit rule applications
+ALTER TABLE expense_history DROP CONSTRAINT IF EXISTS expense_history_event_type_check;
+ALTER TABLE expense_history ADD CONSTRAINT expense_history_event_type_check CHECK
+  (event_type IN ('ai_suggest', 'retry', 'manual_accept', 'manual_clear', 'edit',
+                  'personal_toggle', 'propagate', 'create', 'delete', 'restore',
+                  'undo', 'redo', 'transfer_link', 'transfer_unlink',
+                  'refund_link', 'refund_unlink', 'category_merge', 'rule_apply'));
@@ -0,0 +1,6 @@
+-- V26__Add_tags_to_expense_changes.sql
+-- Undo/redo snapshots carry expense tags so rule applications undo completely.
+-- NULL means the change did not touch tags, and undo/redo leaves them alone.
+
+ALTER TABLE expense_change ADD COLUMN old_tags TEXT[];
+ALTER TABLE expense_change ADD COLUMN new_tags TEXT[];
@@ -0,0 +1,9 @@
+-- V8__Add_manual_expenses.sql
+-- Distinguish manually entered expenses from CSV-imported rows
+
+-- Add is_manual column to expense table
+ALTER TABLE expense ADD COLUMN is_manual BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Add index for soft-deleted expense lookups (restore/archive views)
+CREATE INDEX idx_expense_deleted ON expense (project_id, deleted_at)
+    WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,33 @@
+-- V9__Add_expense_change_sets.sql
+-- Undo/redo support: each user action is stored as a change set of per-row before/after states
+
+-- 1. expense_change_set – one record per undoable action
+CREATE TABLE expense_change_set (
+  id          BIGSERIAL PRIMARY KEY,
+  project_id  BIGINT        NOT NULL
+               REFERENCES project(id) ON DELETE CASCADE,
+  user_id     UUID          NOT NULL,
+  action      TEXT          NOT NULL,          -- e.g. 'update_expense'
+  undone_at   TIMESTAMPTZ,                     -- set while the change sits on the redo stack
+  created_at  TIMESTAMPTZ   DEFAULT NOW()
+);
+
+CREATE INDEX idx_change_set_project ON expense_change_set(project_id, undone_at, id);
+
+-- 2. expense_change – before/after snapshot of every row touched by a change set
+-- Category columns intentionally have no foreign key so undo restores the exact prior value
+CREATE TABLE expense_change (
+  id                         BIGSERIAL PRIMARY KEY,
+  change_set_id              BIGINT   NOT NULL
+                              REFERENCES expense_change_set(id) ON DELETE CASCADE,
+  expense_id                 BIGINT   NOT NULL
+                              REFERENCES expense(id) ON DELETE CASCADE,
+  old_accepted_category_id   BIGINT,
+  new_accepted_category_id   BIGINT,
+  old_suggested_category_id  BIGINT,
+  new_suggested_category_id  BIGINT,
+  old_is_personal            BOOLEAN  NOT NULL DEFAULT FALSE,
+  new_is_personal            BOOLEAN  NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_expense_change_set ON expense_change(change_set_id);